@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/backup"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/database"
+	"github.com/mhtecdev/blog-ai/internal/repository"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/internal/site"
+)
+
+const usage = `Usage:
+  server                      start the blog
+  server backup [-dir DIR]    write a backup archive while the blog runs
+  server restore [-dry-run] ARCHIVE
+                              verify ARCHIVE and swap it in (stop the blog first)
+  server build [-dir DIR]     render the public site into static files
+`
+
+// runCommand runs the subcommand in args and returns the exit code.
+func runCommand(cfg *config.Config, args []string) int {
+	var err error
+	switch args[0] {
+	case "backup":
+		err = runBackup(cfg, args[1:])
+	case "restore":
+		err = runRestore(cfg, args[1:])
+	case "build":
+		err = runBuild(cfg, args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runBackup(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := fs.String("dir", cfg.BackupDir, "directory to write the archive to")
+	fs.Parse(args)
+
+	if _, err := os.Stat(cfg.DBPath); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	db := database.Open(cfg.DBPath)
+	defer db.Close()
+
+	a, err := backup.Create(context.Background(), db, cfg.UploadDir, *dir, time.Now())
+	if err != nil {
+		return err
+	}
+	removed, err := backup.Prune(*dir, cfg.BackupKeep)
+	for _, name := range removed {
+		fmt.Println("rotated out", name)
+	}
+	fmt.Printf("wrote %s/%s (%d bytes)\n", *dir, a.Name, a.Size)
+	return err
+}
+
+func runRestore(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only verify the archive")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("restore: expected one archive\n\n%s", usage)
+	}
+	src := fs.Arg(0)
+
+	if *dryRun {
+		m, err := backup.Verify(src)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s is valid: %d files, taken %s\n", src, len(m.Files), m.CreatedAt.Format(time.RFC3339))
+		return nil
+	}
+
+	m, err := backup.Restore(context.Background(), src, cfg.DBPath, cfg.UploadDir, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s (%d files, taken %s)\n", src, len(m.Files), m.CreatedAt.Format(time.RFC3339))
+	fmt.Println("the previous database and uploads were kept beside the database with a .pre-restore-* suffix; delete them once the blog looks right")
+	return nil
+}
+
+func runBuild(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	dir := fs.String("dir", cmp.Or(cfg.StaticDir, "./dist"), "directory to write the site to")
+	fs.Parse(args)
+
+	if _, err := os.Stat(cfg.DBPath); err != nil {
+		return fmt.Errorf("build: %w", err)
+	}
+	db := database.Open(cfg.DBPath)
+	defer db.Close()
+
+	posts := service.NewPostService(repository.NewPostRepo(db))
+	if _, err := posts.RenderStale(context.Background()); err != nil {
+		return fmt.Errorf("build: %w", err)
+	}
+	builder := site.NewBuilder(posts, newViews(cfg), cfg, "./web/static", *dir)
+	start := time.Now()
+	res, err := builder.Build(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("built %d pages into %s (%d assets copied) in %s\n", res.Pages, *dir, res.Assets, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -1,24 +1,34 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"html/template"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	htmlEngine "github.com/gofiber/template/html/v2"
 	"github.com/joho/godotenv"
 
 	"github.com/mhtecdev/blog-ai/internal/config"
 	"github.com/mhtecdev/blog-ai/internal/database"
+	"github.com/mhtecdev/blog-ai/internal/logging"
+	"github.com/mhtecdev/blog-ai/internal/mailer"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+	handlerOps "github.com/mhtecdev/blog-ai/internal/handler/ops"
 	handlerPublic "github.com/mhtecdev/blog-ai/internal/handler/public"
 	handlerStudio "github.com/mhtecdev/blog-ai/internal/handler/studio"
 	"github.com/mhtecdev/blog-ai/internal/middleware"
+	"github.com/mhtecdev/blog-ai/internal/pagecache"
 	"github.com/mhtecdev/blog-ai/internal/repository"
 	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/internal/site"
 )
 
 func main() {
@@ -27,8 +37,13 @@ func main() {
 
 	cfg := config.Load()
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1:]))
+	}
+
 	db := database.Open(cfg.DBPath)
 	database.RunMigrations(db)
+	db.StartMaintenance(cfg.DBMaintenance)
 
 	// Repositories
 	userRepo      := repository.NewUserRepo(db)
@@ -40,42 +55,61 @@ func main() {
 	// Services
 	authSvc, err := service.NewAuthService(userRepo, sessionRepo, cfg)
 	if err != nil {
-		log.Fatalf("failed to init auth service: %v", err)
+		logging.Fatal("failed to init auth service", "error", err)
 	}
 	postSvc      := service.NewPostService(postRepo)
+	relatedSvc   := service.NewRelatedService(postSvc) // before other OnChange hooks, which render pages
 	analyticsSvc := service.NewAnalyticsService(analyticsRepo, cfg)
 	mediaSvc     := service.NewMediaService(mediaRepo, cfg)
+	if _, err := postSvc.RenderStale(context.Background()); err != nil {
+		slog.Warn("failed to render existing posts again", "error", err)
+	}
 
-	// Template engine
-	engine := htmlEngine.New("./web/templates", ".html")
-	if cfg.IsDevelopment() {
-		engine.Reload(true) // hot-reload templates in dev
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		logging.Fatal("failed to init mailer", "error", err)
+	}
+	digestSvc    := service.NewDigestService(analyticsRepo, analyticsSvc, mail, cfg)
+	backupSvc    := service.NewBackupService(db, cfg)
+	transferSvc  := service.NewTransferService(postSvc, mediaSvc, cfg)
+
+	engine := newViews(cfg)
+
+	// Static site, kept in step with the posts
+	var publisher *site.Publisher
+	if cfg.StaticDir != "" {
+		builder := site.NewBuilder(postSvc, engine, cfg, "./web/static", cfg.StaticDir)
+		publisher = site.NewPublisher(builder)
+		postSvc.OnChange(publisher.Notify)
 	}
-	// Register template functions
-	engine.AddFunc("safeHTML", func(s string) template.HTML {
-		return template.HTML(s)
-	})
-	engine.AddFunc("inc", func(i int) int { return i + 1 })
-	engine.AddFunc("jsonViews", func(v interface{}) string {
-		b, _ := json.Marshal(v)
-		return string(b)
-	})
 
 	app := fiber.New(fiber.Config{
-		Views:        engine,
-		ErrorHandler: errorHandler,
-		BodyLimit:    int(cfg.UploadMaxMB) * 1024 * 1024,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		Views:                 engine,
+		DisableStartupMessage: true,
+		ErrorHandler:          middleware.ErrorHandler,
+		BodyLimit:             int(cfg.UploadMaxMB) * 1024 * 1024,
+		ReadTimeout:           10 * time.Second,
+		WriteTimeout:          30 * time.Second,
+		IdleTimeout:           120 * time.Second,
 	})
 
+	// Metrics
+	metricsReg := metrics.NewRegistry()
+	metrics.RegisterRuntime(metricsReg)
+	metrics.RegisterDBStats(metricsReg, map[string]*sql.DB{"read": db.Read, "write": db.Write})
+	analyticsSvc.RegisterMetrics(metricsReg)
+	backupSvc.RegisterMetrics(metricsReg)
+	if publisher != nil {
+		publisher.RegisterMetrics(metricsReg)
+	}
+
 	// Global middleware
+	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestTimeout(cfg.RequestTimeout))
 	app.Use(recover.New())
+	app.Use(middleware.AccessLog())
+	app.Use(middleware.RequestMetrics(metricsReg))
 	app.Use(middleware.SecurityHeaders(cfg))
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} ${method} ${path} ${latency}\n",
-	}))
 
 	// Static files
 	app.Static("/static", "./web/static")
@@ -83,28 +117,57 @@ func main() {
 	// Rate limiter for login endpoint
 	rateLimiter := middleware.NewRateLimiter(cfg)
 	go rateLimiter.Cleanup()
+	rateLimiter.RegisterMetrics(metricsReg)
 
 	// Auth middleware for protected routes
 	authMW := middleware.RequireAuth(authSvc)
+	// Optional auth for public routes that behave differently for signed-in users
+	userMW := middleware.LoadUser(authSvc)
+
+	// ─── Operational routes ──────────────────────────────────────────────────
+	healthH     := handlerOps.NewHealthHandler(db, cfg)
+	opsMetricsH := handlerOps.NewMetricsHandler(metricsReg)
+
+	app.Get("/healthz", healthH.Live)
+	app.Get("/readyz", healthH.Ready)
+	app.Get("/metrics", middleware.MetricsAuth(cfg), opsMetricsH.Handle)
 
 	// ─── Public routes ───────────────────────────────────────────────────────
-	homeH     := handlerPublic.NewHomeHandler(postSvc)
-	postH     := handlerPublic.NewPostHandler(postSvc, analyticsSvc)
-	categoryH := handlerPublic.NewCategoryHandler(postSvc)
-	timelineH := handlerPublic.NewTimelineHandler(postSvc)
-
-	app.Get("/", homeH.Handle)
-	app.Get("/posts/:slug", postH.Show)
-	app.Get("/categories", categoryH.List)
-	app.Get("/categories/:slug", categoryH.Show)
-	app.Get("/timeline", timelineH.Handle)
-	app.Get("/about", handlerPublic.AboutHandler)
+	// Rendered pages are cached until a post change makes them stale.
+	pageCache := pagecache.New(cfg.PageCacheSize)
+	postSvc.OnChange(pageCache.PostChanged)
+	pageCache.RegisterMetrics(metricsReg)
+	cached := pageCache.Middleware()
+
+	homeH     := handlerPublic.NewHomeHandler(postSvc, cfg.PostsPerPage)
+	postH     := handlerPublic.NewPostHandler(postSvc, relatedSvc, analyticsSvc, pageCache)
+	categoryH := handlerPublic.NewCategoryHandler(postSvc, cfg.PostsPerPage)
+	timelineH := handlerPublic.NewTimelineHandler(postSvc, cfg.PostsPerPage)
+	feedH     := handlerPublic.NewFeedHandler(postSvc, cfg)
+	beaconH   := handlerPublic.NewBeaconHandler(analyticsSvc)
+	codeH     := handlerPublic.NewCodeStyleHandler(cfg)
+
+	app.Get("/", cached, homeH.Handle)
+	app.Get("/posts/:slug", userMW, postH.Show)
+	app.Get("/categories", cached, categoryH.List)
+	app.Get("/categories/:slug", cached, categoryH.Show)
+	app.Get("/categories/:slug/feed.xml", cached, feedH.CategoryAtom)
+	app.Get("/timeline", cached, timelineH.Handle)
+	app.Get("/archive/:year", cached, timelineH.Year)
+	app.Get("/archive/:year/:month", cached, timelineH.Month)
+	app.Get("/about", cached, handlerPublic.AboutHandler)
+	app.Get("/feed.xml", cached, feedH.Atom)
+	app.Get("/sitemap.xml", cached, feedH.Sitemap)
+	app.Get("/code.css", cached, codeH.Handle)
+	app.Post("/beacon/read", beaconH.Read)
 
 	// ─── Studio routes ────────────────────────────────────────────────────────
 	authH      := handlerStudio.NewAuthHandler(authSvc, cfg)
 	dashboardH := handlerStudio.NewDashboardHandler(postSvc, analyticsSvc)
 	postsH     := handlerStudio.NewPostsHandler(postSvc, mediaSvc)
-	metricsH   := handlerStudio.NewMetricsHandler(analyticsSvc)
+	metricsH   := handlerStudio.NewMetricsHandler(analyticsSvc, postSvc)
+	backupsH   := handlerStudio.NewBackupsHandler(backupSvc)
+	transferH  := handlerStudio.NewTransferHandler(transferSvc)
 
 	studio := app.Group("/studio")
 
@@ -133,20 +196,77 @@ func main() {
 	studio.Post("/upload", authMW, postsH.Upload)
 
 	studio.Get("/metrics", authMW, metricsH.Handle)
+	studio.Get("/metrics/posts/:id", authMW, metricsH.Post)
+	studio.Get("/metrics/export", authMW, metricsH.Export)
+	studio.Get("/metrics/live", authMW, metricsH.Live)
 
-	log.Printf("Starting server on :%s (env=%s, csp=%s)", cfg.AppPort, cfg.AppEnv, cfg.CSPMode)
-	log.Fatal(app.Listen(":" + cfg.AppPort))
-}
+	studio.Get("/backups", authMW, backupsH.List)
+	studio.Post("/backups", authMW, backupsH.Create)
+	studio.Get("/backups/:name", authMW, backupsH.Download)
+
+	studio.Get("/transfer", authMW, transferH.Show)
+	studio.Get("/transfer/export", authMW, transferH.Export)
+	studio.Post("/transfer/import", authMW, transferH.Import)
+
+	// Stop on SIGINT/SIGTERM (docker stop); a second signal kills immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("starting server", "port", cfg.AppPort, "env", cfg.AppEnv, "csp", cfg.CSPMode)
+		if err := app.Listen(":" + cfg.AppPort); err != nil {
+			logging.Fatal("server stopped", "error", err)
+		}
+	}()
 
-func errorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Live event streams never finish on their own, so end them first.
+	analyticsSvc.StopLive()
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		slog.Error("shutdown: server", "error", err)
+	}
+	// Requests are done; now drain what they queued.
+	if err := digestSvc.Close(shutdownCtx); err != nil {
+		slog.Error("shutdown: digest", "error", err)
 	}
-	if code == fiber.StatusNotFound {
-		return c.Status(code).Render("public/404", fiber.Map{
-			"Title": "Page not found",
-		}, "layouts/base")
+	if err := backupSvc.Close(shutdownCtx); err != nil {
+		slog.Error("shutdown: backup", "error", err)
 	}
-	return c.Status(code).SendString("Internal Server Error")
+	if publisher != nil {
+		if err := publisher.Close(shutdownCtx); err != nil {
+			slog.Error("shutdown: static site", "error", err)
+		}
+	}
+	if err := analyticsSvc.Close(shutdownCtx); err != nil {
+		slog.Error("shutdown: analytics", "error", err)
+	}
+	rateLimiter.Stop()
+	if err := db.Close(); err != nil {
+		slog.Error("shutdown: database", "error", err)
+	}
+	slog.Info("shutdown complete")
+}
+
+// newViews returns the template engine with the functions the templates use.
+func newViews(cfg *config.Config) *htmlEngine.Engine {
+	engine := htmlEngine.New("./web/templates", ".html")
+	if cfg.IsDevelopment() {
+		engine.Reload(true) // hot-reload templates in dev
+	}
+	// Register template functions
+	engine.AddFunc("safeHTML", func(s string) template.HTML {
+		return template.HTML(s)
+	})
+	engine.AddFunc("inc", func(i int) int { return i + 1 })
+	engine.AddFunc("jsonViews", func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	})
+	return engine
 }
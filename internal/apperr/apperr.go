@@ -0,0 +1,60 @@
+// Package apperr defines the application error returned by services and
+// handlers: an HTTP status, a message that is safe to show to the user and the
+// underlying cause, which is only logged.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error is an error with a status and a user-facing message.
+type Error struct {
+	Status  int    // HTTP status code
+	Message string // shown to the user; never contains internals
+	Err     error  // cause, logged but not shown
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is makes a wrapped sentinel match errors.Is(err, sentinel), so
+// Wrap(cause, ErrNotFound) still reports as ErrNotFound.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == e.Status && t.Message == e.Message
+}
+
+// New returns an error with status and message and no cause.
+func New(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+// Wrap attaches cause to a copy of e, keeping its status and message.
+func Wrap(cause error, e *Error) *Error {
+	return &Error{Status: e.Status, Message: e.Message, Err: cause}
+}
+
+// Common errors for handlers; services declare their own sentinels.
+var (
+	ErrBadRequest = New(http.StatusBadRequest, "The request could not be understood.")
+	ErrForbidden  = New(http.StatusForbidden, "You don't have access to this page.")
+	ErrNotFound   = New(http.StatusNotFound, "The page you're looking for doesn't exist.")
+	ErrInternal   = New(http.StatusInternalServerError, "Something went wrong on our side.")
+)
+
+// From returns err as an *Error. Errors without one in their chain become a
+// 500 with a generic message and err as the cause.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Wrap(err, ErrInternal)
+}
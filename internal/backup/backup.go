@@ -0,0 +1,399 @@
+// Package backup writes and restores archives of the whole blog: a
+// consistent snapshot of the SQLite database and the uploads directory,
+// described by a manifest of SHA-256 checksums.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/database"
+)
+
+// An archive is a gzipped tar holding, in this order, the database snapshot,
+// every upload under "uploads/", and the manifest.
+const (
+	formatVersion = 1
+	databaseName  = "blog.db"
+	uploadsPrefix = "uploads/"
+	manifestName  = "manifest.json"
+
+	namePrefix = "blog-backup-"
+	nameSuffix = ".tar.gz"
+	timeLayout = "20060102T150405Z"
+)
+
+// ErrInvalid is returned, wrapped, for archives that are damaged, incomplete
+// or were not written by this package.
+var ErrInvalid = errors.New("backup: invalid archive")
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	Migrations []string  `json:"migrations"` // schema_migrations of the snapshot
+	Files      []File    `json:"files"`
+}
+
+// File is one entry of an archive.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is a backup file in the backup directory.
+type Archive struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// Create snapshots db with VACUUM INTO, which is safe while the server keeps
+// reading and writing, and writes it with the files of uploadDir to a new
+// archive in dir named after now. The archive only appears under its final
+// name once complete.
+func Create(ctx context.Context, db *database.DB, uploadDir, dir string, now time.Time) (*Archive, error) {
+	name := namePrefix + now.UTC().Format(timeLayout) + nameSuffix
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		return nil, fmt.Errorf("backup: %s already exists", name)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp(dir, ".snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapshot := filepath.Join(tmp, databaseName)
+	if err := vacuumInto(ctx, db, snapshot); err != nil {
+		return nil, fmt.Errorf("backup: snapshot database: %w", err)
+	}
+	migrations, err := database.AppliedMigrations(ctx, db.Read)
+	if err != nil {
+		return nil, fmt.Errorf("backup: read migrations: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, ".archive-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	defer f.Close()
+
+	m := &Manifest{Version: formatVersion, CreatedAt: now.UTC(), Migrations: migrations}
+	if err := write(f, m, snapshot, uploadDir); err != nil {
+		return nil, fmt.Errorf("backup: write archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), dest); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{Name: name, Size: info.Size(), CreatedAt: m.CreatedAt}, nil
+}
+
+// vacuumInto writes a compacted copy of db to dest from a read connection,
+// so writers are not held up. VACUUM INTO counts as a write for query_only,
+// so the connection allows it for this statement only.
+func vacuumInto(ctx context.Context, db *database.DB, dest string) error {
+	if db.Read == db.Write {
+		_, err := db.Write.ExecContext(ctx, `VACUUM INTO ?`, dest)
+		return err
+	}
+	conn, err := db.Read.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA query_only(0)`); err != nil {
+		return err
+	}
+	// Not bound to ctx: the connection must be read-only again before it
+	// goes back to the pool. If it can't be, the pool closes it instead.
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `PRAGMA query_only(1)`); err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+	_, err = conn.ExecContext(ctx, `VACUUM INTO ?`, dest)
+	return err
+}
+
+func write(w io.Writer, m *Manifest, snapshot, uploadDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	add := func(name, src string) error {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o640, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(tw, h), f)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, File{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))})
+		return nil
+	}
+
+	if err := add(databaseName, snapshot); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(uploadDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == uploadDir && errors.Is(err, fs.ErrNotExist) {
+				return nil // nothing uploaded yet
+			}
+			return err
+		}
+		// Skip hidden entries.
+		if p != uploadDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(uploadDir, p)
+		if err != nil {
+			return err
+		}
+		return add(uploadsPrefix+filepath.ToSlash(rel), p)
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o640, Size: int64(len(b)), ModTime: m.CreatedAt, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Verify reads the whole archive at path and checks every file against the
+// manifest.
+func Verify(path string) (*Manifest, error) {
+	return read(path, func(string) (io.WriteCloser, error) { return discard{}, nil })
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+func (discard) Close() error                { return nil }
+
+// read streams the archive at src, handing each file to the writer returned
+// by place, and returns the manifest once every file matched it. Written
+// files are only trustworthy if read succeeds.
+func read(src string, place func(name string) (io.WriteCloser, error)) (*Manifest, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	tr := tar.NewReader(gz)
+
+	seen := make(map[string]File)
+	var m *Manifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if m != nil {
+			return nil, fmt.Errorf("%w: %s follows the manifest", ErrInvalid, hdr.Name)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: %s is not a regular file", ErrInvalid, hdr.Name)
+		}
+		if hdr.Name == manifestName {
+			m = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, fmt.Errorf("%w: manifest: %v", ErrInvalid, err)
+			}
+			continue
+		}
+		if !validName(hdr.Name) {
+			return nil, fmt.Errorf("%w: unexpected file %q", ErrInvalid, hdr.Name)
+		}
+		if _, dup := seen[hdr.Name]; dup {
+			return nil, fmt.Errorf("%w: %s appears twice", ErrInvalid, hdr.Name)
+		}
+
+		w, err := place(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(w, h), tr)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		seen[hdr.Name] = File{Path: hdr.Name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("%w: no manifest", ErrInvalid)
+	}
+	if m.Version != formatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalid, m.Version)
+	}
+	if _, ok := seen[databaseName]; !ok {
+		return nil, fmt.Errorf("%w: no database snapshot", ErrInvalid)
+	}
+	for _, want := range m.Files {
+		got, ok := seen[want.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrInvalid, want.Path)
+		}
+		if got != want {
+			return nil, fmt.Errorf("%w: %s does not match its checksum", ErrInvalid, want.Path)
+		}
+		delete(seen, want.Path)
+	}
+	for name := range seen {
+		return nil, fmt.Errorf("%w: %s is not in the manifest", ErrInvalid, name)
+	}
+	return m, nil
+}
+
+// validName accepts the database and relative paths below uploads/ that
+// cannot escape it.
+func validName(name string) bool {
+	if name == databaseName {
+		return true
+	}
+	rel, ok := strings.CutPrefix(name, uploadsPrefix)
+	return ok && filepath.IsLocal(rel) && path.Clean(rel) == rel
+}
+
+// List returns the archives in dir, newest first.
+func List(dir string) ([]Archive, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var archives []Archive
+	for _, e := range entries {
+		created, ok := parseName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, Archive{Name: e.Name(), Size: info.Size(), CreatedAt: created})
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].CreatedAt.After(archives[j].CreatedAt) })
+	return archives, nil
+}
+
+// Prune deletes all but the keep newest archives in dir and returns the
+// names it deleted. keep <= 0 keeps everything.
+func Prune(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	archives, err := List(dir)
+	if err != nil || len(archives) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, a := range archives[keep:] {
+		if err := os.Remove(filepath.Join(dir, a.Name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, a.Name)
+	}
+	return removed, nil
+}
+
+// Path returns the path of the archive called name in dir, or
+// fs.ErrNotExist if there is none. Names are checked, so it is safe to call
+// with user input.
+func Path(dir, name string) (string, error) {
+	if _, ok := parseName(name); !ok {
+		return "", fs.ErrNotExist
+	}
+	p := filepath.Join(dir, name)
+	if _, err := os.Stat(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+func parseName(name string) (time.Time, bool) {
+	ts, ok := strings.CutPrefix(name, namePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	if ts, ok = strings.CutSuffix(ts, nameSuffix); !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeLayout, ts)
+	return t, err == nil
+}
@@ -0,0 +1,216 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/database"
+)
+
+// Restore replaces the database at dbPath and the content of uploadDir with
+// the archive at src. The server must not be running.
+//
+// Everything is extracted next to the database and checked first: the
+// checksums, SQLite's integrity check, and that this build knows every
+// migration of the snapshot. Only then are the current files moved aside,
+// to dbPath.pre-restore-<time> and uploads.pre-restore-<time> beside it, and
+// the restored ones moved in. The moved-aside files are left for the
+// operator to delete once the restored blog looks right. None of this is
+// kept in uploadDir, which is served to readers.
+//
+// If a move fails, the ones made so far are undone, leaving the blog as it
+// was. Should undoing fail too, the error names where the current files are.
+func Restore(ctx context.Context, src, dbPath, uploadDir string, now time.Time) (*Manifest, error) {
+	stamp := now.UTC().Format(timeLayout)
+	stagedDB := dbPath + ".restore-" + stamp
+	stagedUploads := filepath.Join(filepath.Dir(dbPath), "uploads.restore-"+stamp)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(stagedUploads, 0o755); err != nil {
+		return nil, err
+	}
+	defer os.Remove(stagedDB) // no-op once moved in
+	defer os.RemoveAll(stagedUploads)
+
+	m, err := read(src, func(name string) (io.WriteCloser, error) {
+		if name == databaseName {
+			return os.OpenFile(stagedDB, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+		}
+		dest := filepath.Join(stagedUploads, filepath.FromSlash(strings.TrimPrefix(name, uploadsPrefix)))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return nil, err
+		}
+		return os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSnapshot(ctx, stagedDB, m); err != nil {
+		return nil, err
+	}
+
+	asideDB := dbPath + ".pre-restore-" + stamp
+	asideUploads := filepath.Join(filepath.Dir(dbPath), "uploads.pre-restore-"+stamp)
+	// undo holds the inverse of each move made, to run latest first.
+	var undo []func() error
+	fail := func(err error) (*Manifest, error) {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				return nil, fmt.Errorf("%w; undoing the restore also failed (%v): the current database is at %s and its uploads in %s",
+					err, uerr, asideDB, asideUploads)
+			}
+		}
+		return nil, err
+	}
+
+	// Swap the database, keeping the WAL and shared-memory files of the
+	// current one with it.
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.Rename(dbPath+suffix, asideDB+suffix)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fail(fmt.Errorf("backup: move current database aside: %w", err))
+		}
+		undo = append(undo, func() error { return os.Rename(asideDB+suffix, dbPath+suffix) })
+	}
+	if err := os.Rename(stagedDB, dbPath); err != nil {
+		return fail(fmt.Errorf("backup: move restored database in: %w", err))
+	}
+	undo = append(undo, func() error { return os.Rename(dbPath, stagedDB) })
+
+	// uploadDir itself is often a mount point, so swap its entries rather
+	// than the directory. A move of entries that fails part way is undone
+	// too, so its undo is added first.
+	if err := os.Mkdir(asideUploads, 0o755); err != nil {
+		return fail(fmt.Errorf("backup: move current uploads aside: %w", err))
+	}
+	undo = append(undo, func() error {
+		if err := moveEntries(asideUploads, uploadDir); err != nil {
+			return err
+		}
+		return os.Remove(asideUploads)
+	})
+	if err := moveEntries(uploadDir, asideUploads); err != nil {
+		return fail(fmt.Errorf("backup: move current uploads aside: %w", err))
+	}
+	undo = append(undo, func() error { return moveEntries(uploadDir, stagedUploads) })
+	if err := moveEntries(stagedUploads, uploadDir); err != nil {
+		return fail(fmt.Errorf("backup: move restored uploads in: %w", err))
+	}
+	os.Remove(asideUploads) // only succeeds if there were no uploads
+	return m, nil
+}
+
+// checkSnapshot opens the extracted database and checks it is intact and
+// matches the manifest.
+func checkSnapshot(ctx context.Context, path string, m *Manifest) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("%w: integrity check: %v", ErrInvalid, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check: %s", ErrInvalid, result)
+	}
+
+	applied, err := database.AppliedMigrations(ctx, db)
+	if err != nil {
+		return fmt.Errorf("%w: read migrations: %v", ErrInvalid, err)
+	}
+	if !slices.Equal(applied, m.Migrations) {
+		return fmt.Errorf("%w: migrations differ from the manifest", ErrInvalid)
+	}
+	known := database.Migrations()
+	for _, v := range applied {
+		if !slices.Contains(known, v) {
+			return fmt.Errorf("backup: archive was made by a newer version (unknown migration %s)", v)
+		}
+	}
+	return nil
+}
+
+// moveEntries moves the visible entries of from into to, creating to. An
+// entry is copied and then removed if the two are on different filesystems,
+// as when uploadDir is a mount of its own.
+func moveEntries(from, to string) error {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(to, 0o755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		src, dst := filepath.Join(from, e.Name()), filepath.Join(to, e.Name())
+		err := os.Rename(src, dst)
+		if errors.Is(err, syscall.EXDEV) {
+			if err = copyTree(src, dst); err == nil {
+				err = os.RemoveAll(src)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies the file or directory src to dst, which must not exist.
+// Only directories and regular files are copied, as in an archive.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, 0o755)
+		case d.Type().IsRegular():
+			return copyFile(p, target)
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/mhtecdev/blog-ai/internal/logging"
 )
 
 type Config struct {
@@ -19,8 +23,47 @@ type Config struct {
 	RateLimitLogin  int           // max login attempts per window
 	RateLimitWindow time.Duration // rolling window duration
 	CSPMode         string        // "strict" or "lenient"
+	LogFormat       string        // "json" or "text"
+	LogLevel        string        // debug, info, warn or error
+	ShutdownTimeout time.Duration // how long in-flight requests and queued events get on shutdown
+	RequestTimeout  time.Duration // deadline for the database work of one request
+	DBMaintenance   time.Duration // how often PRAGMA optimize and a WAL checkpoint run (0 disables)
+	PageCacheSize   int           // rendered public pages kept in memory (0 disables the cache)
+	PostsPerPage    int           // posts on each page of the public lists (0 lists every post on one page)
+	CodeTheme       string        // Chroma style highlighting code under the light theme
+	CodeThemeDark   string        // Chroma style highlighting code under the dark theme
+
+	BackupDir      string        // where backup archives are written
+	BackupInterval time.Duration // how often a backup is taken (0 disables scheduled backups)
+	BackupKeep     int           // scheduled and studio backups beyond this many are deleted, oldest first
+
+	StaticDir string // where the server keeps a static build of the public site (empty disables)
+
+	AnalyticsDedupWindow    time.Duration // repeat views by the same visitor within this window count once
+	AnalyticsRollupInterval time.Duration // how often raw page views are aggregated into daily rollups
+	AnalyticsRetention      time.Duration // raw page views older than this are purged (0 keeps them forever)
+
+	MetricsToken    string   // bearer token for /metrics
+	MetricsAllowIPs []string // IPs or CIDRs allowed to scrape /metrics without a token
+
+	SiteURL string // public base URL, e.g. "https://blog.example.com"; used for absolute links in emails
+
+	Mailer       string // "file" writes .eml files to MailDir, "smtp" sends through SMTPHost
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	DigestEnabled bool         // send the weekly analytics digest
+	DigestTo      []string     // digest recipients
+	DigestWeekday time.Weekday // day the digest is sent (UTC)
+	DigestHour    int          // hour of DigestWeekday the digest is sent (UTC)
 }
 
+// Load reads the configuration from the environment and installs the
+// process-wide logger it describes.
 func Load() *Config {
 	cfg := &Config{
 		AppEnv:          getEnv("APP_ENV", "development"),
@@ -34,22 +77,81 @@ func Load() *Config {
 		RateLimitLogin:  getEnvInt("RATE_LIMIT_LOGIN", 5),
 		RateLimitWindow: getEnvDuration("RATE_LIMIT_WINDOW", 15*time.Minute),
 		CSPMode:         getEnv("CSP_MODE", "lenient"),
+		LogFormat:       getEnv("LOG_FORMAT", "json"),
+		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		RequestTimeout:  getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+		DBMaintenance:   getEnvDuration("DB_MAINTENANCE_INTERVAL", time.Hour),
+		PageCacheSize:   getEnvInt("PAGE_CACHE_SIZE", 500),
+		PostsPerPage:    getEnvInt("POSTS_PER_PAGE", 10),
+		CodeTheme:       getEnv("CODE_THEME", "github"),
+		CodeThemeDark:   getEnv("CODE_THEME_DARK", "github-dark"),
+
+		BackupDir:      getEnv("BACKUP_DIR", "./data/backups"),
+		BackupInterval: getEnvDuration("BACKUP_INTERVAL", 24*time.Hour),
+		BackupKeep:     getEnvInt("BACKUP_KEEP", 7),
+
+		StaticDir: getEnv("STATIC_DIR", ""),
+
+		AnalyticsDedupWindow:    getEnvDuration("ANALYTICS_DEDUP_WINDOW", 30*time.Minute),
+		AnalyticsRollupInterval: getEnvDuration("ANALYTICS_ROLLUP_INTERVAL", time.Hour),
+		AnalyticsRetention:      getEnvDuration("ANALYTICS_RETENTION", 90*24*time.Hour),
+
+		MetricsToken:    getEnv("METRICS_TOKEN", ""),
+		MetricsAllowIPs: getEnvList("METRICS_ALLOW_IPS"),
+
+		SiteURL: strings.TrimRight(getEnv("SITE_URL", ""), "/"),
+
+		Mailer:       getEnv("MAILER", "file"),
+		MailFrom:     getEnv("MAIL_FROM", "blog@localhost"),
+		MailDir:      getEnv("MAIL_DIR", "./data/mail"),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		DigestEnabled: getEnvBool("DIGEST_ENABLED", false),
+		DigestTo:      getEnvList("DIGEST_TO"),
+		DigestWeekday: getEnvWeekday("DIGEST_WEEKDAY", time.Monday),
+		DigestHour:    getEnvInt("DIGEST_HOUR", 8),
+	}
+
+	// Configure logging first so the warnings below use the chosen format.
+	logging.Setup(cfg.LogFormat, cfg.LogLevel)
+
+	if cfg.DigestEnabled && len(cfg.DigestTo) == 0 {
+		slog.Warn("DIGEST_ENABLED is set but DIGEST_TO is empty — digest disabled")
+		cfg.DigestEnabled = false
+	}
+
+	if _, ok := styles.Registry[cfg.CodeTheme]; !ok {
+		slog.Warn("CODE_THEME is not a Chroma style — using github", "theme", cfg.CodeTheme)
+		cfg.CodeTheme = "github"
+	}
+	if _, ok := styles.Registry[cfg.CodeThemeDark]; !ok {
+		slog.Warn("CODE_THEME_DARK is not a Chroma style — using github-dark", "theme", cfg.CodeThemeDark)
+		cfg.CodeThemeDark = "github-dark"
+	}
+
+	if cfg.StaticDir != "" && cfg.SiteURL == "" {
+		slog.Warn("STATIC_DIR is set but SITE_URL is empty — static site disabled")
+		cfg.StaticDir = ""
 	}
 
 	if cfg.AppEnv == "production" {
 		if cfg.AppSecret == "" {
-			log.Fatal("APP_SECRET must be set in production")
+			logging.Fatal("APP_SECRET must be set in production")
 		}
 		if cfg.IPHashSecret == "" {
-			log.Fatal("IP_HASH_SECRET must be set in production")
+			logging.Fatal("IP_HASH_SECRET must be set in production")
 		}
 	} else {
 		if cfg.AppSecret == "" {
-			log.Println("WARNING: APP_SECRET not set — using insecure development default")
+			slog.Warn("APP_SECRET not set — using insecure development default")
 			cfg.AppSecret = "dev-secret-key-32-bytes-xxxxxxxx"
 		}
 		if cfg.IPHashSecret == "" {
-			log.Println("WARNING: IP_HASH_SECRET not set — using insecure development default")
+			slog.Warn("IP_HASH_SECRET not set — using insecure development default")
 			cfg.IPHashSecret = "dev-ip-hash-secret-placeholder"
 		}
 	}
@@ -85,3 +187,33 @@ func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func getEnvWeekday(key string, fallback time.Weekday) time.Weekday {
+	v := strings.ToLower(os.Getenv(key))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if v == strings.ToLower(d.String()) {
+			return d
+		}
+	}
+	return fallback
+}
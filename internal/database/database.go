@@ -1,12 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/logging"
 
 	_ "modernc.org/sqlite"
 )
@@ -14,45 +22,237 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-func Open(dbPath string) *sql.DB {
+// DB holds the two connection pools of the SQLite database. SQLite allows a
+// single writer at a time but, in WAL mode, any number of concurrent readers,
+// so reads get their own pool instead of queueing behind analytics inserts.
+type DB struct {
+	Write *sql.DB // one connection; every INSERT/UPDATE/DELETE and transaction
+	Read  *sql.DB // query_only connections for SELECTs
+
+	stop     chan struct{}
+	done     chan struct{} // closed when the maintenance loop returns; nil if not started
+	stopOnce sync.Once
+}
+
+// connPragmas apply to every connection of both pools. synchronous=NORMAL is
+// durable across application crashes in WAL mode; only an OS crash or power
+// loss can roll back the last transactions.
+var connPragmas = []string{
+	"journal_mode(WAL)",
+	"foreign_keys(1)",
+	"busy_timeout(5000)",
+	"synchronous(NORMAL)",
+	"cache_size(-16000)", // KiB, i.e. 16 MB per connection
+	"temp_store(MEMORY)",
+	"mmap_size(268435456)", // 256 MB
+}
+
+// maxReadConns caps the read pool; SQLite readers scale with cores.
+var maxReadConns = max(4, runtime.NumCPU())
+
+// Open opens the write and read pools for the database at dbPath. An
+// in-memory database exists per connection, so ":memory:" gets a single
+// shared pool for both.
+func Open(dbPath string) *DB {
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
-		log.Fatalf("database: failed to create data directory: %v", err)
+		logging.Fatal("database: failed to create data directory", "error", err)
+	}
+
+	// Write transactions start IMMEDIATE so they take the write lock up
+	// front instead of failing with SQLITE_BUSY when upgrading from a read.
+	write := openPool(dbPath, url.Values{"_txlock": {"immediate"}})
+	write.SetMaxOpenConns(1)
+	write.SetMaxIdleConns(1)
+	db := &DB{Write: write, Read: write, stop: make(chan struct{})}
+
+	if !strings.HasPrefix(dbPath, ":memory:") {
+		read := openPool(dbPath, url.Values{"_pragma": {"query_only(1)"}})
+		read.SetMaxOpenConns(maxReadConns)
+		read.SetMaxIdleConns(maxReadConns)
+		read.SetConnMaxIdleTime(5 * time.Minute)
+		db.Read = read
 	}
+	return db
+}
 
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000")
+func openPool(dbPath string, params url.Values) *sql.DB {
+	// modernc.org/sqlite takes pragmas as _pragma=name(value); it silently
+	// ignores the _journal_mode/_foreign_keys style of other drivers.
+	for _, p := range connPragmas {
+		params.Add("_pragma", p)
+	}
+	db, err := sql.Open("sqlite", dbPath+"?"+params.Encode())
 	if err != nil {
-		log.Fatalf("database: failed to open: %v", err)
+		logging.Fatal("database: failed to open", "error", err)
+	}
+	if err := db.Ping(); err != nil {
+		logging.Fatal("database: failed to ping", "error", err)
 	}
+	return db
+}
 
-	db.SetMaxOpenConns(1) // SQLite supports one writer at a time
-	db.SetMaxIdleConns(1)
+// StartMaintenance runs PRAGMA optimize and a passive WAL checkpoint every
+// interval until Close, keeping query plans fresh and the WAL from growing
+// while readers are constantly active.
+func (db *DB) StartMaintenance(interval time.Duration) {
+	if interval <= 0 || db.done != nil {
+		return
+	}
+	db.done = make(chan struct{})
+	go func() {
+		defer close(db.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				db.maintain()
+			case <-db.stop:
+				return
+			}
+		}
+	}()
+}
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("database: failed to ping: %v", err)
+func (db *DB) maintain() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := db.Write.ExecContext(ctx, `PRAGMA optimize`); err != nil {
+		slog.Warn("database: optimize failed", "error", err)
+	}
+	if _, err := db.Write.ExecContext(ctx, `PRAGMA wal_checkpoint(PASSIVE)`); err != nil {
+		slog.Warn("database: WAL checkpoint failed", "error", err)
 	}
+}
 
-	return db
+// Close stops the maintenance loop, checkpoints the WAL into the main
+// database file and closes both pools, so the data directory is
+// self-contained once the process exits.
+func (db *DB) Close() error {
+	db.stopOnce.Do(func() { close(db.stop) })
+	if db.done != nil {
+		<-db.done
+	}
+	if db.Read != db.Write {
+		// Readers hold WAL frames; close them first so TRUNCATE can finish.
+		db.Read.Close()
+	}
+	if _, err := db.Write.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		slog.Warn("database: WAL checkpoint failed", "error", err)
+	}
+	return db.Write.Close()
 }
 
-func RunMigrations(db *sql.DB) {
+// RunMigrations applies every embedded migration that isn't yet recorded in
+// schema_migrations, each in its own transaction. Files are applied in name order.
+func RunMigrations(db *DB) {
+	if _, err := db.Write.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT     PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+	)`); err != nil {
+		logging.Fatal("database: failed to create schema_migrations", "error", err)
+	}
+
 	entries, err := migrationsFS.ReadDir("migrations")
 	if err != nil {
-		log.Fatalf("database: failed to read migrations dir: %v", err)
+		logging.Fatal("database: failed to read migrations dir", "error", err)
 	}
 
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
+
+		var applied bool
+		if err := db.Write.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = ?)`, entry.Name()).Scan(&applied); err != nil {
+			logging.Fatal("database: failed to check migration", "migration", entry.Name(), "error", err)
+		}
+		if applied {
+			continue
+		}
+
 		path := fmt.Sprintf("migrations/%s", entry.Name())
 		content, err := migrationsFS.ReadFile(path)
 		if err != nil {
-			log.Fatalf("database: failed to read migration %s: %v", entry.Name(), err)
+			logging.Fatal("database: failed to read migration", "migration", entry.Name(), "error", err)
+		}
+
+		if err := applyMigration(db.Write, entry.Name(), string(content)); err != nil {
+			logging.Fatal("database: failed to run migration", "migration", entry.Name(), "error", err)
 		}
+		slog.Info("database: applied migration", "migration", entry.Name())
+	}
+}
+
+// PendingMigrations lists embedded migrations not yet recorded in
+// schema_migrations.
+func PendingMigrations(ctx context.Context, db *DB) ([]string, error) {
+	versions, err := AppliedMigrations(ctx, db.Read)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
 
-		if _, err := db.Exec(string(content)); err != nil {
-			log.Fatalf("database: failed to run migration %s: %v", entry.Name(), err)
+	var pending []string
+	for _, name := range Migrations() {
+		if !applied[name] {
+			pending = append(pending, name)
 		}
-		log.Printf("database: applied migration %s", entry.Name())
 	}
+	return pending, nil
+}
+
+// Migrations lists the migrations embedded in this build, in the order they
+// are applied.
+func Migrations() []string {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		panic(err) // the directory is embedded at build time
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// AppliedMigrations lists the versions recorded in the schema_migrations
+// table of db, which need not be the server's own database.
+func AppliedMigrations(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func applyMigration(db *sql.DB, version, content string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(content); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
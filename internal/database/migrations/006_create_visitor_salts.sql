@@ -0,0 +1,6 @@
+-- One random salt per UTC day for visitor hashing. Old salts are deleted as
+-- soon as the day rolls over, so hashes can't be linked across days.
+CREATE TABLE IF NOT EXISTS visitor_salts (
+    day  TEXT PRIMARY KEY,
+    salt TEXT NOT NULL
+);
@@ -0,0 +1,7 @@
+ALTER TABLE page_views ADD COLUMN referrer_domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE page_views ADD COLUMN channel         TEXT NOT NULL DEFAULT 'direct';
+ALTER TABLE page_views ADD COLUMN utm_source      TEXT NOT NULL DEFAULT '';
+ALTER TABLE page_views ADD COLUMN utm_medium      TEXT NOT NULL DEFAULT '';
+ALTER TABLE page_views ADD COLUMN utm_campaign    TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_pv_post_channel ON page_views(post_id, channel);
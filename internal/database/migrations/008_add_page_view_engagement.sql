@@ -0,0 +1,6 @@
+-- view_token ties reading beacons to the view that served the page.
+ALTER TABLE page_views ADD COLUMN view_token      TEXT    NOT NULL DEFAULT '';
+ALTER TABLE page_views ADD COLUMN max_depth       INTEGER NOT NULL DEFAULT 0; -- 0, 25, 50, 75 or 100 (%)
+ALTER TABLE page_views ADD COLUMN engaged_seconds INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_pv_view_token ON page_views(view_token) WHERE view_token != '';
@@ -0,0 +1,28 @@
+-- Daily aggregates of page_views. Dashboards read these plus the raw rows for
+-- days that haven't been rolled up yet; raw rows past the retention period
+-- are purged once their day is rolled up.
+CREATE TABLE IF NOT EXISTS page_view_daily (
+    day        TEXT    NOT NULL, -- "2006-01-02" (UTC)
+    post_id    INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    views      INTEGER NOT NULL DEFAULT 0,
+    visitors   INTEGER NOT NULL DEFAULT 0, -- distinct daily visitor hashes
+    reached25  INTEGER NOT NULL DEFAULT 0,
+    reached50  INTEGER NOT NULL DEFAULT 0,
+    reached75  INTEGER NOT NULL DEFAULT 0,
+    reached100 INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pvd_post ON page_view_daily(post_id, day);
+
+CREATE TABLE IF NOT EXISTS page_view_daily_sources (
+    day             TEXT    NOT NULL,
+    post_id         INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    channel         TEXT    NOT NULL,
+    referrer_domain TEXT    NOT NULL,
+    utm_source      TEXT    NOT NULL,
+    utm_medium      TEXT    NOT NULL,
+    utm_campaign    TEXT    NOT NULL,
+    views           INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, post_id, channel, referrer_domain, utm_source, utm_medium, utm_campaign)
+);
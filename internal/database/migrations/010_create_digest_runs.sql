@@ -0,0 +1,6 @@
+-- One row per digest period that was sent, so a restart in the middle of the
+-- schedule window doesn't send the same weekly report twice.
+CREATE TABLE IF NOT EXISTS digest_runs (
+    period  TEXT PRIMARY KEY,
+    sent_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+);
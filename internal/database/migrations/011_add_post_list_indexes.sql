@@ -0,0 +1,10 @@
+-- Post lists are paged by (sort key, id) within a status or category; these
+-- indexes let the default order, newest published first, seek to a page.
+--
+-- They also serve the timeline and the year and month archives, in place of
+-- 001's idx_posts_published: that one keys on published_at alone, so a
+-- query for published posts in a date range would still filter every draft
+-- and sort ties on id. Keying on status first and on the COALESCE'd date
+-- (unpublished posts as '') lets one seek cover the range in page order.
+CREATE INDEX IF NOT EXISTS idx_posts_status_published   ON posts(status, COALESCE(published_at, ''), id);
+CREATE INDEX IF NOT EXISTS idx_posts_category_published ON posts(category, status, COALESCE(published_at, ''), id);
@@ -0,0 +1,4 @@
+-- Word count and estimated reading time, computed from content_md whenever a
+-- post is saved. Posts saved before this migration are counted at startup.
+ALTER TABLE posts ADD COLUMN word_count      INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN reading_minutes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- The table of contents extracted from content_md's headings, as JSON, and
+-- the author's choice to hide it. render_version records which version of
+-- the Markdown pipeline produced content_html and toc; posts rendered by an
+-- older one are rendered again at startup.
+ALTER TABLE posts ADD COLUMN toc            TEXT    NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN hide_toc       INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN render_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,173 @@
+// Package diagram draws Mermaid diagrams as SVG on the server, so post pages
+// show them without a script and under a strict CSP.
+//
+// It reads the parts of Mermaid's syntax study notes use — flowcharts and
+// sequence diagrams — and lays them out simply: flowchart nodes in ranks
+// along the graph's direction, sequence participants in columns. Styling
+// directives (classDef, style, linkStyle, click) are ignored. Other diagram
+// types, and lines it can't read, make Render report false, and the source
+// is shown instead.
+package diagram
+
+import (
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Render returns src, a Mermaid diagram, as an SVG element. It reports false
+// for diagram types and syntax it doesn't handle.
+func Render(src string) (string, bool) {
+	lines := statements(src)
+	if len(lines) == 0 {
+		return "", false
+	}
+	// The first statement names the diagram type; more may follow it on
+	// the same line, as in "graph TD; A-->B".
+	first, rest, _ := strings.Cut(lines[0], ";")
+	if rest = strings.TrimSpace(rest); rest != "" {
+		lines = append([]string{first, rest}, lines[1:]...)
+	}
+	head := strings.Fields(first)
+	switch head[0] {
+	case "graph", "flowchart":
+		return renderFlowchart(head[1:], lines[1:])
+	case "sequenceDiagram":
+		return renderSequence(lines[1:])
+	}
+	return "", false
+}
+
+// statements returns the non-blank lines of src, without %% comments.
+func statements(src string) []string {
+	var out []string
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "%%") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+const (
+	fontSize   = 14
+	lineHeight = 18
+	margin     = 8
+)
+
+// textSize estimates the size lines of text take at fontSize in a sans-serif
+// font; there's no font to measure on the server.
+func textSize(lines []string) (w, h float64) {
+	for _, l := range lines {
+		var lw float64
+		for _, r := range l {
+			switch {
+			case strings.ContainsRune("il.,:;'|!()[] ", r):
+				lw += 4
+			case strings.ContainsRune("mwMW", r):
+				lw += 12
+			case r >= 'A' && r <= 'Z':
+				lw += 9.5
+			default:
+				lw += 7.8
+			}
+		}
+		w = math.Max(w, lw)
+	}
+	return w, float64(len(lines)) * lineHeight
+}
+
+// labelLines splits a label on the <br> line breaks Mermaid allows and
+// removes the quotes around it.
+func labelLines(s string) []string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for _, br := range []string{"<br />", "<br/>", "<BR>"} {
+		s = strings.ReplaceAll(s, br, "<br>")
+	}
+	lines := strings.Split(s, "<br>")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
+
+type point struct{ x, y float64 }
+
+// canvas builds the elements of an SVG. Shapes get presentation attributes
+// that look right without a stylesheet; public.css themes them.
+type canvas struct{ b strings.Builder }
+
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
+
+func (c *canvas) rect(class string, x, y, w, h, r float64) {
+	c.b.WriteString(`<rect class="` + class + `" x="` + num(x) + `" y="` + num(y) + `" width="` + num(w) + `" height="` + num(h) + `"`)
+	if r > 0 {
+		c.b.WriteString(` rx="` + num(r) + `"`)
+	}
+	c.b.WriteString(` fill="none" stroke="currentColor"></rect>`)
+}
+
+func (c *canvas) circle(class string, cx, cy, r float64) {
+	c.b.WriteString(`<circle class="` + class + `" cx="` + num(cx) + `" cy="` + num(cy) + `" r="` + num(r) + `" fill="none" stroke="currentColor"></circle>`)
+}
+
+func pointList(pts []point) string {
+	s := make([]string, len(pts))
+	for i, p := range pts {
+		s[i] = num(p.x) + "," + num(p.y)
+	}
+	return strings.Join(s, " ")
+}
+
+func (c *canvas) polygon(class string, pts ...point) {
+	c.b.WriteString(`<polygon class="` + class + `" points="` + pointList(pts) + `" fill="none" stroke="currentColor"></polygon>`)
+}
+
+// polyline draws a line through pts, dashed if the class says so.
+func (c *canvas) polyline(class string, pts ...point) {
+	c.b.WriteString(`<polyline class="` + class + `" points="` + pointList(pts) + `" fill="none" stroke="currentColor"`)
+	if strings.Contains(class, "dashed") || strings.Contains(class, "dotted") {
+		c.b.WriteString(` stroke-dasharray="4 3"`)
+	}
+	c.b.WriteString(`></polyline>`)
+}
+
+// arrowhead draws an arrowhead at to, pointing away from from.
+func (c *canvas) arrowhead(from, to point) {
+	dx, dy := to.x-from.x, to.y-from.y
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return
+	}
+	ux, uy := dx/l, dy/l
+	const length, half = 9, 4
+	base := point{to.x - ux*length, to.y - uy*length}
+	c.b.WriteString(`<polygon class="arrowhead" points="` + pointList([]point{
+		to, {base.x - uy*half, base.y + ux*half}, {base.x + uy*half, base.y - ux*half},
+	}) + `" fill="currentColor"></polygon>`)
+}
+
+// text centres lines on (x, y), or starts them at x if anchor is "start".
+func (c *canvas) text(class string, x, y float64, anchor string, lines []string) {
+	c.b.WriteString(`<text class="` + class + `" text-anchor="` + anchor + `" dominant-baseline="central" font-size="` + num(fontSize) + `" fill="currentColor">`)
+	y0 := y - float64(len(lines)-1)*lineHeight/2
+	for i, l := range lines {
+		c.b.WriteString(`<tspan x="` + num(x) + `" y="` + num(y0+float64(i)*lineHeight) + `">` + html.EscapeString(l) + `</tspan>`)
+	}
+	c.b.WriteString(`</text>`)
+}
+
+// svg wraps body in the root element of a diagram of the given size.
+func svg(label string, w, h float64, body string) string {
+	w, h = math.Ceil(w+2*margin), math.Ceil(h+2*margin)
+	return `<svg class="diagram" viewBox="` + num(-margin) + ` ` + num(-margin) + ` ` + num(w) + ` ` + num(h) +
+		`" width="` + num(w) + `" height="` + num(h) + `" role="img" aria-label="` + label + `">` + body + `</svg>`
+}
@@ -0,0 +1,520 @@
+package diagram
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type fnode struct {
+	id    string
+	shape string
+	lines []string
+	w, h  float64
+	rank  int
+	order float64
+	x, y  float64 // centre
+}
+
+type fedge struct {
+	from, to *fnode
+	lines    []string // label, if any
+	style    string   // "solid", "dotted" or "thick"
+	head     bool     // arrowhead at to
+	tail     bool     // arrowhead at from
+	back     bool     // closes a cycle, so it doesn't rank its target
+}
+
+type flowchart struct {
+	nodes []*fnode
+	byID  map[string]*fnode
+	edges []*fedge
+}
+
+// ignoredFlowchart are statements that only style a flowchart or group its
+// nodes, which are drawn without them.
+var ignoredFlowchart = []string{"classDef ", "class ", "style ", "linkStyle ", "click ", "subgraph ", "direction "}
+
+func renderFlowchart(head []string, lines []string) (string, bool) {
+	dir := "TD"
+	if len(head) > 0 {
+		dir = strings.ToUpper(head[0])
+	}
+	switch dir {
+	case "TD", "TB", "BT", "LR", "RL":
+	default:
+		return "", false
+	}
+
+	fc := &flowchart{byID: map[string]*fnode{}}
+	for _, line := range lines {
+		for _, stmt := range splitStatements(line) {
+			if stmt == "end" || hasAnyPrefix(stmt, ignoredFlowchart) {
+				continue
+			}
+			if !fc.parseStatement(stmt) {
+				return "", false
+			}
+		}
+	}
+	if len(fc.nodes) == 0 {
+		return "", false
+	}
+	w, h := fc.layout(dir)
+	return svg("Flowchart", w, h, fc.draw()), true
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitStatements splits a line on the semicolons outside labels.
+func splitStatements(line string) []string {
+	var out []string
+	depth, quoted, start := 0, false, 0
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case strings.ContainsRune("[({", r):
+			depth++
+		case strings.ContainsRune("])}", r):
+			depth--
+		case r == ';' && depth == 0:
+			out = append(out, strings.TrimSpace(line[start:i]))
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(line[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// shapes maps the brackets around a node's label to its shape, longest
+// opening first.
+var shapes = []struct{ open, close, shape string }{
+	{"([", "])", "stadium"},
+	{"((", "))", "circle"},
+	{"[(", ")]", "round"},
+	{"[[", "]]", "rect"},
+	{"{{", "}}", "hexagon"},
+	{"[/", "/]", "rect"},
+	{`[\`, `\]`, "rect"},
+	{"[", "]", "rect"},
+	{"(", ")", "round"},
+	{"{", "}", "diamond"},
+	{">", "]", "rect"},
+}
+
+var (
+	linkTextRe = regexp.MustCompile(`^(?:--|==|-\.)\s+(.+?)\s+(-{2,}>|-{3,}|={2,}>|={3,}|\.-+>|\.-+)`)
+	linkRe     = regexp.MustCompile(`^(<?)(-{2,}|={2,}|-\.+-)([>ox]?)`)
+)
+
+// parseStatement reads a chain of node groups joined by links, such as
+// "A[Start] --> B & C -->|yes| D".
+func (fc *flowchart) parseStatement(s string) bool {
+	prev, rest, ok := fc.parseGroup(s)
+	if !ok {
+		return false
+	}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		var e fedge
+		if m := linkTextRe.FindStringSubmatch(rest); m != nil {
+			e.lines = labelLines(m[1])
+			arrow := m[2]
+			e.head = strings.HasSuffix(arrow, ">")
+			e.style = linkStyle(arrow)
+			rest = rest[len(m[0]):]
+		} else if m := linkRe.FindStringSubmatch(rest); m != nil {
+			e.tail = m[1] == "<"
+			e.head = m[3] != ""
+			e.style = linkStyle(m[2])
+			rest = rest[len(m[0]):]
+		} else {
+			return false
+		}
+		if rest = strings.TrimLeft(rest, " "); strings.HasPrefix(rest, "|") {
+			end := strings.Index(rest[1:], "|")
+			if end < 0 {
+				return false
+			}
+			e.lines = labelLines(rest[1 : 1+end])
+			rest = rest[end+2:]
+		}
+		var next []*fnode
+		if next, rest, ok = fc.parseGroup(rest); !ok {
+			return false
+		}
+		for _, from := range prev {
+			for _, to := range next {
+				edge := e
+				edge.from, edge.to = from, to
+				fc.edges = append(fc.edges, &edge)
+			}
+		}
+		prev = next
+	}
+	return true
+}
+
+func linkStyle(arrow string) string {
+	switch {
+	case strings.Contains(arrow, "."):
+		return "dotted"
+	case strings.Contains(arrow, "="):
+		return "thick"
+	}
+	return "solid"
+}
+
+// parseGroup reads nodes joined by &, returning them and the rest of s.
+func (fc *flowchart) parseGroup(s string) ([]*fnode, string, bool) {
+	var group []*fnode
+	for {
+		n, rest, ok := fc.parseNode(strings.TrimSpace(s))
+		if !ok {
+			return nil, "", false
+		}
+		group = append(group, n)
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "&") {
+			return group, rest, true
+		}
+		s = rest[1:]
+	}
+}
+
+// parseNode reads a node ID and its optional shaped label. A node's label
+// and shape are set where it's first given.
+func (fc *flowchart) parseNode(s string) (*fnode, string, bool) {
+	i := 0
+	for i < len(s) && (isIDChar(s[i]) || s[i] == '-' && i+1 < len(s) && isIDChar(s[i+1])) {
+		i++
+	}
+	if i == 0 {
+		return nil, "", false
+	}
+	id, rest := s[:i], s[i:]
+	n := fc.byID[id]
+	if n == nil {
+		n = &fnode{id: id, shape: "rect", lines: []string{id}}
+		fc.byID[id] = n
+		fc.nodes = append(fc.nodes, n)
+	}
+	for _, sh := range shapes {
+		if !strings.HasPrefix(rest, sh.open) {
+			continue
+		}
+		body := rest[len(sh.open):]
+		var end int
+		if strings.HasPrefix(body, `"`) {
+			q := strings.Index(body[1:], `"`)
+			if q < 0 {
+				return nil, "", false
+			}
+			end = strings.Index(body[q+2:], sh.close)
+			if end >= 0 {
+				end += q + 2
+			}
+		} else {
+			end = strings.Index(body, sh.close)
+		}
+		if end < 0 {
+			return nil, "", false
+		}
+		n.shape, n.lines = sh.shape, labelLines(body[:end])
+		rest = body[end+len(sh.close):]
+		break
+	}
+	return n, rest, true
+}
+
+func isIDChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+const (
+	nodeGap = 30 // between nodes of a rank
+	rankGap = 50 // between ranks, before room for edge labels
+)
+
+// layout ranks the nodes along the graph's direction, orders each rank to
+// keep edges short, and places them. It returns the diagram's size.
+func (fc *flowchart) layout(dir string) (float64, float64) {
+	for _, n := range fc.nodes {
+		tw, th := textSize(n.lines)
+		switch n.shape {
+		case "circle":
+			d := math.Max(tw, th) + 24
+			n.w, n.h = d, d
+		case "diamond":
+			n.w, n.h = tw+th+32, math.Max(th+tw/4+24, 44)
+		case "hexagon":
+			n.w, n.h = tw+44, th+20
+		default:
+			n.w, n.h = tw+30, th+20
+		}
+	}
+	fc.rank()
+	ranks := fc.order()
+
+	horizontal := dir == "LR" || dir == "RL"
+	// Breadth runs across a rank, depth along the direction.
+	breadth := func(n *fnode) float64 {
+		if horizontal {
+			return n.h
+		}
+		return n.w
+	}
+	depth := func(n *fnode) float64 {
+		if horizontal {
+			return n.w
+		}
+		return n.h
+	}
+	gaps := make([]float64, len(ranks))
+	for _, e := range fc.edges {
+		if len(e.lines) == 0 || e.from.rank == e.to.rank {
+			continue
+		}
+		lw, lh := textSize(e.lines)
+		need := lh + 24
+		if horizontal {
+			need = lw + 24
+		}
+		r := min(e.from.rank, e.to.rank)
+		gaps[r] = math.Max(gaps[r], need)
+	}
+
+	var maxBreadth float64
+	for _, rank := range ranks {
+		var b float64
+		for _, n := range rank {
+			b += breadth(n) + nodeGap
+		}
+		maxBreadth = math.Max(maxBreadth, b-nodeGap)
+	}
+	var pos float64
+	for r, rank := range ranks {
+		var b, d float64
+		for _, n := range rank {
+			b += breadth(n) + nodeGap
+			d = math.Max(d, depth(n))
+		}
+		at := (maxBreadth - (b - nodeGap)) / 2
+		for _, n := range rank {
+			across, along := at+breadth(n)/2, pos+d/2
+			if horizontal {
+				n.x, n.y = along, across
+			} else {
+				n.x, n.y = across, along
+			}
+			at += breadth(n) + nodeGap
+		}
+		pos += d + math.Max(rankGap, gaps[r])
+	}
+	total := pos - math.Max(rankGap, gaps[len(gaps)-1])
+	for _, n := range fc.nodes {
+		switch dir {
+		case "BT":
+			n.y = total - n.y
+		case "RL":
+			n.x = total - n.x
+		}
+	}
+	if horizontal {
+		return total, maxBreadth
+	}
+	return maxBreadth, total
+}
+
+// rank gives each node the length of the longest path to it, leaving out
+// the edges that close cycles.
+func (fc *flowchart) rank() {
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	state := map[*fnode]int{}
+	out := map[*fnode][]*fedge{}
+	for _, e := range fc.edges {
+		out[e.from] = append(out[e.from], e)
+	}
+	var visit func(n *fnode)
+	visit = func(n *fnode) {
+		state[n] = onStack
+		for _, e := range out[n] {
+			switch state[e.to] {
+			case onStack:
+				e.back = true
+			case unvisited:
+				visit(e.to)
+			}
+		}
+		state[n] = done
+	}
+	for _, n := range fc.nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	// Relax the ranks until they settle; the graph without back edges is
+	// acyclic, so this takes at most one pass per node.
+	for range fc.nodes {
+		changed := false
+		for _, e := range fc.edges {
+			if !e.back && e.to.rank < e.from.rank+1 {
+				e.to.rank = e.from.rank + 1
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+}
+
+// order groups the nodes by rank and orders each rank by the average
+// position of the nodes linking to it, starting from the order they appear.
+func (fc *flowchart) order() [][]*fnode {
+	var ranks [][]*fnode
+	for _, n := range fc.nodes {
+		for len(ranks) <= n.rank {
+			ranks = append(ranks, nil)
+		}
+		n.order = float64(len(ranks[n.rank]))
+		ranks[n.rank] = append(ranks[n.rank], n)
+	}
+	for r := 1; r < len(ranks); r++ {
+		bary := map[*fnode]float64{}
+		for _, n := range ranks[r] {
+			var sum, count float64
+			for _, e := range fc.edges {
+				if e.to == n && e.from.rank == r-1 {
+					sum += e.from.order
+					count++
+				}
+			}
+			bary[n] = n.order
+			if count > 0 {
+				bary[n] = sum / count
+			}
+		}
+		sort.SliceStable(ranks[r], func(i, j int) bool { return bary[ranks[r][i]] < bary[ranks[r][j]] })
+		for i, n := range ranks[r] {
+			n.order = float64(i)
+		}
+	}
+	return ranks
+}
+
+// boundary returns where the line from n's centre towards p leaves n.
+func (n *fnode) boundary(p point) point {
+	dx, dy := p.x-n.x, p.y-n.y
+	if dx == 0 && dy == 0 {
+		return point{n.x, n.y}
+	}
+	hw, hh := n.w/2, n.h/2
+	var t float64
+	switch n.shape {
+	case "circle":
+		t = hw / math.Hypot(dx, dy)
+	case "diamond":
+		t = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	default:
+		t = math.Inf(1)
+		if dx != 0 {
+			t = hw / math.Abs(dx)
+		}
+		if dy != 0 {
+			t = math.Min(t, hh/math.Abs(dy))
+		}
+	}
+	return point{n.x + dx*t, n.y + dy*t}
+}
+
+func (fc *flowchart) draw() string {
+	var c canvas
+	// Edges between the same two nodes are drawn side by side.
+	pairs := map[[2]*fnode]int{}
+	seen := map[[2]*fnode]int{}
+	key := func(e *fedge) [2]*fnode {
+		if e.from.id < e.to.id {
+			return [2]*fnode{e.from, e.to}
+		}
+		return [2]*fnode{e.to, e.from}
+	}
+	for _, e := range fc.edges {
+		pairs[key(e)]++
+	}
+	var labels canvas
+	for _, e := range fc.edges {
+		class := "edge edge-" + e.style
+		if e.from == e.to {
+			n := e.from
+			right, top := n.x+n.w/2, n.y-n.h/4
+			pts := []point{{right, top}, {right + 20, top}, {right + 20, n.y + n.h/4}, {right, n.y + n.h/4}}
+			c.polyline(class, pts...)
+			if e.head {
+				c.arrowhead(pts[2], pts[3])
+			}
+			continue
+		}
+		k := key(e)
+		offset := (float64(seen[k]) - float64(pairs[k]-1)/2) * 12
+		seen[k]++
+		// The offset is across the line from k[0] to k[1], so edges going
+		// either way between the pair land on different sides.
+		dx, dy := k[1].x-k[0].x, k[1].y-k[0].y
+		l := math.Hypot(dx, dy)
+		ox, oy := -dy/l*offset, dx/l*offset
+		a := e.from.boundary(point{e.to.x + ox, e.to.y + oy})
+		b := e.to.boundary(point{e.from.x + ox, e.from.y + oy})
+		a, b = point{a.x + ox, a.y + oy}, point{b.x + ox, b.y + oy}
+		c.polyline(class, a, b)
+		if e.head {
+			c.arrowhead(a, b)
+		}
+		if e.tail {
+			c.arrowhead(b, a)
+		}
+		if len(e.lines) > 0 {
+			lw, lh := textSize(e.lines)
+			mx, my := (a.x+b.x)/2, (a.y+b.y)/2
+			labels.rect("edge-label", mx-lw/2-4, my-lh/2-2, lw+8, lh+4, 3)
+			labels.text("edge-label-text", mx, my, "middle", e.lines)
+		}
+	}
+	for _, n := range fc.nodes {
+		class := "node node-" + n.shape
+		x, y, hw, hh := n.x, n.y, n.w/2, n.h/2
+		switch n.shape {
+		case "circle":
+			c.circle(class, x, y, hw)
+		case "diamond":
+			c.polygon(class, point{x, y - hh}, point{x + hw, y}, point{x, y + hh}, point{x - hw, y})
+		case "hexagon":
+			in := math.Min(hh, 14)
+			c.polygon(class, point{x - hw, y}, point{x - hw + in, y - hh}, point{x + hw - in, y - hh},
+				point{x + hw, y}, point{x + hw - in, y + hh}, point{x - hw + in, y + hh})
+		case "stadium":
+			c.rect(class, x-hw, y-hh, n.w, n.h, hh)
+		case "round":
+			c.rect(class, x-hw, y-hh, n.w, n.h, 10)
+		default:
+			c.rect(class, x-hw, y-hh, n.w, n.h, 3)
+		}
+		c.text("node-label", x, y, "middle", n.lines)
+	}
+	return c.b.String() + labels.b.String()
+}
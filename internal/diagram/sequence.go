@@ -0,0 +1,359 @@
+package diagram
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type participant struct {
+	id    string
+	lines []string
+	w, h  float64
+	x     float64 // centre of the lifeline
+	index int
+}
+
+type seqMessage struct {
+	from, to *participant
+	lines    []string
+	dashed   bool
+	head     string // "arrow", "cross", "open" or "" for none
+}
+
+type seqNote struct {
+	from, to *participant // columns spanned; to is from unless over two
+	side     string       // "left", "right" or "over"
+	lines    []string
+}
+
+type seqFrame struct {
+	kind     string
+	lines    []string
+	sections []float64 // y of each else/and/option divider
+	labels   [][]string
+	top, end float64
+	depth    int
+}
+
+type seqStep struct {
+	msg   *seqMessage
+	note  *seqNote
+	open  *seqFrame // a frame starts
+	split []string  // a frame's next section starts, with this label
+	close bool      // the innermost frame ends
+}
+
+type sequence struct {
+	parts []*participant
+	byID  map[string]*participant
+	steps []seqStep
+}
+
+var (
+	participantRe = regexp.MustCompile(`^(?:participant|actor)\s+(.+?)(?:\s+as\s+(.+))?$`)
+	messageRe     = regexp.MustCompile(`^([^:<>+]+?)\s*(-->>|->>|--x|-x|--\)|-\)|-->|->)\s*[+-]?\s*([^:]+?)\s*:\s*(.*)$`)
+	noteRe        = regexp.MustCompile(`^(?i:note)\s+(left of|right of|over)\s+([^:,]+?)(?:\s*,\s*([^:]+?))?\s*:\s*(.*)$`)
+	frameRe       = regexp.MustCompile(`^(loop|alt|opt|par|critical|break|rect)\b\s*(.*)$`)
+	sectionRe     = regexp.MustCompile(`^(else|and|option)\b\s*(.*)$`)
+)
+
+// ignoredSequence are statements that only change how a sequence diagram
+// looks in Mermaid's renderer.
+var ignoredSequence = []string{"activate ", "deactivate ", "title", "create ", "destroy ", "box", "links ", "link "}
+
+func renderSequence(lines []string) (string, bool) {
+	sq := &sequence{byID: map[string]*participant{}}
+	autonumber, n, depth := false, 0, 0
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, ";")
+		switch {
+		case line == "autonumber" || strings.HasPrefix(line, "autonumber "):
+			autonumber = true
+		case line == "end":
+			if depth == 0 {
+				return "", false
+			}
+			depth--
+			sq.steps = append(sq.steps, seqStep{close: true})
+		case hasAnyPrefix(line, ignoredSequence):
+		default:
+			if m := participantRe.FindStringSubmatch(line); m != nil {
+				p := sq.participant(strings.TrimSpace(m[1]))
+				if m[2] != "" {
+					p.lines = labelLines(m[2])
+				}
+			} else if m := noteRe.FindStringSubmatch(line); m != nil {
+				note := &seqNote{side: strings.Fields(m[1])[0], from: sq.participant(m[2]), lines: labelLines(m[4])}
+				note.to = note.from
+				if m[3] != "" {
+					if note.side != "over" {
+						return "", false
+					}
+					note.to = sq.participant(m[3])
+				}
+				sq.steps = append(sq.steps, seqStep{note: note})
+			} else if m := frameRe.FindStringSubmatch(line); m != nil {
+				f := &seqFrame{kind: m[1], depth: depth}
+				if m[1] != "rect" && m[2] != "" {
+					f.lines = labelLines(m[2])
+				}
+				depth++
+				sq.steps = append(sq.steps, seqStep{open: f})
+			} else if m := sectionRe.FindStringSubmatch(line); m != nil {
+				if depth == 0 {
+					return "", false
+				}
+				sq.steps = append(sq.steps, seqStep{split: labelLines(m[2])})
+			} else if m := messageRe.FindStringSubmatch(line); m != nil {
+				msg := &seqMessage{from: sq.participant(m[1]), to: sq.participant(m[3]), lines: labelLines(m[4])}
+				arrow := m[2]
+				msg.dashed = strings.HasPrefix(arrow, "--")
+				switch strings.TrimLeft(arrow, "-") {
+				case ">>":
+					msg.head = "arrow"
+				case "x":
+					msg.head = "cross"
+				case ")":
+					msg.head = "open"
+				}
+				if autonumber {
+					n++
+					msg.lines[0] = strconv.Itoa(n) + ". " + msg.lines[0]
+				}
+				sq.steps = append(sq.steps, seqStep{msg: msg})
+			} else {
+				return "", false
+			}
+		}
+	}
+	if depth != 0 || len(sq.parts) == 0 {
+		return "", false
+	}
+	w, h, body := sq.layout()
+	return svg("Sequence diagram", w, h, body), true
+}
+
+// participant returns the participant id, adding it the first time it's
+// mentioned.
+func (sq *sequence) participant(id string) *participant {
+	id = strings.TrimSpace(id)
+	p := sq.byID[id]
+	if p == nil {
+		p = &participant{id: id, lines: labelLines(id), index: len(sq.parts)}
+		sq.byID[id] = p
+		sq.parts = append(sq.parts, p)
+	}
+	return p
+}
+
+const (
+	colGap   = 40 // least space between participant boxes
+	rowGap   = 16 // between a message's label and the one above it
+	selfLoop = 30 // how far a message to its sender reaches out
+)
+
+// layout places the participants in columns wide enough for the messages
+// and notes between them, then draws each step in a row of its own. It
+// returns the size of the diagram and its elements.
+func (sq *sequence) layout() (float64, float64, string) {
+	for _, p := range sq.parts {
+		tw, th := textSize(p.lines)
+		p.w, p.h = math.Max(tw+24, 80), th+16
+	}
+	// gaps[i] is the least distance between the centres of columns i and i+1.
+	gaps := make([]float64, len(sq.parts))
+	for i := 0; i+1 < len(sq.parts); i++ {
+		gaps[i] = (sq.parts[i].w+sq.parts[i+1].w)/2 + colGap
+	}
+	widen := func(a, b int, need float64) {
+		if a > b {
+			a, b = b, a
+		}
+		var have float64
+		for i := a; i < b; i++ {
+			have += gaps[i]
+		}
+		if have < need {
+			for i := a; i < b; i++ {
+				gaps[i] += (need - have) / float64(b-a)
+			}
+		}
+	}
+	var right float64 // room needed past the last column
+	for _, s := range sq.steps {
+		switch {
+		case s.msg != nil && s.msg.from != s.msg.to:
+			tw, _ := textSize(s.msg.lines)
+			widen(s.msg.from.index, s.msg.to.index, tw+24)
+		case s.msg != nil:
+			tw, _ := textSize(s.msg.lines)
+			if i := s.msg.from.index; i+1 < len(sq.parts) {
+				widen(i, i+1, selfLoop+tw+16)
+			} else {
+				right = math.Max(right, selfLoop+tw+16)
+			}
+		case s.note != nil && s.note.from == s.note.to && s.note.side != "over":
+			tw, _ := textSize(s.note.lines)
+			i := s.note.from.index
+			switch {
+			case s.note.side == "right" && i+1 < len(sq.parts):
+				widen(i, i+1, tw+40)
+			case s.note.side == "right":
+				right = math.Max(right, tw+30)
+			case i > 0:
+				widen(i-1, i, tw+40)
+			}
+		}
+	}
+
+	left := sq.parts[0].w / 2
+	for _, s := range sq.steps {
+		if s.note != nil && s.note.side == "left" && s.note.from.index == 0 {
+			tw, _ := textSize(s.note.lines)
+			left = math.Max(left, tw+30)
+		}
+	}
+	x := left
+	for i, p := range sq.parts {
+		p.x = x
+		x += gaps[i]
+	}
+	last := sq.parts[len(sq.parts)-1]
+	width := last.x + math.Max(last.w/2, right)
+
+	var boxH float64
+	for _, p := range sq.parts {
+		boxH = math.Max(boxH, p.h)
+	}
+
+	var frames, lines, marks canvas
+	var open []*seqFrame
+	y := boxH + 20
+	for _, s := range sq.steps {
+		switch {
+		case s.open != nil:
+			s.open.top = y
+			open = append(open, s.open)
+			y += lineHeight + 14
+		case s.split != nil:
+			f := open[len(open)-1]
+			f.sections = append(f.sections, y)
+			f.labels = append(f.labels, s.split)
+			y += lineHeight + 14
+		case s.close:
+			f := open[len(open)-1]
+			open = open[:len(open)-1]
+			f.end = y
+			sq.drawFrame(&frames, f, width)
+			y += 12
+		case s.note != nil:
+			y = sq.drawNote(&marks, s.note, y)
+		case s.msg != nil:
+			y = drawMessage(&lines, &marks, s.msg, y)
+		}
+	}
+	y += 10
+
+	var boxes canvas
+	for _, p := range sq.parts {
+		boxes.polyline("lifeline dashed", point{p.x, boxH}, point{p.x, y})
+		for _, top := range []float64{0, y} {
+			boxes.rect("actor", p.x-p.w/2, top, p.w, boxH, 3)
+			boxes.text("actor-label", p.x, top+boxH/2, "middle", p.lines)
+		}
+	}
+	return width, y + boxH, frames.b.String() + boxes.b.String() + lines.b.String() + marks.b.String()
+}
+
+// drawMessage draws msg with its label above it, starting at y, and returns
+// where the next row starts.
+func drawMessage(lines, marks *canvas, msg *seqMessage, y float64) float64 {
+	_, th := textSize(msg.lines)
+	class := "message"
+	if msg.dashed {
+		class += " dashed"
+	}
+	from, to := msg.from.x, msg.to.x
+	if msg.from == msg.to {
+		marks.text("message-label", from+selfLoop+8, y+th/2, "start", msg.lines)
+		top, bottom := y+th/2-6, y+th/2+6
+		if bottom-top < 20 {
+			bottom = top + 20
+		}
+		pts := []point{{from, top}, {from + selfLoop, top}, {from + selfLoop, bottom}, {from, bottom}}
+		lines.polyline(class, pts...)
+		drawHead(lines, msg.head, pts[2], pts[3])
+		return bottom + rowGap
+	}
+	marks.text("message-label", (from+to)/2, y+th/2, "middle", msg.lines)
+	at := y + th + 6
+	lines.polyline(class, point{from, at}, point{to, at})
+	drawHead(lines, msg.head, point{from, at}, point{to, at})
+	return at + rowGap
+}
+
+// drawHead draws the end of a message arriving at to.
+func drawHead(c *canvas, head string, from, to point) {
+	switch head {
+	case "arrow":
+		c.arrowhead(from, to)
+	case "open":
+		dx := math.Copysign(8, to.x-from.x)
+		if to.x == from.x {
+			dx = -8
+		}
+		c.polyline("message-head", point{to.x - dx, to.y - 5}, to, point{to.x - dx, to.y + 5})
+	case "cross":
+		c.polyline("message-head", point{to.x - 5, to.y - 5}, point{to.x + 5, to.y + 5})
+		c.polyline("message-head", point{to.x - 5, to.y + 5}, point{to.x + 5, to.y - 5})
+	}
+}
+
+// drawNote draws note starting at y and returns where the next row starts.
+func (sq *sequence) drawNote(c *canvas, note *seqNote, y float64) float64 {
+	tw, th := textSize(note.lines)
+	w, h := tw+16, th+10
+	var x float64
+	switch note.side {
+	case "left":
+		x = note.from.x - 10 - w
+	case "right":
+		x = note.from.x + 10
+	default:
+		a, b := math.Min(note.from.x, note.to.x), math.Max(note.from.x, note.to.x)
+		if a != b {
+			w = math.Max(w, b-a+40)
+		}
+		x = (a+b)/2 - w/2
+	}
+	c.rect("note", x, y, w, h, 0)
+	c.text("note-label", x+w/2, y+h/2, "middle", note.lines)
+	return y + h + rowGap
+}
+
+// drawFrame draws a loop, alt or other frame around the rows it holds,
+// inset by its depth so nested frames stay inside their parents.
+func (sq *sequence) drawFrame(c *canvas, f *seqFrame, width float64) {
+	inset := float64(f.depth) * 8
+	x0 := -margin/2 + inset
+	x1 := width + margin/2 - inset
+	c.rect("frame", x0, f.top, x1-x0, f.end-f.top, 0)
+	if f.kind == "rect" {
+		return
+	}
+	kw, _ := textSize([]string{f.kind})
+	c.polygon("frame-tab", point{x0, f.top}, point{x0 + kw + 16, f.top},
+		point{x0 + kw + 16, f.top + lineHeight - 4}, point{x0 + kw + 10, f.top + lineHeight + 2}, point{x0, f.top + lineHeight + 2})
+	c.text("frame-kind", x0+6, f.top+lineHeight/2+1, "start", []string{f.kind})
+	if len(f.lines) > 0 {
+		c.text("frame-label", x0+kw+24, f.top+lineHeight/2+1, "start", []string{"[" + strings.Join(f.lines, " ") + "]"})
+	}
+	for i, at := range f.sections {
+		c.polyline("frame-divider dashed", point{x0, at}, point{x1, at})
+		if label := f.labels[i]; len(label) > 0 && label[0] != "" {
+			c.text("frame-label", x0+kw+24, at+lineHeight/2+3, "start", []string{"[" + strings.Join(label, " ") + "]"})
+		}
+	}
+}
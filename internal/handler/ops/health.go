@@ -0,0 +1,90 @@
+package ops
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/database"
+)
+
+// readyTimeout bounds each readiness check so a stuck database answers
+// "not ready" instead of hanging the probe.
+const readyTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db  *database.DB
+	cfg *config.Config
+}
+
+func NewHealthHandler(db *database.DB, cfg *config.Config) *HealthHandler {
+	return &HealthHandler{db: db, cfg: cfg}
+}
+
+// Live reports that the process is up and serving requests. It touches
+// nothing else, so it is safe to poll often.
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendString("ok")
+}
+
+// Ready reports whether the server can handle traffic: the database answers,
+// every migration is applied and the upload directory is writable. It
+// responds 503 with the failing checks otherwise.
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	checks := map[string]string{
+		"database":   h.checkDatabase(ctx),
+		"migrations": h.checkMigrations(ctx),
+		"uploads":    h.checkUploads(ctx),
+	}
+	status, code := "ok", fiber.StatusOK
+	for _, result := range checks {
+		if result != "ok" {
+			status, code = "unavailable", fiber.StatusServiceUnavailable
+		}
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(code).JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	for pool, db := range map[string]*sql.DB{"write": h.db.Write, "read": h.db.Read} {
+		if err := db.PingContext(ctx); err != nil {
+			slog.WarnContext(ctx, "readyz check failed", "check", "database", "pool", pool, "error", err)
+			return "error"
+		}
+	}
+	return "ok"
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) string {
+	pending, err := database.PendingMigrations(ctx, h.db)
+	if err != nil {
+		slog.WarnContext(ctx, "readyz check failed", "check", "migrations", "error", err)
+		return "error"
+	}
+	if len(pending) > 0 {
+		return fmt.Sprintf("pending: %s", strings.Join(pending, ", "))
+	}
+	return "ok"
+}
+
+func (h *HealthHandler) checkUploads(ctx context.Context) string {
+	f, err := os.CreateTemp(h.cfg.UploadDir, ".readyz-*")
+	if err != nil {
+		slog.WarnContext(ctx, "readyz check failed", "check", "uploads", "error", err)
+		return "error"
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return "ok"
+}
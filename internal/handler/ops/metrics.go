@@ -0,0 +1,22 @@
+package ops
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+)
+
+type MetricsHandler struct {
+	registry *metrics.Registry
+}
+
+func NewMetricsHandler(registry *metrics.Registry) *MetricsHandler {
+	return &MetricsHandler{registry: registry}
+}
+
+// Handle serves all metrics in the Prometheus text exposition format.
+func (h *MetricsHandler) Handle(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	_, err := h.registry.WriteTo(c.Response().BodyWriter())
+	return err
+}
@@ -0,0 +1,27 @@
+package public
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+type BeaconHandler struct {
+	analytics *service.AnalyticsService
+}
+
+func NewBeaconHandler(analytics *service.AnalyticsService) *BeaconHandler {
+	return &BeaconHandler{analytics: analytics}
+}
+
+// Read accepts reading-progress beacons sent by /static/js/reading.js via
+// navigator.sendBeacon. Fields: t (view token), d (scroll depth %), s
+// (engaged seconds). It always answers 204 so clients learn nothing about tokens.
+func (h *BeaconHandler) Read(c *fiber.Ctx) error {
+	token := c.FormValue("t")
+	depth, _ := strconv.Atoi(c.FormValue("d"))
+	seconds, _ := strconv.Atoi(c.FormValue("s"))
+	h.analytics.RecordRead(c.UserContext(), token, depth, seconds)
+	return c.SendStatus(fiber.StatusNoContent)
+}
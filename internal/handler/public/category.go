@@ -1,20 +1,26 @@
 package public
 
 import (
+	"net/url"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/service"
 )
 
 type CategoryHandler struct {
-	posts *service.PostService
+	posts   *service.PostService
+	perPage int
 }
 
-func NewCategoryHandler(posts *service.PostService) *CategoryHandler {
-	return &CategoryHandler{posts: posts}
+// NewCategoryHandler returns the category handlers, listing perPage posts
+// on each page of a category, or every post on one page if perPage is 0.
+func NewCategoryHandler(posts *service.PostService, perPage int) *CategoryHandler {
+	return &CategoryHandler{posts: posts, perPage: perPage}
 }
 
 func (h *CategoryHandler) List(c *fiber.Ctx) error {
-	categories, err := h.posts.ListCategories()
+	categories, err := h.posts.ListCategories(c.UserContext())
 	if err != nil {
 		return err
 	}
@@ -25,14 +31,23 @@ func (h *CategoryHandler) List(c *fiber.Ctx) error {
 }
 
 func (h *CategoryHandler) Show(c *fiber.Ctx) error {
-	slug := c.Params("slug")
-	posts, err := h.posts.ListPublishedByCategory(slug)
+	slug := categoryParam(c)
+	data := fiber.Map{"Title": slug, "Category": slug}
+	page, err := listPage(c, h.posts, model.PostQuery{Category: slug, Limit: h.perPage}, data)
 	if err != nil {
 		return err
 	}
-	return c.Render("public/category_detail", fiber.Map{
-		"Title":    slug,
-		"Category": slug,
-		"Posts":    posts,
-	}, "layouts/base")
+	data["Posts"] = page.Posts
+	return c.Render("public/category_detail", data, "layouts/base")
+}
+
+// categoryParam returns the category named by the :slug parameter. Links
+// escape categories with spaces or other reserved characters, and fiber
+// passes parameters on undecoded.
+func categoryParam(c *fiber.Ctx) string {
+	slug, err := url.PathUnescape(c.Params("slug"))
+	if err != nil {
+		return c.Params("slug")
+	}
+	return slug
 }
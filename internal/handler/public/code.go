@@ -0,0 +1,27 @@
+package public
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+// CodeStyleHandler serves the stylesheet colouring highlighted code in the
+// code themes the configuration names.
+type CodeStyleHandler struct {
+	css string
+	err error // an unknown theme, reported on every request
+}
+
+func NewCodeStyleHandler(cfg *config.Config) *CodeStyleHandler {
+	css, err := service.CodeCSS(cfg.CodeTheme, cfg.CodeThemeDark)
+	return &CodeStyleHandler{css: css, err: err}
+}
+
+func (h *CodeStyleHandler) Handle(c *fiber.Ctx) error {
+	if h.err != nil {
+		return h.err
+	}
+	c.Set(fiber.HeaderContentType, "text/css; charset=utf-8")
+	return c.SendString(h.css)
+}
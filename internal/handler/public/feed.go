@@ -0,0 +1,186 @@
+package public
+
+import (
+	"encoding/xml"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+const (
+	siteTitle   = "AI Studies"
+	feedEntries = 20 // most recent posts in a feed
+)
+
+type FeedHandler struct {
+	posts *service.PostService
+	cfg   *config.Config
+}
+
+func NewFeedHandler(posts *service.PostService, cfg *config.Config) *FeedHandler {
+	return &FeedHandler{posts: posts, cfg: cfg}
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string      `xml:"title"`
+	ID         string      `xml:"id"`
+	Link       atomLink    `xml:"link"`
+	Published  string      `xml:"published"`
+	Updated    string      `xml:"updated"`
+	Summary    string      `xml:"summary,omitempty"`
+	Categories []atomTerm  `xml:"category"`
+	Content    atomContent `xml:"content"`
+}
+
+type atomTerm struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Atom serves the Atom feed of the most recent posts.
+func (h *FeedHandler) Atom(c *fiber.Ctx) error {
+	page, err := h.posts.ListPage(c.UserContext(), model.PostQuery{Status: "published", Limit: feedEntries})
+	if err != nil {
+		return err
+	}
+	return h.sendAtom(c, siteTitle, "/", "/feed.xml", page.Posts)
+}
+
+// CategoryAtom serves the Atom feed of one category.
+func (h *FeedHandler) CategoryAtom(c *fiber.Ctx) error {
+	slug := categoryParam(c)
+	page, err := h.posts.ListPage(c.UserContext(), model.PostQuery{Status: "published", Category: slug, Limit: feedEntries})
+	if err != nil {
+		return err
+	}
+	if len(page.Posts) == 0 {
+		return fiber.ErrNotFound
+	}
+	path := "/categories/" + url.PathEscape(slug)
+	return h.sendAtom(c, siteTitle+" — "+slug, path, path+"/feed.xml", page.Posts)
+}
+
+func (h *FeedHandler) sendAtom(c *fiber.Ctx, title, page, self string, posts []*model.Post) error {
+	base := h.baseURL(c)
+	feed := atomFeed{
+		Title: title,
+		ID:    base + self,
+		Links: []atomLink{
+			{Href: base + page, Rel: "alternate", Type: "text/html"},
+			{Href: base + self, Rel: "self", Type: "application/atom+xml"},
+		},
+		Author: atomAuthor{Name: model.Author.Name},
+	}
+
+	var updated time.Time
+	for _, p := range posts {
+		link := base + "/posts/" + p.Slug
+		published := p.CreatedAt
+		if p.PublishedAt != nil {
+			published = *p.PublishedAt
+		}
+		e := atomEntry{
+			Title:     p.Title,
+			ID:        link,
+			Link:      atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Published: published.UTC().Format(time.RFC3339),
+			Updated:   p.UpdatedAt.UTC().Format(time.RFC3339),
+			Summary:   p.Excerpt,
+			Content:   atomContent{Type: "html", Body: p.ContentHTML},
+		}
+		if p.Category != "" {
+			e.Categories = append(e.Categories, atomTerm{Term: p.Category})
+		}
+		feed.Entries = append(feed.Entries, e)
+		if p.UpdatedAt.After(updated) {
+			updated = p.UpdatedAt
+		}
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	return sendXML(c, "application/atom+xml; charset=utf-8", feed)
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Sitemap lists every public page for search engines.
+func (h *FeedHandler) Sitemap(c *fiber.Ctx) error {
+	posts, err := h.posts.ListPublished(c.UserContext())
+	if err != nil {
+		return err
+	}
+	categories, err := h.posts.ListCategories(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	base := h.baseURL(c)
+	var set sitemapURLSet
+	for _, path := range []string{"/", "/categories", "/timeline", "/about"} {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + path})
+	}
+	for _, cat := range categories {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + "/categories/" + url.PathEscape(cat)})
+	}
+	for _, p := range posts {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     base + "/posts/" + p.Slug,
+			LastMod: p.UpdatedAt.UTC().Format("2006-01-02"),
+		})
+	}
+	return sendXML(c, "application/xml; charset=utf-8", set)
+}
+
+// baseURL is SITE_URL, or the address of the request when it isn't set.
+// Feeds and sitemaps need absolute links.
+func (h *FeedHandler) baseURL(c *fiber.Ctx) string {
+	if h.cfg.SiteURL != "" {
+		return h.cfg.SiteURL
+	}
+	return c.BaseURL()
+}
+
+func sendXML(c *fiber.Ctx, contentType string, v any) error {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(append([]byte(xml.Header), b...))
+}
@@ -1,38 +1,46 @@
 package public
 
 import (
+	"log/slog"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/service"
 )
 
 type HomeHandler struct {
-	posts *service.PostService
+	posts   *service.PostService
+	perPage int
 }
 
-func NewHomeHandler(posts *service.PostService) *HomeHandler {
-	return &HomeHandler{posts: posts}
+// NewHomeHandler returns the home page handler, listing perPage posts on
+// each page, or every post on one page if perPage is 0.
+func NewHomeHandler(posts *service.PostService, perPage int) *HomeHandler {
+	return &HomeHandler{posts: posts, perPage: perPage}
 }
 
 func (h *HomeHandler) Handle(c *fiber.Ctx) error {
-	posts, err := h.posts.ListPublished()
+	data := fiber.Map{"Title": "AI Studies"}
+	page, err := listPage(c, h.posts, model.PostQuery{Limit: h.perPage}, data)
 	if err != nil {
 		return err
 	}
 
-	// Featured = first post; recent = next N
+	// Featured = newest post, on the first page only; recent = the rest
 	var featured interface{}
-	recent := posts
-	if len(posts) > 0 {
-		featured = posts[0]
-		recent = posts[1:]
+	recent := page.Posts
+	if len(recent) > 0 && page.Prev == nil {
+		featured = recent[0]
+		recent = recent[1:]
 	}
 
-	categories, _ := h.posts.ListCategories()
+	categories, err := h.posts.ListCategories(c.UserContext())
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "list categories", "error", err)
+	}
 
-	return c.Render("public/home", fiber.Map{
-		"Title":      "AI Studies",
-		"Posts":      recent,
-		"Featured":   featured,
-		"Categories": categories,
-	}, "layouts/base")
+	data["Posts"] = recent
+	data["Featured"] = featured
+	data["Categories"] = categories
+	return c.Render("public/home", data, "layouts/base")
 }
@@ -0,0 +1,31 @@
+package public
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+// listPage returns the page of the published posts q selects that the
+// request asks for with ?after= or ?before=, and sets PrevURL and NextURL in
+// data for the links and <link rel> tags around it.
+func listPage(c *fiber.Ctx, posts *service.PostService, q model.PostQuery, data fiber.Map) (*model.PostPage, error) {
+	q.Status = "published"
+	if err := service.SetCursor(&q, c.Query("after"), c.Query("before")); err != nil {
+		return nil, err
+	}
+	page, err := posts.ListPage(c.UserContext(), q)
+	if err != nil {
+		return nil, err
+	}
+	data["PrevURL"] = pageURL(c, "before", page.Prev)
+	data["NextURL"] = pageURL(c, "after", page.Next)
+	return page, nil
+}
+
+func pageURL(c *fiber.Ctx, param string, cursor *model.PostCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return c.Path() + "?" + param + "=" + service.EncodeCursor(cursor)
+}
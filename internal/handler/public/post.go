@@ -1,48 +1,100 @@
 package public
 
 import (
-	"errors"
+	"bytes"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/pagecache"
 	"github.com/mhtecdev/blog-ai/internal/service"
 )
 
+// relatedPosts is how many related posts a post page suggests.
+const relatedPosts = 3
+
+// viewTokenPlaceholder stands in for the view token in cached post pages;
+// each counted view gets its own token.
+const viewTokenPlaceholder = "00000000-view-token-placeholder"
+
 type PostHandler struct {
 	posts     *service.PostService
+	related   *service.RelatedService
 	analytics *service.AnalyticsService
+	cache     *pagecache.Cache
+}
+
+// postPage is kept with a cached post page: the post and the page as sent
+// to readers whose view is counted, with viewTokenPlaceholder for the token.
+type postPage struct {
+	id      int64
+	counted []byte
 }
 
-func NewPostHandler(posts *service.PostService, analytics *service.AnalyticsService) *PostHandler {
-	return &PostHandler{posts: posts, analytics: analytics}
+// NewPostHandler returns the post page handler. analytics may be nil, as
+// for static builds, in which case no views are recorded; cache may be nil
+// to render every request.
+func NewPostHandler(posts *service.PostService, related *service.RelatedService, analytics *service.AnalyticsService, cache *pagecache.Cache) *PostHandler {
+	return &PostHandler{posts: posts, related: related, analytics: analytics, cache: cache}
 }
 
 func (h *PostHandler) Show(c *fiber.Ctx) error {
 	slug := c.Params("slug")
-	post, err := h.posts.GetBySlug(slug)
-	if errors.Is(err, service.ErrNotFound) {
-		return c.Status(fiber.StatusNotFound).Render("public/404", fiber.Map{
-			"Title": "Post not found",
-		}, "layouts/base")
-	}
+	path := pagecache.Path(c)
+	page, err := h.cache.Fill(path, path, func() (*pagecache.Page, error) {
+		return h.render(c, slug)
+	})
 	if err != nil {
 		return err
 	}
+	pp := page.Value.(*postPage)
 
-	if !post.IsPublished() {
-		return c.Status(fiber.StatusNotFound).Render("public/404", fiber.Map{
-			"Title": "Post not found",
-		}, "layouts/base")
+	// Record view asynchronously; studio users reading their own posts don't count.
+	// The page carries the view's token, so it can't be revalidated.
+	if h.analytics != nil && c.Locals("user") == nil {
+		ip := c.IP()
+		ua := string(c.Request().Header.UserAgent())
+		src := service.NewTrafficSource(c.Get(fiber.HeaderReferer), c.Hostname(),
+			c.Query("utm_source"), c.Query("utm_medium"), c.Query("utm_campaign"))
+		if token := h.analytics.RecordView(c.UserContext(), pp.id, ip, ua, src); token != "" {
+			c.Set(fiber.HeaderCacheControl, "private, no-store")
+			c.Set(fiber.HeaderContentType, page.ContentType)
+			return c.Send(bytes.Replace(pp.counted, []byte(viewTokenPlaceholder), []byte(token), 1))
+		}
 	}
+	return pagecache.Send(c, page, pagecache.Private)
+}
 
-	// Record view asynchronously
-	ip := c.IP()
-	ua := string(c.Request().Header.UserAgent())
-	h.analytics.RecordView(post.ID, ip, ua)
+// render renders the post page both without a view token and with the
+// placeholder.
+func (h *PostHandler) render(c *fiber.Ctx, slug string) (*pagecache.Page, error) {
+	post, err := h.posts.GetBySlug(c.UserContext(), slug)
+	if err != nil {
+		return nil, err
+	}
+	if !post.IsPublished() {
+		return nil, service.ErrNotFound
+	}
+	related, err := h.related.For(c.UserContext(), post, relatedPosts)
+	if err != nil {
+		return nil, err
+	}
 
-	return c.Render("public/post", fiber.Map{
-		"Title":  post.Title,
-		"Post":   post,
-		"Author": model.Author,
-	}, "layouts/base")
+	bind := fiber.Map{
+		"Title":   post.Title,
+		"Post":    post,
+		"Related": related,
+		"Author":  model.Author,
+	}
+	var plain, counted bytes.Buffer
+	views := c.App().Config().Views
+	if err := views.Render(&plain, "public/post", bind, "layouts/base"); err != nil {
+		return nil, err
+	}
+	bind["ViewToken"] = viewTokenPlaceholder
+	if err := views.Render(&counted, "public/post", bind, "layouts/base"); err != nil {
+		return nil, err
+	}
+	page := pagecache.NewPage(plain.Bytes(), fiber.MIMETextHTMLCharsetUTF8)
+	page.Value = &postPage{id: post.ID, counted: counted.Bytes()}
+	return page, nil
 }
@@ -1,25 +1,132 @@
 package public
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/service"
 )
 
+// TimelineHandler serves the timeline and the archive pages of each year
+// and month, which list posts by the month they were published in (UTC).
 type TimelineHandler struct {
-	posts *service.PostService
+	posts   *service.PostService
+	perPage int
 }
 
-func NewTimelineHandler(posts *service.PostService) *TimelineHandler {
-	return &TimelineHandler{posts: posts}
+// NewTimelineHandler returns the timeline handler, listing perPage posts on
+// each page, or every post on one page if perPage is 0.
+func NewTimelineHandler(posts *service.PostService, perPage int) *TimelineHandler {
+	return &TimelineHandler{posts: posts, perPage: perPage}
 }
 
 func (h *TimelineHandler) Handle(c *fiber.Ctx) error {
-	posts, err := h.posts.ListPublished()
+	data := fiber.Map{"Title": "Timeline"}
+	page, err := listPage(c, h.posts, model.PostQuery{Limit: h.perPage}, data)
+	if err != nil {
+		return err
+	}
+	archive, err := h.posts.Archive(c.UserContext())
 	if err != nil {
 		return err
 	}
-	return c.Render("public/timeline", fiber.Map{
-		"Title": "Timeline",
-		"Posts": posts,
-	}, "layouts/base")
+	data["Archive"] = archive
+	data["Groups"] = groupByMonth(page.Posts, archive)
+	return c.Render("public/timeline", data, "layouts/base")
+}
+
+// Year serves /archive/:year, the posts published in a year.
+func (h *TimelineHandler) Year(c *fiber.Ctx) error {
+	year, ok := archiveParam(c.Params("year"), 4, 1, 9999)
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	since := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return h.archive(c, since, since.AddDate(1, 0, 0), fiber.Map{
+		"Title":  strconv.Itoa(year),
+		"Up":     fiber.Map{"Path": "/timeline", "Label": "Timeline"},
+		"IsYear": true,
+	})
+}
+
+// Month serves /archive/:year/:month, the posts published in a month.
+func (h *TimelineHandler) Month(c *fiber.Ctx) error {
+	year, ok := archiveParam(c.Params("year"), 4, 1, 9999)
+	month, ok2 := archiveParam(c.Params("month"), 2, 1, 12)
+	if !ok || !ok2 {
+		return fiber.ErrNotFound
+	}
+	since := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	return h.archive(c, since, since.AddDate(0, 1, 0), fiber.Map{
+		"Title": model.ArchiveMonth{Year: year, Month: time.Month(month)}.Label(),
+		"Up":    fiber.Map{"Path": model.ArchiveYearPath(year), "Label": strconv.Itoa(year)},
+	})
+}
+
+// archive renders the posts published in [since, until). A period without
+// posts has no page. Only the period's own months are counted, so the page
+// changes only when its posts do.
+func (h *TimelineHandler) archive(c *fiber.Ctx, since, until time.Time, data fiber.Map) error {
+	page, err := listPage(c, h.posts, model.PostQuery{Since: since, Until: until, Limit: h.perPage}, data)
+	if err != nil {
+		return err
+	}
+	if len(page.Posts) == 0 && page.Prev == nil {
+		return fiber.ErrNotFound
+	}
+	archive, err := h.posts.Archive(c.UserContext())
+	if err != nil {
+		return err
+	}
+	var months []model.ArchiveMonth
+	for _, y := range archive {
+		for _, m := range y.Months {
+			if t := time.Date(m.Year, m.Month, 1, 0, 0, 0, 0, time.UTC); !t.Before(since) && t.Before(until) {
+				months = append(months, m)
+			}
+		}
+	}
+	data["Months"] = months
+	data["Groups"] = groupByMonth(page.Posts, archive)
+	return c.Render("public/archive", data, "layouts/base")
+}
+
+// archiveParam parses a year or month parameter, which must have exactly
+// digits digits so every period has one URL.
+func archiveParam(s string, digits, lo, hi int) (int, bool) {
+	if len(s) != digits {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= lo && n <= hi
+}
+
+// groupByMonth splits posts, newest first, into runs published in the same
+// month, each with the month's total from archive.
+func groupByMonth(posts []*model.Post, archive []model.ArchiveYear) []model.MonthPosts {
+	counts := make(map[[2]int]int)
+	for _, y := range archive {
+		for _, m := range y.Months {
+			counts[[2]int{m.Year, int(m.Month)}] = m.Count
+		}
+	}
+	var groups []model.MonthPosts
+	for _, p := range posts {
+		published := p.CreatedAt
+		if p.PublishedAt != nil {
+			published = *p.PublishedAt
+		}
+		published = published.UTC()
+		year, month := published.Year(), published.Month()
+		if n := len(groups); n == 0 || groups[n-1].Year != year || groups[n-1].Month != month {
+			groups = append(groups, model.MonthPosts{ArchiveMonth: model.ArchiveMonth{
+				Year: year, Month: month, Count: counts[[2]int{year, int(month)}],
+			}})
+		}
+		g := &groups[len(groups)-1]
+		g.Posts = append(g.Posts, p)
+	}
+	return groups
 }
@@ -2,6 +2,7 @@ package studio
 
 import (
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -22,7 +23,7 @@ func NewAuthHandler(auth *service.AuthService, cfg *config.Config) *AuthHandler
 func (h *AuthHandler) ShowLogin(c *fiber.Ctx) error {
 	// Already logged in? Redirect to dashboard.
 	if sid := c.Cookies(middleware.SessionCookieName); sid != "" {
-		if _, err := h.auth.Validate(sid); err == nil {
+		if _, err := h.auth.Validate(c.UserContext(), sid); err == nil {
 			return c.Redirect("/studio/dashboard", fiber.StatusSeeOther)
 		}
 	}
@@ -35,7 +36,7 @@ func (h *AuthHandler) ProcessLogin(c *fiber.Ctx) error {
 	username := c.FormValue("username")
 	password := c.FormValue("password")
 
-	session, err := h.auth.Login(username, password, c.IP(), string(c.Request().Header.UserAgent()))
+	session, err := h.auth.Login(c.UserContext(), username, password, c.IP(), string(c.Request().Header.UserAgent()))
 	if err != nil {
 		errMsg := "Invalid username or password."
 		if !errors.Is(err, service.ErrInvalidCredentials) {
@@ -64,7 +65,9 @@ func (h *AuthHandler) ProcessLogin(c *fiber.Ctx) error {
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	sid := c.Cookies(middleware.SessionCookieName)
 	if sid != "" {
-		_ = h.auth.Logout(sid)
+		if err := h.auth.Logout(c.UserContext(), sid); err != nil {
+			slog.WarnContext(c.UserContext(), "logout: delete session", "error", err)
+		}
 	}
 	c.Cookie(&fiber.Cookie{
 		Name:    middleware.SessionCookieName,
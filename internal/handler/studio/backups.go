@@ -0,0 +1,81 @@
+package studio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+type BackupsHandler struct {
+	backups *service.BackupService
+}
+
+func NewBackupsHandler(backups *service.BackupService) *BackupsHandler {
+	return &BackupsHandler{backups: backups}
+}
+
+type backupRow struct {
+	Name      string
+	Size      string
+	CreatedAt string
+}
+
+func (h *BackupsHandler) List(c *fiber.Ctx) error {
+	user := c.Locals("user").(*model.AdminUser)
+	archives, err := h.backups.List()
+	if err != nil {
+		return err
+	}
+	rows := make([]backupRow, len(archives))
+	for i, a := range archives {
+		rows[i] = backupRow{Name: a.Name, Size: formatBytes(a.Size), CreatedAt: a.CreatedAt.Format("2006-01-02 15:04:05 UTC")}
+	}
+
+	flash := ""
+	if name := c.Query("created"); name != "" {
+		flash = "Backup " + name + " created."
+	}
+	return c.Render("studio/backups", fiber.Map{
+		"Title":   "Backups",
+		"Section": "backups",
+		"User":    user,
+		"Backups": rows,
+		"Flash":   flash,
+	}, "layouts/studio")
+}
+
+func (h *BackupsHandler) Create(c *fiber.Ctx) error {
+	// A half-written archive is worthless, so let the backup finish even if
+	// the request deadline passes; it then shows up in the list.
+	a, err := h.backups.Create(context.WithoutCancel(c.UserContext()))
+	if err != nil {
+		return err
+	}
+	return c.Redirect("/studio/backups?created="+a.Name, fiber.StatusSeeOther)
+}
+
+func (h *BackupsHandler) Download(c *fiber.Ctx) error {
+	path, err := h.backups.Path(c.Params("name"))
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Download(path)
+}
+
+// formatBytes renders n in B, KB, MB or GB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 2; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMG"[exp])
+}
@@ -17,12 +17,28 @@ func NewDashboardHandler(posts *service.PostService, analytics *service.Analytic
 
 func (h *DashboardHandler) Handle(c *fiber.Ctx) error {
 	user := c.Locals("user").(*model.AdminUser)
+	ctx := c.UserContext()
 
-	totalViews, _ := h.analytics.TotalViews()
-	todayViews, _ := h.analytics.TotalViewsToday()
-	totalPosts, _ := h.analytics.TotalPublishedPosts()
-	topPosts, _ := h.analytics.GetPostMetrics()
-	recentViews, _ := h.analytics.GetRecentViews(30)
+	totalViews, err := h.analytics.TotalViews(ctx)
+	if err != nil {
+		return err
+	}
+	todayViews, err := h.analytics.TotalViewsToday(ctx)
+	if err != nil {
+		return err
+	}
+	totalPosts, err := h.analytics.TotalPublishedPosts(ctx)
+	if err != nil {
+		return err
+	}
+	topPosts, err := h.analytics.GetPostMetrics(ctx, model.AnalyticsFilter{})
+	if err != nil {
+		return err
+	}
+	recentViews, err := h.analytics.GetRecentViews(ctx, 30)
+	if err != nil {
+		return err
+	}
 
 	if len(topPosts) > 5 {
 		topPosts = topPosts[:5]
@@ -37,5 +53,6 @@ func (h *DashboardHandler) Handle(c *fiber.Ctx) error {
 		"TotalPosts":  totalPosts,
 		"TopPosts":    topPosts,
 		"RecentViews": recentViews,
+		"LoadLive":    true,
 	}, "layouts/studio")
 }
@@ -0,0 +1,139 @@
+package studio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+const (
+	// liveSnapshotInterval is how often the reader counts are re-sent. It
+	// also serves as the keep-alive that detects closed connections.
+	liveSnapshotInterval = 5 * time.Second
+	// livePostTimeout bounds each post lookup made by the stream.
+	livePostTimeout = 2 * time.Second
+)
+
+type liveViewEvent struct {
+	PostID   int64     `json:"post_id"`
+	Title    string    `json:"title"`
+	Slug     string    `json:"slug"`
+	Channel  string    `json:"channel"`
+	Referrer string    `json:"referrer,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+type liveReadersEvent struct {
+	Total int               `json:"total"`
+	Posts []liveReadersPost `json:"posts"`
+}
+
+type liveReadersPost struct {
+	PostID  int64  `json:"post_id"`
+	Title   string `json:"title"`
+	Slug    string `json:"slug"`
+	Readers int    `json:"readers"`
+}
+
+// Live streams Server-Sent Events to the dashboard: a "readers" event with
+// the current readers per post every few seconds, and a "view" event for
+// every view as it is recorded. The stream ends if the client disconnects or
+// can't keep up; EventSource then reconnects on its own.
+func (h *MetricsHandler) Live(c *fiber.Ctx) error {
+	views, cancel := h.analytics.SubscribeLive()
+	conn := c.Context().Conn()
+	// The stream outlives the handler and so the request's deadline; keep
+	// only its values (the request ID) for the lookups made while streaming.
+	ctx := context.WithoutCancel(c.UserContext())
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		// The server's WriteTimeout covers the whole response; push the
+		// deadline forward with each event so the stream stays open while
+		// a stalled client is still cut off.
+		send := func(event string, data interface{}) bool {
+			_ = conn.SetWriteDeadline(time.Now().Add(2 * liveSnapshotInterval))
+			return writeEvent(w, event, data)
+		}
+		posts := make(map[int64]*model.Post)
+		ticker := time.NewTicker(liveSnapshotInterval)
+		defer ticker.Stop()
+
+		if !send("readers", h.readersEvent(ctx, posts)) {
+			return
+		}
+		for {
+			var ok bool
+			select {
+			case v, open := <-views:
+				if !open {
+					return
+				}
+				post := h.livePost(ctx, posts, v.PostID)
+				ok = send("view", liveViewEvent{
+					PostID:   v.PostID,
+					Title:    post.Title,
+					Slug:     post.Slug,
+					Channel:  v.Channel,
+					Referrer: v.ReferrerDomain,
+					At:       v.ViewedAt,
+				})
+			case <-ticker.C:
+				ok = send("readers", h.readersEvent(ctx, posts))
+			}
+			if !ok {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (h *MetricsHandler) readersEvent(ctx context.Context, posts map[int64]*model.Post) liveReadersEvent {
+	e := liveReadersEvent{Posts: []liveReadersPost{}}
+	for _, r := range h.analytics.LiveReaders(time.Now()) {
+		post := h.livePost(ctx, posts, r.PostID)
+		e.Total += r.Readers
+		e.Posts = append(e.Posts, liveReadersPost{PostID: r.PostID, Title: post.Title, Slug: post.Slug, Readers: r.Readers})
+	}
+	return e
+}
+
+// livePost resolves a post's title and slug, caching them for the lifetime
+// of the stream.
+func (h *MetricsHandler) livePost(ctx context.Context, cache map[int64]*model.Post, id int64) *model.Post {
+	if p, ok := cache[id]; ok {
+		return p
+	}
+	ctx, cancel := context.WithTimeout(ctx, livePostTimeout)
+	defer cancel()
+	p, err := h.posts.GetByID(ctx, id)
+	if err != nil {
+		p = &model.Post{ID: id, Title: fmt.Sprintf("Post #%d", id)}
+	}
+	cache[id] = p
+	return p
+}
+
+// writeEvent sends one SSE event and flushes it, reporting false once the
+// client has gone away.
+func writeEvent(w *bufio.Writer, event string, data interface{}) bool {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return false
+	}
+	return w.Flush() == nil
+}
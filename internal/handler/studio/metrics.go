@@ -1,6 +1,10 @@
 package studio
 
 import (
+	"bytes"
+	"fmt"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/service"
@@ -8,29 +12,152 @@ import (
 
 type MetricsHandler struct {
 	analytics *service.AnalyticsService
+	posts     *service.PostService
 }
 
-func NewMetricsHandler(analytics *service.AnalyticsService) *MetricsHandler {
-	return &MetricsHandler{analytics: analytics}
+func NewMetricsHandler(analytics *service.AnalyticsService, posts *service.PostService) *MetricsHandler {
+	return &MetricsHandler{analytics: analytics, posts: posts}
 }
 
 func (h *MetricsHandler) Handle(c *fiber.Ctx) error {
 	user := c.Locals("user").(*model.AdminUser)
 
-	totalViews, _ := h.analytics.TotalViews()
-	todayViews, _ := h.analytics.TotalViewsToday()
-	totalPosts, _ := h.analytics.TotalPublishedPosts()
-	postMetrics, _ := h.analytics.GetPostMetrics()
-	recentViews, _ := h.analytics.GetRecentViews(30)
+	dateRange, err := parseDateRange(c)
+	if err != nil {
+		return err
+	}
+	f := dateRange.Filter(0)
+	ctx := c.UserContext()
+
+	totalViews, err := h.analytics.TotalViews(ctx)
+	if err != nil {
+		return err
+	}
+	todayViews, err := h.analytics.TotalViewsToday(ctx)
+	if err != nil {
+		return err
+	}
+	totalPosts, err := h.analytics.TotalPublishedPosts(ctx)
+	if err != nil {
+		return err
+	}
+	rangeTotals, err := h.analytics.GetViewTotals(ctx, f)
+	if err != nil {
+		return err
+	}
+	postMetrics, err := h.analytics.GetPostMetrics(ctx, f)
+	if err != nil {
+		return err
+	}
+	dailyViews, err := h.analytics.GetDailyViews(ctx, dateRange, 0)
+	if err != nil {
+		return err
+	}
+	channels, err := h.analytics.ViewsByChannel(ctx, f)
+	if err != nil {
+		return err
+	}
+	referrers, err := h.analytics.TopReferrers(ctx, f, 10)
+	if err != nil {
+		return err
+	}
+	campaigns, err := h.analytics.TopCampaigns(ctx, f, 10)
+	if err != nil {
+		return err
+	}
+	postSources, err := h.analytics.GetPostSourceMetrics(ctx, f)
+	if err != nil {
+		return err
+	}
+	engagement, err := h.analytics.GetPostEngagement(ctx, f)
+	if err != nil {
+		return err
+	}
 
 	return c.Render("studio/metrics", fiber.Map{
 		"Title":       "Metrics",
 		"Section":     "metrics",
 		"User":        user,
+		"Range":       dateRange,
+		"Presets":     service.DateRangePresets(time.Now()),
 		"TotalViews":  totalViews,
 		"TodayViews":  todayViews,
 		"TotalPosts":  totalPosts,
+		"RangeTotals": rangeTotals,
 		"PostMetrics": postMetrics,
-		"RecentViews": recentViews,
+		"DailyViews":  dailyViews,
+		"Channels":    channels,
+		"Referrers":   referrers,
+		"Campaigns":   campaigns,
+		"PostSources": postSources,
+		"Engagement":  engagement,
+		"Pipeline":    h.analytics.Stats(),
+	}, "layouts/studio")
+}
+
+// Post shows the analytics of a single post for the selected date range,
+// compared against the previous period of the same length.
+func (h *MetricsHandler) Post(c *fiber.Ctx) error {
+	user := c.Locals("user").(*model.AdminUser)
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.posts.GetByID(c.UserContext(), id)
+	if err != nil {
+		return err
+	}
+
+	dateRange, err := parseDateRange(c)
+	if err != nil {
+		return err
+	}
+	report, err := h.analytics.GetPostReport(c.UserContext(), post.ID, dateRange)
+	if err != nil {
+		return err
+	}
+
+	return c.Render("studio/metrics_post", fiber.Map{
+		"Title":   "Metrics · " + post.Title,
+		"Section": "metrics",
+		"User":    user,
+		"Post":    post,
+		"Range":   dateRange,
+		"Presets": service.DateRangePresets(time.Now()),
+		"Report":  report,
 	}, "layouts/studio")
 }
+
+// Export downloads one analytics dataset (?dataset=posts|daily|views) for the
+// selected range as CSV or JSON (?format=csv|json).
+func (h *MetricsHandler) Export(c *fiber.Ctx) error {
+	dateRange, err := parseDateRange(c)
+	if err != nil {
+		return err
+	}
+	dataset := c.Query("dataset", service.ExportPosts)
+	format := c.Query("format", service.FormatCSV)
+
+	var buf bytes.Buffer
+	if err := h.analytics.Export(c.UserContext(), &buf, dataset, format, dateRange); err != nil {
+		return err
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == service.FormatJSON {
+		contentType = fiber.MIMEApplicationJSONCharsetUTF8
+	}
+	filename := fmt.Sprintf("analytics-%s-%s_%s.%s", dataset,
+		dateRange.From.Format("2006-01-02"), dateRange.To.Format("2006-01-02"), format)
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(buf.Bytes())
+}
+
+// parseDateRange reads the from/to query parameters shared by the metrics pages.
+func parseDateRange(c *fiber.Ctx) (model.DateRange, error) {
+	return service.ParseDateRange(c.Query("from"), c.Query("to"), time.Now())
+}
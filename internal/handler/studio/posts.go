@@ -2,9 +2,11 @@ package studio
 
 import (
 	"errors"
+	"net/url"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
 	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/service"
 )
@@ -18,9 +20,34 @@ func NewPostsHandler(posts *service.PostService, media *service.MediaService) *P
 	return &PostsHandler{posts: posts, media: media}
 }
 
+// postsPerPage is the number of posts on each page of the post list.
+const postsPerPage = 25
+
+// postSorts are the orders offered on the post list, the first being the
+// default.
+var postSorts = []struct{ Value, Label string }{
+	{model.SortNewest, "Newest first"},
+	{model.SortOldest, "Oldest first"},
+	{model.SortUpdated, "Recently edited"},
+	{model.SortPublished, "Recently published"},
+	{model.SortTitle, "Title"},
+}
+
 func (h *PostsHandler) List(c *fiber.Ctx) error {
 	user := c.Locals("user").(*model.AdminUser)
-	posts, err := h.posts.ListAll()
+	q := model.PostQuery{Status: c.Query("status"), Sort: postSorts[0].Value, Limit: postsPerPage}
+	if q.Status != "draft" && q.Status != "published" {
+		q.Status = ""
+	}
+	for _, s := range postSorts {
+		if c.Query("sort") == s.Value {
+			q.Sort = s.Value
+		}
+	}
+	if err := service.SetCursor(&q, c.Query("after"), c.Query("before")); err != nil {
+		return err
+	}
+	page, err := h.posts.ListPage(c.UserContext(), q)
 	if err != nil {
 		return err
 	}
@@ -28,10 +55,33 @@ func (h *PostsHandler) List(c *fiber.Ctx) error {
 		"Title":   "All Posts",
 		"Section": "posts",
 		"User":    user,
-		"Posts":   posts,
+		"Posts":   page.Posts,
+		"Status":  q.Status,
+		"Sort":    q.Sort,
+		"Sorts":   postSorts,
+		// An empty page isn't an empty blog when filtered or paged.
+		"Filtered": q.Status != "" || q.After != nil || q.Before != nil,
+		"PrevURL":  postsListURL(q, "before", page.Prev),
+		"NextURL":  postsListURL(q, "after", page.Next),
 	}, "layouts/studio")
 }
 
+// postsListURL links to the page of the post list at cursor, keeping the
+// filter and order of q, or returns "" if cursor is nil.
+func postsListURL(q model.PostQuery, param string, cursor *model.PostCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	v := url.Values{param: {service.EncodeCursor(cursor)}}
+	if q.Status != "" {
+		v.Set("status", q.Status)
+	}
+	if q.Sort != postSorts[0].Value {
+		v.Set("sort", q.Sort)
+	}
+	return "/studio/posts?" + v.Encode()
+}
+
 func (h *PostsHandler) New(c *fiber.Ctx) error {
 	user := c.Locals("user").(*model.AdminUser)
 	return c.Render("studio/post_editor", fiber.Map{
@@ -53,6 +103,7 @@ func (h *PostsHandler) Create(c *fiber.Ctx) error {
 		CoverImage: c.FormValue("cover_image"),
 		Category:   c.FormValue("category"),
 		Tags:       c.FormValue("tags"),
+		HideTOC:    c.FormValue("hide_toc") == "1",
 	}
 
 	if input.Title == "" {
@@ -66,13 +117,19 @@ func (h *PostsHandler) Create(c *fiber.Ctx) error {
 		}, "layouts/studio")
 	}
 
-	post, err := h.posts.Create(input)
+	post, err := h.posts.Create(c.UserContext(), input)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).Render("studio/post_editor", fiber.Map{
+		// Keep the draft on screen for errors the author can fix; the
+		// editor's autosave covers the rest.
+		e := apperr.From(err)
+		if e.Status >= fiber.StatusInternalServerError {
+			return err
+		}
+		return c.Status(e.Status).Render("studio/post_editor", fiber.Map{
 			"Title":      "New Post",
 			"Section":    "posts",
 			"User":       user,
-			"Error":      "Failed to create post.",
+			"Error":      e.Message,
 			"Input":      input,
 			"LoadEditor": true,
 		}, "layouts/studio")
@@ -85,13 +142,10 @@ func (h *PostsHandler) Edit(c *fiber.Ctx) error {
 	user := c.Locals("user").(*model.AdminUser)
 	id, err := parseID(c)
 	if err != nil {
-		return fiber.ErrBadRequest
+		return err
 	}
 
-	post, err := h.posts.GetByID(id)
-	if errors.Is(err, service.ErrNotFound) {
-		return fiber.ErrNotFound
-	}
+	post, err := h.posts.GetByID(c.UserContext(), id)
 	if err != nil {
 		return err
 	}
@@ -118,7 +172,7 @@ func (h *PostsHandler) Update(c *fiber.Ctx) error {
 	user := c.Locals("user").(*model.AdminUser)
 	id, err := parseID(c)
 	if err != nil {
-		return fiber.ErrBadRequest
+		return err
 	}
 
 	input := service.PostInput{
@@ -128,10 +182,11 @@ func (h *PostsHandler) Update(c *fiber.Ctx) error {
 		CoverImage: c.FormValue("cover_image"),
 		Category:   c.FormValue("category"),
 		Tags:       c.FormValue("tags"),
+		HideTOC:    c.FormValue("hide_toc") == "1",
 	}
 
 	if input.Title == "" {
-		post, _ := h.posts.GetByID(id)
+		post, _ := h.posts.GetByID(c.UserContext(), id)
 		return c.Status(fiber.StatusUnprocessableEntity).Render("studio/post_editor", fiber.Map{
 			"Title":      "Edit Post",
 			"Section":    "posts",
@@ -142,10 +197,7 @@ func (h *PostsHandler) Update(c *fiber.Ctx) error {
 		}, "layouts/studio")
 	}
 
-	_, err = h.posts.Update(id, input)
-	if errors.Is(err, service.ErrNotFound) {
-		return fiber.ErrNotFound
-	}
+	_, err = h.posts.Update(c.UserContext(), id, input)
 	if err != nil {
 		return err
 	}
@@ -156,9 +208,9 @@ func (h *PostsHandler) Update(c *fiber.Ctx) error {
 func (h *PostsHandler) Delete(c *fiber.Ctx) error {
 	id, err := parseID(c)
 	if err != nil {
-		return fiber.ErrBadRequest
+		return err
 	}
-	if err := h.posts.Delete(id); err != nil && !errors.Is(err, service.ErrNotFound) {
+	if err := h.posts.Delete(c.UserContext(), id); err != nil && !errors.Is(err, service.ErrNotFound) {
 		return err
 	}
 	return c.Redirect("/studio/posts", fiber.StatusSeeOther)
@@ -167,9 +219,9 @@ func (h *PostsHandler) Delete(c *fiber.Ctx) error {
 func (h *PostsHandler) Publish(c *fiber.Ctx) error {
 	id, err := parseID(c)
 	if err != nil {
-		return fiber.ErrBadRequest
+		return err
 	}
-	if err := h.posts.Publish(id); err != nil && !errors.Is(err, service.ErrNotFound) {
+	if err := h.posts.Publish(c.UserContext(), id); err != nil && !errors.Is(err, service.ErrNotFound) {
 		return err
 	}
 	return c.Redirect("/studio/posts/"+strconv.FormatInt(id, 10)+"/edit", fiber.StatusSeeOther)
@@ -178,9 +230,9 @@ func (h *PostsHandler) Publish(c *fiber.Ctx) error {
 func (h *PostsHandler) Unpublish(c *fiber.Ctx) error {
 	id, err := parseID(c)
 	if err != nil {
-		return fiber.ErrBadRequest
+		return err
 	}
-	if err := h.posts.Unpublish(id); err != nil && !errors.Is(err, service.ErrNotFound) {
+	if err := h.posts.Unpublish(c.UserContext(), id); err != nil && !errors.Is(err, service.ErrNotFound) {
 		return err
 	}
 	return c.Redirect("/studio/posts/"+strconv.FormatInt(id, 10)+"/edit", fiber.StatusSeeOther)
@@ -191,12 +243,12 @@ func (h *PostsHandler) Upload(c *fiber.Ctx) error {
 
 	fh, err := c.FormFile("file")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no file provided"})
+		return apperr.Wrap(err, errNoFile)
 	}
 
-	media, err := h.media.Upload(fh, user.ID)
+	media, err := h.media.Upload(c.UserContext(), fh, user.ID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(fiber.Map{
@@ -206,6 +258,15 @@ func (h *PostsHandler) Upload(c *fiber.Ctx) error {
 	})
 }
 
+var (
+	errInvalidID = apperr.New(fiber.StatusBadRequest, "The ID in the address is not a number.")
+	errNoFile    = apperr.New(fiber.StatusBadRequest, "No file was provided.")
+)
+
 func parseID(c *fiber.Ctx) (int64, error) {
-	return strconv.ParseInt(c.Params("id"), 10, 64)
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, apperr.Wrap(err, errInvalidID)
+	}
+	return id, nil
 }
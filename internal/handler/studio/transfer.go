@@ -0,0 +1,96 @@
+package studio
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+type TransferHandler struct {
+	transfer *service.TransferService
+}
+
+func NewTransferHandler(transfer *service.TransferService) *TransferHandler {
+	return &TransferHandler{transfer: transfer}
+}
+
+func (h *TransferHandler) Show(c *fiber.Ctx) error {
+	user := c.Locals("user").(*model.AdminUser)
+	return c.Render("studio/transfer", fiber.Map{
+		"Title":   "Import & Export",
+		"Section": "transfer",
+		"User":    user,
+	}, "layouts/studio")
+}
+
+// Export sends the site as a zip. It is written to a temporary file first
+// so that a failure still gets an error page, and streamed from there so
+// large media libraries don't sit in memory.
+func (h *TransferHandler) Export(c *fiber.Ctx) error {
+	f, err := os.CreateTemp("", "blog-export-*.zip")
+	if err != nil {
+		return err
+	}
+	os.Remove(f.Name()) // the open file stays readable until closed
+	if err := h.transfer.Export(c.UserContext(), f); err != nil {
+		f.Close()
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	filename := "blog-export-" + time.Now().UTC().Format("2006-01-02") + ".zip"
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendStream(f, int(size)) // closed by fasthttp once sent
+}
+
+func (h *TransferHandler) Import(c *fiber.Ctx) error {
+	user := c.Locals("user").(*model.AdminUser)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return apperr.Wrap(err, errNoFile)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.transfer.Import(c.UserContext(), fh.Filename, data, user.ID)
+	if err != nil {
+		e := apperr.From(err)
+		if e.Status >= fiber.StatusInternalServerError {
+			return err
+		}
+		return c.Status(e.Status).Render("studio/transfer", fiber.Map{
+			"Title":   "Import & Export",
+			"Section": "transfer",
+			"User":    user,
+			"Error":   e.Message,
+		}, "layouts/studio")
+	}
+	return c.Render("studio/transfer", fiber.Map{
+		"Title":   "Import & Export",
+		"Section": "transfer",
+		"User":    user,
+		"Result":  res,
+	}, "layouts/studio")
+}
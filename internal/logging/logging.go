@@ -0,0 +1,82 @@
+// Package logging configures the process-wide slog logger and carries the
+// request ID through context.Context, so every record logged with a request's
+// context can be correlated with its access log line and error page.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type ctxKey struct{}
+
+// Setup installs the default slog logger. format is "json" (the default) or
+// "text"; level is one of debug, info, warn or error. Output from the
+// standard log package is routed through the same handler by slog.SetDefault.
+func Setup(format, level string) {
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, format, level)))
+}
+
+// NewHandler builds the slog handler used by Setup.
+func NewHandler(w io.Writer, format, level string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+	var h slog.Handler
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return contextHandler{h}
+}
+
+func parseLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Fatal logs msg at error level and exits. It replaces log.Fatalf during
+// startup, before there is anything to shut down gracefully.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// contextHandler adds the request ID of the record's context, if any.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
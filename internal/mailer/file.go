@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes each message as an .eml file instead of sending it, for
+// development and offline installs. The files open in any mail client.
+type FileMailer struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+func (f *FileMailer) Send(msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o750); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	f.mu.Lock()
+	f.seq++
+	name := fmt.Sprintf("%s-%03d.eml", now.UTC().Format("20060102T150405Z"), f.seq)
+	f.mu.Unlock()
+
+	return os.WriteFile(filepath.Join(f.dir, name), msg.Bytes(now), 0o640)
+}
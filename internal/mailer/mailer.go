@@ -0,0 +1,70 @@
+// Package mailer sends plain-text email through interchangeable backends.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// New returns the mailer selected by cfg.Mailer: "file" (the default) or "smtp".
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mailer {
+	case "", "file":
+		return NewFileMailer(cfg.MailDir), nil
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, errors.New("mailer: SMTP_HOST must be set when MAILER=smtp")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword), nil
+	}
+	return nil, fmt.Errorf("mailer: unknown MAILER %q", cfg.Mailer)
+}
+
+// Bytes renders msg as an RFC 5322 message with CRLF line endings.
+func (m *Message) Bytes(date time.Time) []byte {
+	var b bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, headerSafe(v))
+	}
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// headerSafe strips line breaks so values can't inject extra headers.
+func headerSafe(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+func (m *Message) validate() error {
+	if m.From == "" || len(m.To) == 0 {
+		return errors.New("mailer: message needs a sender and at least one recipient")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer delivers messages through an SMTP relay. net/smtp upgrades to
+// STARTTLS when the server offers it and refuses to send credentials over an
+// unencrypted connection to a remote host.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+}
+
+func NewSMTPMailer(host string, port int, username, password string) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+	}
+}
+
+func (s *SMTPMailer) Send(msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	return smtp.SendMail(s.addr, auth, msg.From, msg.To, msg.Bytes(time.Now()))
+}
@@ -0,0 +1,653 @@
+// Package mathml converts LaTeX math, as written between dollar signs in
+// Markdown, to MathML, which browsers lay out themselves: no script, no
+// fonts to load, and nothing for a strict CSP to block.
+//
+// It covers the notation of study notes — scripts, fractions, roots,
+// accents, font styles, Greek letters and common symbols, big operators,
+// \left…\right delimiters and matrix, cases and aligned environments — not
+// all of TeX. A command it doesn't know is shown as an error in place, and
+// the rest of the formula still renders; so is whatever is nested more than
+// maxDepth levels deep.
+package mathml
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// maxDepth caps how deeply groups, scripts and commands may nest. Past it the
+// rest of the formula is shown as an error, so hostile input can't run the
+// parser out of stack or time.
+const maxDepth = 64
+
+// Convert returns tex as a <math> element, displayed as a block if display
+// is set. The source is kept as an annotation, for copying and for readers
+// that fall back to it.
+func Convert(tex string, display bool) string {
+	p := &parser{src: []rune(tex), display: display}
+	p.write("<math")
+	if display {
+		p.write(` display="block"`)
+	}
+	p.write("><semantics>")
+	p.row(func() bool { return false })
+	p.write(`<annotation encoding="application/x-tex">`)
+	p.write(html.EscapeString(tex))
+	p.write("</annotation></semantics></math>")
+	return string(p.out)
+}
+
+// parser writes the MathML of each atom to out as it goes. Wrapping an atom
+// that is already written, as scripts and rows do, inserts the opening tag
+// in place, which costs no more than the atom itself.
+type parser struct {
+	src     []rune
+	pos     int
+	display bool
+	out     []byte
+	depth   int
+}
+
+func (p *parser) write(s string) { p.out = append(p.out, s...) }
+
+// wrap puts the atom written from start onwards between open and close.
+func (p *parser) wrap(start int, open, close string) {
+	p.out = slices.Insert(p.out, start, []byte(open)...)
+	p.write(close)
+}
+
+// swap exchanges the adjacent output from a to b and from b to c.
+func (p *parser) swap(a, b, c int) {
+	first := slices.Clone(p.out[a:b])
+	copy(p.out[a:], p.out[b:c])
+	copy(p.out[a+c-b:], first)
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() rune { return p.peekAt(0) }
+
+func (p *parser) peekAt(i int) rune {
+	if p.pos+i >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+i]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// at reports whether the source continues with the control sequence cmd,
+// such as `\end`, not followed by another letter.
+func (p *parser) at(cmd string) bool {
+	rs := []rune(cmd)
+	if p.pos+len(rs) > len(p.src) || string(p.src[p.pos:p.pos+len(rs)]) != cmd {
+		return false
+	}
+	return !isLetter(p.peekAt(len(rs))) || !isLetter(rs[len(rs)-1])
+}
+
+// seq writes atoms, attaching scripts to the atom before them, until the
+// source ends or stop reports true, and returns how many it wrote.
+func (p *parser) seq(stop func() bool) int {
+	n := 0
+	last, limits := -1, false // where the last atom starts, and its limits
+	wraps := 0                // scripts and primes attached to it so far
+	for {
+		p.skipSpace()
+		if p.eof() || stop() {
+			return n
+		}
+		c := p.peek()
+		if (c == '^' || c == '_' || c == '\'') && wraps >= maxDepth {
+			// Each script nests the atom once more, as x^x^x…
+			p.write(errorAtom(string(p.src[p.pos:])))
+			p.pos = len(p.src)
+			return n + 1
+		}
+		switch c {
+		case '^', '_':
+			p.pos++
+			if last < 0 {
+				last = len(p.out)
+				p.write("<mrow></mrow>")
+				n++
+			}
+			p.scripts(last, limits, c)
+			limits = false
+			wraps++
+		case '\'':
+			primes := 0
+			for p.peek() == '\'' {
+				p.pos++
+				primes++
+			}
+			if last < 0 {
+				last = len(p.out)
+				p.write("<mrow></mrow>")
+				n++
+			}
+			p.wrap(last, "<msup>", "<mo>"+strings.Repeat("′", primes)+"</mo></msup>")
+			limits = false
+			wraps++
+		default:
+			start := len(p.out)
+			if l, ok := p.next(); ok {
+				last, limits, wraps = start, l, 0
+				n++
+			}
+		}
+	}
+}
+
+// row writes the atoms seq parses as one, wrapped in an mrow unless there
+// is exactly one.
+func (p *parser) row(stop func() bool) {
+	start := len(p.out)
+	if p.seq(stop) != 1 {
+		p.wrap(start, "<mrow>", "</mrow>")
+	}
+}
+
+// scripts parses the subscript or superscript after the atom written from
+// base onwards, and the other one if it follows, and attaches them to it.
+func (p *parser) scripts(base int, limits bool, first rune) {
+	a := len(p.out)
+	p.arg()
+	b := len(p.out)
+	sub, sup := first == '_', first == '^'
+	p.skipSpace()
+	switch {
+	case p.peek() == '^' && !sup:
+		p.pos++
+		p.arg()
+		sup = true
+	case p.peek() == '_' && !sub:
+		p.pos++
+		p.arg()
+		if sup {
+			p.swap(a, b, len(p.out)) // the subscript comes first
+		}
+		sub = true
+	}
+	tags := [3]string{"msub", "msup", "msubsup"}
+	if limits && p.display {
+		tags = [3]string{"munder", "mover", "munderover"}
+	}
+	var tag string
+	switch {
+	case !sup:
+		tag = tags[0]
+	case !sub:
+		tag = tags[1]
+	default:
+		tag = tags[2]
+	}
+	p.wrap(base, "<"+tag+">", "</"+tag+">")
+}
+
+// arg writes the argument of a command or script: a group, or a single
+// character or command.
+func (p *parser) arg() {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case p.eof():
+		p.write("<mrow></mrow>")
+		return
+	case c == '{':
+		p.group()
+		return
+	case isDigit(c):
+		p.pos++
+		p.write("<mn>" + string(c) + "</mn>")
+		return
+	}
+	if _, ok := p.next(); !ok {
+		p.write("<mrow></mrow>")
+	}
+}
+
+// group writes a braced group as a row.
+func (p *parser) group() {
+	p.pos++ // {
+	p.row(func() bool { return p.peek() == '}' })
+	if !p.eof() {
+		p.pos++
+	}
+}
+
+// rawGroup returns the source of a braced group, or of the next character
+// if there's no brace.
+func (p *parser) rawGroup() string {
+	start, end := p.rawSpan()
+	return string(p.src[start:end])
+}
+
+// rawSpan skips a braced group, or the next character if there's no brace,
+// and returns where its source starts and ends.
+func (p *parser) rawSpan() (start, end int) {
+	p.skipSpace()
+	if p.eof() {
+		return p.pos, p.pos
+	}
+	if p.peek() != '{' {
+		p.pos++
+		return p.pos - 1, p.pos
+	}
+	start, depth := p.pos+1, 0
+	for ; !p.eof(); p.pos++ {
+		switch p.peek() {
+		case '\\':
+			p.pos++ // skip the escaped character
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return start, p.pos - 1
+			}
+		}
+	}
+	return start, len(p.src)
+}
+
+// next writes one atom and reports whether its scripts go below and above
+// in display math, as on \sum. It reports false for ok, writing nothing, for
+// input that produces nothing, such as a style switch.
+func (p *parser) next() (limits, ok bool) {
+	if p.depth >= maxDepth {
+		p.write(errorAtom(string(p.src[p.pos:])))
+		p.pos = len(p.src)
+		return false, true
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	c := p.peek()
+	switch {
+	case c == '{':
+		p.group()
+		return false, true
+	case c == '}':
+		p.pos++
+		p.write(errorAtom("}"))
+		return false, true
+	case c == '&':
+		p.pos++ // outside a table
+		return false, false
+	case c == '\\':
+		return p.command()
+	case isDigit(c) || c == '.' && isDigit(p.peekAt(1)):
+		start := p.pos
+		for !p.eof() && (isDigit(p.peek()) || p.peek() == '.' && isDigit(p.peekAt(1))) {
+			p.pos++
+		}
+		p.write("<mn>" + string(p.src[start:p.pos]) + "</mn>")
+		return false, true
+	case unicode.IsLetter(c):
+		p.pos++
+		p.write("<mi>" + html.EscapeString(string(c)) + "</mi>")
+		return false, true
+	case c == '~':
+		p.pos++
+		p.write(space("0.25em"))
+		return false, true
+	}
+	p.pos++
+	switch c {
+	case '-':
+		p.write(operator("−"))
+	case '*':
+		p.write(operator("∗"))
+	default:
+		p.write(operator(string(c)))
+	}
+	return false, true
+}
+
+// command writes a control sequence and its arguments.
+func (p *parser) command() (limits, ok bool) {
+	p.pos++ // backslash
+	if p.eof() {
+		p.write(errorAtom(`\`))
+		return false, true
+	}
+	if c := p.peek(); !isLetter(c) {
+		p.pos++
+		switch c {
+		case ',':
+			p.write(space("0.1667em"))
+		case ':', '>':
+			p.write(space("0.2222em"))
+		case ';':
+			p.write(space("0.2778em"))
+		case ' ':
+			p.write(space("0.25em"))
+		case '!', '\\': // negative space; a line break outside a table
+			return false, false
+		case '{', '}', '$', '%', '&', '#', '_':
+			p.write(operator(string(c)))
+		case '|':
+			p.write(operator("‖"))
+		default:
+			p.write(errorAtom(`\` + string(c)))
+		}
+		return false, true
+	}
+	start := p.pos
+	for !p.eof() && isLetter(p.peek()) {
+		p.pos++
+	}
+	name := string(p.src[start:p.pos])
+
+	if s, ok := identifiers[name]; ok {
+		p.write("<mi>" + s + "</mi>")
+		return false, true
+	}
+	if s, ok := uprightIdentifiers[name]; ok {
+		p.write(`<mi mathvariant="normal">` + s + "</mi>")
+		return false, true
+	}
+	if s, ok := operators[name]; ok {
+		p.write(operator(s))
+		return false, true
+	}
+	if op, ok := bigOperators[name]; ok {
+		p.write("<mo>" + op.symbol + "</mo>")
+		return op.limits, true
+	}
+	if limits, ok := functions[name]; ok {
+		p.write("<mi>" + name + "</mi>")
+		return limits, true
+	}
+	if acc, ok := accents[name]; ok {
+		open, close := `<mover accent="true">`, "</mover>"
+		if acc.under {
+			open, close = `<munder accentunder="true">`, "</munder>"
+		}
+		mo := "<mo"
+		if acc.stretchy {
+			mo += ` stretchy="true"`
+		}
+		mo += ">" + acc.symbol + "</mo>"
+		p.write(open)
+		p.arg()
+		p.write(mo + close)
+		return false, true
+	}
+	if variant, ok := fonts[name]; ok {
+		p.styled(variant)
+		return false, true
+	}
+	if size, ok := bigDelimiters[name]; ok {
+		d := p.delimiter()
+		if d == "" {
+			return false, false
+		}
+		p.write(`<mo stretchy="true" minsize="` + size + `" maxsize="` + size + `">` + d + "</mo>")
+		return false, true
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		p.write("<mfrac>")
+		p.arg()
+		p.arg()
+		p.write("</mfrac>")
+	case "binom", "dbinom", "tbinom":
+		p.write(`<mrow><mo>(</mo><mfrac linethickness="0">`)
+		p.arg()
+		p.arg()
+		p.write("</mfrac><mo>)</mo></mrow>")
+	case "sqrt":
+		p.skipSpace()
+		if p.peek() != '[' {
+			p.write("<msqrt>")
+			p.arg()
+			p.write("</msqrt>")
+			break
+		}
+		p.pos++
+		index := len(p.out)
+		p.row(func() bool { return p.peek() == ']' })
+		if !p.eof() {
+			p.pos++
+		}
+		base := len(p.out)
+		p.arg()
+		p.swap(index, base, len(p.out)) // the base comes first
+		p.wrap(index, "<mroot>", "</mroot>")
+	case "overbrace":
+		p.write("<mover>")
+		p.arg()
+		p.write(`<mo stretchy="true">⏞</mo></mover>`)
+		return true, true
+	case "underbrace":
+		p.write("<munder>")
+		p.arg()
+		p.write(`<mo stretchy="true">⏟</mo></munder>`)
+		return true, true
+	case "text", "textrm", "textnormal", "mbox", "textup":
+		p.write("<mtext>" + html.EscapeString(unescapeText(p.rawGroup())) + "</mtext>")
+	case "operatorname":
+		p.write("<mi>" + html.EscapeString(p.rawGroup()) + "</mi>")
+	case "left":
+		p.write("<mrow>" + fence(p.delimiter()))
+		p.seq(func() bool { return p.at(`\right`) })
+		close := ""
+		if !p.eof() {
+			p.pos += len(`\right`)
+			close = p.delimiter()
+		}
+		p.write(fence(close) + "</mrow>")
+	case "right":
+		p.delimiter()
+		p.write(errorAtom(`\right without \left`))
+	case "begin":
+		p.environment(p.rawGroup())
+	case "end":
+		p.write(errorAtom(`\end{` + p.rawGroup() + `} without \begin`))
+	case "quad":
+		p.write(space("1em"))
+	case "qquad":
+		p.write(space("2em"))
+	case "color":
+		p.rawGroup()
+		return false, false
+	case "textcolor":
+		p.rawGroup()
+		p.arg()
+	case "displaystyle", "textstyle", "scriptstyle", "limits", "nolimits", "nonumber", "notag":
+		return false, false
+	default:
+		p.write(errorAtom(`\` + name))
+	}
+	return false, true
+}
+
+// delimiter parses the delimiter after \left, \right or \big, returning ""
+// for the invisible ".".
+func (p *parser) delimiter() string {
+	p.skipSpace()
+	if p.eof() {
+		return ""
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case '.':
+		return ""
+	case '\\':
+		if p.eof() {
+			return ""
+		}
+		if c := p.peek(); !isLetter(c) {
+			p.pos++
+			if c == '|' {
+				return "‖"
+			}
+			return html.EscapeString(string(c))
+		}
+		start := p.pos
+		for !p.eof() && isLetter(p.peek()) {
+			p.pos++
+		}
+		if d, ok := delimiters[string(p.src[start:p.pos])]; ok {
+			return d
+		}
+		return ""
+	}
+	return html.EscapeString(string(c))
+}
+
+// environment writes the body of \begin{name} up to its \end as a table.
+// Unknown environments are laid out as a plain matrix.
+func (p *parser) environment(name string) {
+	if name == "array" {
+		p.rawGroup() // column specification
+	}
+	start := len(p.out)
+	env := strings.TrimSuffix(name, "*")
+	d, fenced := matrixDelimiters[env]
+	if fenced {
+		p.write("<mrow>" + fence(d[0]))
+	}
+	p.write("<mtable")
+	switch env {
+	case "cases":
+		p.write(` columnalign="left left"`)
+	case "aligned", "align", "split", "alignat":
+		p.write(` columnalign="right left right left"`)
+	}
+	p.write(">")
+	end := func() {
+		p.write("</mtable>")
+		if fenced {
+			p.write(fence(d[1]) + "</mrow>")
+		}
+	}
+
+	rowStart, cells := len(p.out), 0
+	p.write("<mtr>")
+	for {
+		cell := len(p.out)
+		p.write("<mtd>")
+		p.row(func() bool { return p.peek() == '&' || p.at(`\\`) || p.at(`\end`) })
+		p.write("</mtd>")
+		cells++
+		switch {
+		case p.eof():
+			p.write("</mtr>")
+			end()
+			p.out = slices.Insert(p.out, start, []byte(errorAtom(`\begin{`+name+`} without \end`))...)
+			return
+		case p.peek() == '&':
+			p.pos++
+		case p.at(`\\`):
+			p.pos += 2
+			p.write("</mtr>")
+			rowStart, cells = len(p.out), 0
+			p.write("<mtr>")
+		default: // \end
+			p.pos += len(`\end`)
+			p.rawGroup()
+			if cells > 1 || string(p.out[cell:]) != "<mtd><mrow></mrow></mtd>" {
+				p.write("</mtr>")
+			} else {
+				p.out = p.out[:rowStart] // a trailing \\ leaves an empty row
+			}
+			end()
+			return
+		}
+	}
+}
+
+// styled writes the argument of a font command such as \mathbf. Letters and
+// digits are mapped to their styled Unicode characters, as browsers only
+// support the normal variant of MathML's mathvariant.
+func (p *parser) styled(variant string) {
+	start, end := p.rawSpan()
+	raw := p.src[start:end]
+	if slices.ContainsFunc(raw, func(r rune) bool { return strings.ContainsRune(`\{}^_`, r) }) {
+		// Not plain text: render it unstyled.
+		src, pos := p.src, p.pos
+		p.src, p.pos = p.src[:end], start
+		p.row(func() bool { return false })
+		p.src, p.pos = src, pos
+		return
+	}
+	first, n := len(p.out), 0
+	var letters []rune
+	flush := func() {
+		if len(letters) == 0 {
+			return
+		}
+		mi := "<mi>"
+		if variant == "normal" && len(letters) == 1 {
+			mi = `<mi mathvariant="normal">`
+		}
+		p.write(mi + html.EscapeString(string(letters)) + "</mi>")
+		n++
+		letters = nil
+	}
+	for _, r := range raw {
+		switch {
+		case unicode.IsSpace(r):
+		case isDigit(r):
+			flush()
+			p.write("<mn>" + string(styleRune(r, variant)) + "</mn>")
+			n++
+		case unicode.IsLetter(r):
+			letters = append(letters, styleRune(r, variant))
+		default:
+			flush()
+			p.write(operator(string(r)))
+			n++
+		}
+	}
+	flush()
+	if n != 1 {
+		p.wrap(first, "<mrow>", "</mrow>")
+	}
+}
+
+func operator(s string) string {
+	return "<mo>" + html.EscapeString(s) + "</mo>"
+}
+
+func fence(d string) string {
+	if d == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + d + "</mo>"
+}
+
+func space(width string) string {
+	return `<mspace width="` + width + `"></mspace>`
+}
+
+func errorAtom(s string) string {
+	return "<merror><mtext>" + html.EscapeString(s) + "</mtext></merror>"
+}
+
+// unescapeText resolves the escapes \text allows, such as \_ and \%.
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`_%$&#{} `, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isLetter(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }
+
+func isDigit(r rune) bool { return r >= '0' && r <= '9' }
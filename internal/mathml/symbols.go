@@ -0,0 +1,153 @@
+package mathml
+
+// identifiers are commands for letters and symbols rendered as <mi>.
+var identifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "ell": "ℓ", "hbar": "ℏ", "imath": "ı",
+	"jmath": "ȷ", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ", "wp": "℘", "emptyset": "∅",
+	"varnothing": "∅", "forall": "∀", "exists": "∃", "nexists": "∄", "top": "⊤", "bot": "⊥",
+	"angle": "∠", "triangle": "△", "square": "□", "prime": "′", "dagger": "†",
+}
+
+// uprightIdentifiers are the capital Greek letters, which TeX sets upright.
+var uprightIdentifiers = map[string]string{
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+// operators are commands for symbols rendered as <mo>.
+var operators = map[string]string{
+	"cdot": "⋅", "times": "×", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖", "otimes": "⊗", "odot": "⊙",
+	"setminus": "∖", "wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬",
+	"cup": "∪", "cap": "∩", "mid": "∣", "nmid": "∤", "parallel": "∥",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "ll": "≪", "gg": "≫",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝",
+	"prec": "≺", "succ": "≻", "preceq": "⪯", "succeq": "⪰", "perp": "⊥", "models": "⊨", "vdash": "⊢",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "supset": "⊃", "subseteq": "⊆",
+	"supseteq": "⊇", "subsetneq": "⊊", "supsetneq": "⊋",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "implies": "⟹", "impliedby": "⟸",
+	"iff": "⟺", "mapsto": "↦", "longrightarrow": "⟶", "longleftarrow": "⟵", "longmapsto": "⟼",
+	"uparrow": "↑", "downarrow": "↓", "hookrightarrow": "↪",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"lbrace": "{", "rbrace": "}", "vert": "|", "Vert": "‖", "colon": ":", "therefore": "∴", "because": "∵",
+}
+
+type bigOperator struct {
+	symbol string
+	limits bool
+}
+
+// bigOperators are the operators that grow in display math. Integrals keep
+// their limits to the side.
+var bigOperators = map[string]bigOperator{
+	"sum": {"∑", true}, "prod": {"∏", true}, "coprod": {"∐", true},
+	"bigcup": {"⋃", true}, "bigcap": {"⋂", true}, "bigvee": {"⋁", true}, "bigwedge": {"⋀", true},
+	"bigoplus": {"⨁", true}, "bigotimes": {"⨂", true},
+	"int": {"∫", false}, "iint": {"∬", false}, "iiint": {"∭", false}, "oint": {"∮", false},
+}
+
+// functions are the named functions set upright, and whether their scripts
+// go below and above in display math, as on \lim.
+var functions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false, "tanh": false,
+	"coth": false, "log": false, "ln": false, "lg": false, "exp": false, "arg": false, "deg": false,
+	"dim": false, "hom": false, "ker": false,
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true, "inf": true,
+	"det": true, "gcd": true, "Pr": true, "argmax": true, "argmin": true,
+}
+
+type accent struct {
+	symbol   string
+	stretchy bool
+	under    bool
+}
+
+var accents = map[string]accent{
+	"hat": {"^", false, false}, "widehat": {"^", true, false},
+	"tilde": {"~", false, false}, "widetilde": {"~", true, false},
+	"bar": {"¯", false, false}, "overline": {"‾", true, false},
+	"vec": {"→", false, false}, "overrightarrow": {"→", true, false}, "overleftarrow": {"←", true, false},
+	"dot": {"˙", false, false}, "ddot": {"¨", false, false},
+	"check": {"ˇ", false, false}, "breve": {"˘", false, false}, "acute": {"´", false, false}, "grave": {"`", false, false},
+	"underline": {"_", true, true},
+}
+
+// fonts maps font commands to the style of the characters they produce.
+var fonts = map[string]string{
+	"mathrm": "normal", "mathit": "italic", "mathbf": "bold", "boldsymbol": "bold-italic",
+	"bm": "bold-italic", "mathbb": "double-struck", "mathcal": "script", "mathscr": "script",
+	"mathfrak": "fraktur", "mathsf": "sans-serif", "mathtt": "monospace",
+}
+
+// bigDelimiters maps the sizing commands to the height they give the
+// delimiter after them.
+var bigDelimiters = map[string]string{
+	"big": "1.2em", "bigl": "1.2em", "bigr": "1.2em", "bigm": "1.2em",
+	"Big": "1.8em", "Bigl": "1.8em", "Bigr": "1.8em", "Bigm": "1.8em",
+	"bigg": "2.4em", "biggl": "2.4em", "biggr": "2.4em", "biggm": "2.4em",
+	"Bigg": "3em", "Biggl": "3em", "Biggr": "3em", "Biggm": "3em",
+}
+
+// delimiters are the commands allowed after \left and \right.
+var delimiters = map[string]string{
+	"langle": "⟨", "rangle": "⟩", "lbrace": "{", "rbrace": "}", "lvert": "|", "rvert": "|",
+	"vert": "|", "lVert": "‖", "rVert": "‖", "Vert": "‖", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "uparrow": "↑", "downarrow": "↓",
+}
+
+// matrixDelimiters are the brackets the matrix environments put around
+// their table.
+var matrixDelimiters = map[string][2]string{
+	"pmatrix": {"(", ")"}, "bmatrix": {"[", "]"}, "Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"}, "Vmatrix": {"‖", "‖"}, "cases": {"{", ""},
+}
+
+// alphabets gives where each style's capital A, small a and digit 0 start in
+// Unicode's Mathematical Alphanumeric Symbols; 0 means the style has none.
+var alphabets = map[string][3]rune{
+	"italic":        {0x1D434, 0x1D44E, 0},
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"bold-italic":   {0x1D468, 0x1D482, 0x1D7CE},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+	"fraktur":       {0x1D504, 0x1D51E, 0},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"sans-serif":    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	"monospace":     {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// letterlike are the styled letters Unicode encoded before the block, which
+// leaves holes where they would be.
+var letterlike = map[string]map[rune]rune{
+	"italic": {'h': 'ℎ'},
+	"script": {'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+		'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'},
+	"fraktur":       {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+	"double-struck": {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+}
+
+// styleRune returns r in the given style, or r itself if the style has no
+// such character.
+func styleRune(r rune, variant string) rune {
+	if s, ok := letterlike[variant][r]; ok {
+		return s
+	}
+	a, ok := alphabets[variant]
+	switch {
+	case !ok:
+	case r >= 'A' && r <= 'Z':
+		return a[0] + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return a[1] + r - 'a'
+	case r >= '0' && r <= '9' && a[2] != 0:
+		return a[2] + r - '0'
+	}
+	return r
+}
@@ -0,0 +1,236 @@
+// Package metrics collects request statistics and renders them, together
+// with values gathered at scrape time, in the Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric types of the text exposition format.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request duration
+// histogram.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Sample is one value of a collected metric. Labels are name/value pairs.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type collector struct {
+	name, help, kind string
+	collect          func() []Sample
+}
+
+type requestKey struct {
+	method, route, status string
+}
+
+type requestStats struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // per latencyBuckets, non-cumulative
+}
+
+// Registry records HTTP requests and holds the collectors evaluated on every
+// scrape. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	requests   map[requestKey]*requestStats
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{requests: make(map[requestKey]*requestStats)}
+}
+
+// Register adds a metric whose samples are computed by collect at scrape time.
+func (r *Registry) Register(name, help, kind string, collect func() []Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector{name: name, help: help, kind: kind, collect: collect})
+}
+
+// Value adapts a single unlabeled value for Register.
+func Value(fn func() float64) func() []Sample {
+	return func() []Sample { return []Sample{{Value: fn()}} }
+}
+
+// ObserveRequest records one handled request. route must be the route
+// pattern, not the raw path, to keep the number of series bounded.
+func (r *Registry) ObserveRequest(method, route string, status int, d time.Duration) {
+	key := requestKey{method: method, route: route, status: strconv.Itoa(status)}
+	secs := d.Seconds()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.requests[key]
+	if !ok {
+		st = &requestStats{buckets: make([]uint64, len(latencyBuckets))}
+		r.requests[key] = st
+	}
+	st.count++
+	st.sum += secs
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			st.buckets[i]++
+			break
+		}
+	}
+}
+
+// WriteTo renders every metric in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	r.mu.Lock()
+	keys := make([]requestKey, 0, len(r.requests))
+	for k := range r.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, c := keys[i], keys[j]
+		if a.route != c.route {
+			return a.route < c.route
+		}
+		if a.method != c.method {
+			return a.method < c.method
+		}
+		return a.status < c.status
+	})
+
+	header(&b, "http_requests_total", "HTTP requests handled, by method, route and status.", Counter)
+	for _, k := range keys {
+		line(&b, "http_requests_total", labels(k), float64(r.requests[k].count))
+	}
+	header(&b, "http_request_duration_seconds", "HTTP request latency, by method, route and status.", "histogram")
+	for _, k := range keys {
+		st := r.requests[k]
+		var cum uint64
+		for i, le := range latencyBuckets {
+			cum += st.buckets[i]
+			line(&b, "http_request_duration_seconds_bucket", append(labels(k), "le", formatFloat(le)), float64(cum))
+		}
+		line(&b, "http_request_duration_seconds_bucket", append(labels(k), "le", "+Inf"), float64(st.count))
+		line(&b, "http_request_duration_seconds_sum", labels(k), st.sum)
+		line(&b, "http_request_duration_seconds_count", labels(k), float64(st.count))
+	}
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		header(&b, c.name, c.help, c.kind)
+		for _, s := range c.collect() {
+			line(&b, c.name, s.Labels, s.Value)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func labels(k requestKey) []string {
+	return []string{"method", k.method, "route", k.route, "status", k.status}
+}
+
+func header(b *strings.Builder, name, help, kind string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func line(b *strings.Builder, name string, labels []string, v float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// RegisterDBStats exposes the connection pool statistics of each pool,
+// labelled by the pool's name.
+func RegisterDBStats(r *Registry, pools map[string]*sql.DB) {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	perPool := func(f func(sql.DBStats) float64) func() []Sample {
+		return func() []Sample {
+			samples := make([]Sample, 0, len(names))
+			for _, name := range names {
+				samples = append(samples, Sample{Labels: []string{"pool", name}, Value: f(pools[name].Stats())})
+			}
+			return samples
+		}
+	}
+
+	r.Register("sql_db_max_open_connections", "Maximum number of open database connections.", Gauge,
+		perPool(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	r.Register("sql_db_connections", "Database connections by state.", Gauge, func() []Sample {
+		var samples []Sample
+		for _, name := range names {
+			s := pools[name].Stats()
+			samples = append(samples,
+				Sample{Labels: []string{"pool", name, "state", "in_use"}, Value: float64(s.InUse)},
+				Sample{Labels: []string{"pool", name, "state", "idle"}, Value: float64(s.Idle)},
+			)
+		}
+		return samples
+	})
+	r.Register("sql_db_wait_count_total", "Connections waited for because the pool was exhausted.", Counter,
+		perPool(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	r.Register("sql_db_wait_duration_seconds_total", "Total time spent waiting for a connection.", Counter,
+		perPool(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
+
+// RegisterRuntime exposes basic Go runtime figures.
+func RegisterRuntime(r *Registry) {
+	r.Register("go_goroutines", "Number of goroutines.", Gauge,
+		Value(func() float64 { return float64(runtime.NumGoroutine()) }))
+	r.Register("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", Gauge, Value(func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	}))
+}
@@ -15,6 +15,8 @@ func RecordViewMiddleware(analyticsSvc *service.AnalyticsService) func(postID in
 	return func(postID int64, c *fiber.Ctx) {
 		ip := c.IP()
 		ua := string(c.Request().Header.UserAgent())
-		go analyticsSvc.RecordView(postID, ip, ua)
+		src := service.NewTrafficSource(c.Get(fiber.HeaderReferer), c.Hostname(),
+			c.Query("utm_source"), c.Query("utm_medium"), c.Query("utm_campaign"))
+		go analyticsSvc.RecordView(c.UserContext(), postID, ip, ua, src)
 	}
 }
@@ -18,7 +18,7 @@ func RequireAuth(authSvc *service.AuthService) fiber.Handler {
 			return c.Redirect("/studio/login", fiber.StatusSeeOther)
 		}
 
-		user, err := authSvc.Validate(sessionID)
+		user, err := authSvc.Validate(c.UserContext(), sessionID)
 		if err != nil {
 			if errors.Is(err, service.ErrSessionExpired) {
 				c.ClearCookie(SessionCookieName)
@@ -30,3 +30,17 @@ func RequireAuth(authSvc *service.AuthService) fiber.Handler {
 		return c.Next()
 	}
 }
+
+// LoadUser sets "user" in locals when the request carries a valid session
+// cookie. Unlike RequireAuth it never redirects, so it can wrap public routes
+// that only need to know whether the reader is signed in.
+func LoadUser(authSvc *service.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if sessionID := c.Cookies(SessionCookieName); sessionID != "" {
+			if user, err := authSvc.Validate(c.UserContext(), sessionID); err == nil {
+				c.Locals("user", user)
+			}
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+)
+
+// statusMessages are the user-facing messages for errors that carry only a
+// status, such as fiber's own 404 and 413.
+var statusMessages = map[int]string{
+	fiber.StatusBadRequest:            "The request could not be understood.",
+	fiber.StatusForbidden:             "You don't have access to this page.",
+	fiber.StatusNotFound:              "The page you're looking for doesn't exist.",
+	fiber.StatusMethodNotAllowed:      "This page doesn't support that kind of request.",
+	fiber.StatusConflict:              "The request conflicts with the current state of the resource.",
+	fiber.StatusRequestEntityTooLarge: "The upload is too large.",
+	fiber.StatusTooManyRequests:       "Too many requests. Please try again later.",
+}
+
+// errTimeout is reported for requests whose deadline (REQUEST_TIMEOUT)
+// passed while the database was still working.
+var errTimeout = apperr.New(fiber.StatusServiceUnavailable, "The server took too long to answer. Please try again.")
+
+// ErrorHandler is the application's fiber.ErrorHandler. It maps err to an
+// *apperr.Error, logs it with the request ID and answers with an error page,
+// or with RFC 9457 problem details for JSON clients (see wantsJSON).
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	e := toAppError(err)
+
+	if e.Status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(c.UserContext(), "request failed",
+			"method", c.Method(), "path", c.Path(), "status", e.Status, "error", err)
+	} else {
+		slog.DebugContext(c.UserContext(), "request rejected",
+			"method", c.Method(), "path", c.Path(), "status", e.Status, "error", err)
+	}
+
+	requestID, _ := c.Locals("requestID").(string)
+	title := http.StatusText(e.Status)
+	c.Status(e.Status)
+
+	if wantsJSON(c) {
+		return c.JSON(fiber.Map{
+			"type":       "about:blank",
+			"title":      title,
+			"status":     e.Status,
+			"detail":     e.Message,
+			"instance":   c.OriginalURL(),
+			"request_id": requestID,
+		}, "application/problem+json")
+	}
+
+	renderErr := c.Render("public/error", fiber.Map{
+		"Title":     title,
+		"Status":    e.Status,
+		"Message":   e.Message,
+		"RequestID": requestID,
+	}, "layouts/base")
+	if renderErr != nil {
+		slog.ErrorContext(c.UserContext(), "render error page", "error", renderErr)
+		return c.Status(e.Status).SendString(e.Message + " (request ID: " + requestID + ")")
+	}
+	return nil
+}
+
+// toAppError maps fiber's own errors to an *apperr.Error with the matching
+// status and expired request deadlines to 503; anything else goes through
+// apperr.From.
+func toAppError(err error) *apperr.Error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apperr.Wrap(err, errTimeout)
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		msg, ok := statusMessages[fe.Code]
+		if !ok {
+			msg = http.StatusText(fe.Code)
+		}
+		return &apperr.Error{Status: fe.Code, Message: msg, Err: err}
+	}
+	return apperr.From(err)
+}
+
+// wantsJSON reports whether the error should be returned as problem details:
+// the upload endpoint and /api routes always are, other routes when the
+// client prefers JSON over HTML.
+func wantsJSON(c *fiber.Ctx) bool {
+	path := c.Path()
+	if path == "/studio/upload" || strings.HasPrefix(path, "/api/") {
+		return true
+	}
+	return c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+)
+
+// RequestMetrics records the count and latency of every request by route
+// pattern. Requests that match no route are grouped under "unmatched".
+func RequestMetrics(reg *metrics.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		route, status := routeAndStatus(c, err)
+		reg.ObserveRequest(c.Method(), route, status, time.Since(start))
+		return err
+	}
+}
+
+// MetricsAuth guards the /metrics endpoint. A request is allowed when it
+// carries "Authorization: Bearer <METRICS_TOKEN>" or comes from an address in
+// METRICS_ALLOW_IPS. With neither configured, every request is refused: behind
+// a reverse proxy all clients would appear to come from the proxy's address,
+// so there is no safe default allowlist.
+func MetricsAuth(cfg *config.Config) fiber.Handler {
+	allow := parseAllowList(cfg.MetricsAllowIPs)
+	token := []byte(cfg.MetricsToken)
+
+	return func(c *fiber.Ctx) error {
+		if len(token) > 0 {
+			if got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok &&
+				subtle.ConstantTimeCompare([]byte(got), token) == 1 {
+				return c.Next()
+			}
+		}
+		if ip := net.ParseIP(c.IP()); ip != nil {
+			for _, n := range allow {
+				if n.Contains(ip) {
+					return c.Next()
+				}
+			}
+		}
+		return apperr.ErrForbidden
+	}
+}
+
+// parseAllowList accepts single IPs and CIDR ranges, skipping invalid entries.
+func parseAllowList(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			if ip := net.ParseIP(e); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		if _, n, err := net.ParseCIDR(e); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		slog.Warn("ignoring invalid METRICS_ALLOW_IPS entry", "entry", e)
+	}
+	return nets
+}
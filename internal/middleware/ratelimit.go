@@ -2,17 +2,27 @@ package middleware
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
 	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
 )
 
+var errTooManyAttempts = apperr.New(fiber.StatusTooManyRequests, "Too many sign-in attempts. Please try again later.")
+
 type RateLimiter struct {
 	mu      sync.Mutex
 	records map[string][]time.Time
 	max     int
 	window  time.Duration
+
+	rejected atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 func NewRateLimiter(cfg *config.Config) *RateLimiter {
@@ -20,6 +30,7 @@ func NewRateLimiter(cfg *config.Config) *RateLimiter {
 		records: make(map[string][]time.Time),
 		max:     cfg.RateLimitLogin,
 		window:  cfg.RateLimitWindow,
+		stop:    make(chan struct{}),
 	}
 	return rl
 }
@@ -29,11 +40,10 @@ func (rl *RateLimiter) Middleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		ip := c.IP()
 		if !rl.allow(ip) {
+			rl.rejected.Add(1)
 			retryAfter := int(rl.window.Seconds())
 			c.Set("Retry-After", intStr(retryAfter))
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "too many attempts — please try again later",
-			})
+			return errTooManyAttempts
 		}
 		return c.Next()
 	}
@@ -60,11 +70,16 @@ func (rl *RateLimiter) allow(ip string) bool {
 	return len(valid) <= rl.max
 }
 
-// Cleanup removes stale entries. Call in a background goroutine.
+// Cleanup removes stale entries until Stop is called. Call in a background goroutine.
 func (rl *RateLimiter) Cleanup() {
 	ticker := time.NewTicker(rl.window)
 	defer ticker.Stop()
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-rl.stop:
+			return
+		}
 		rl.mu.Lock()
 		cutoff := time.Now().Add(-rl.window)
 		for ip, timestamps := range rl.records {
@@ -84,6 +99,22 @@ func (rl *RateLimiter) Cleanup() {
 	}
 }
 
+// Rejected returns how many requests were refused since startup.
+func (rl *RateLimiter) Rejected() int64 {
+	return rl.rejected.Load()
+}
+
+// RegisterMetrics exposes the number of rejected requests.
+func (rl *RateLimiter) RegisterMetrics(r *metrics.Registry) {
+	r.Register("rate_limit_rejections_total", "Login attempts rejected by the rate limiter.", metrics.Counter,
+		metrics.Value(func() float64 { return float64(rl.Rejected()) }))
+}
+
+// Stop ends the Cleanup loop.
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.stop) })
+}
+
 func intStr(n int) string {
 	if n == 0 {
 		return "0"
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/mhtecdev/blog-ai/internal/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns every request an ID, reusing a well-formed X-Request-ID
+// set by a reverse proxy. The ID is echoed in the response header, stored in
+// c.Locals("requestID") and carried by c.UserContext() for logging.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		} else {
+			id = strings.Clone(id) // outlives the request buffer in logs
+		}
+		c.Set(RequestIDHeader, id)
+		c.Locals("requestID", id)
+		c.SetUserContext(logging.WithRequestID(c.UserContext(), id))
+		return c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog writes one structured log line per request.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		route, status := routeAndStatus(c, err)
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(c.UserContext(), level, "request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", route,
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"ip", c.IP(),
+		)
+		return err
+	}
+}
+
+// routeAndStatus returns the matched route pattern and the final status of a
+// request after c.Next returned err. Requests that matched no route are
+// reported as "unmatched".
+func routeAndStatus(c *fiber.Ctx, err error) (string, int) {
+	status := c.Response().StatusCode()
+	route := c.Route().Path
+	if err != nil {
+		// The error handler runs after the middleware and sets the final status.
+		status = toAppError(err).Status
+		// The router's own 404 ("Cannot GET /path") leaves the last
+		// middleware as the route; don't attribute it to that.
+		var fe *fiber.Error
+		if errors.As(err, &fe) && fe.Code == fiber.StatusNotFound && strings.HasPrefix(fe.Message, "Cannot ") {
+			route = "unmatched"
+		}
+	}
+	return route, status
+}
@@ -13,6 +13,7 @@ const (
 		"media-src 'self'; " +
 		"font-src 'self'; " +
 		"connect-src 'self'; " +
+		"frame-src https://www.youtube-nocookie.com; " +
 		"frame-ancestors 'none'; " +
 		"base-uri 'self'; " +
 		"form-action 'self'"
@@ -21,6 +22,7 @@ const (
 		"img-src * data: blob:; " +
 		"media-src *; " +
 		"connect-src *; " +
+		"frame-src https://www.youtube-nocookie.com; " +
 		"frame-ancestors 'none'"
 )
 
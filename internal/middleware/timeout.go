@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestTimeout gives every request a deadline of d on c.UserContext().
+// Handlers pass that context to services and repositories, so a slow query is
+// cancelled instead of holding a connection past the point the client gave up.
+// Responses streamed after the handler returns (SSE) must not use it.
+func RequestTimeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if d <= 0 {
+			return c.Next()
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), d)
+		defer cancel()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
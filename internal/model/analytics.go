@@ -1,23 +1,243 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type PageView struct {
-	ID        int64
-	PostID    int64
-	IPHash    string
-	UserAgent string
-	ViewedAt  time.Time
+	ID             int64
+	PostID         int64
+	IPHash         string
+	UserAgent      string
+	Source         TrafficSource
+	ViewToken      string // random token reading beacons report against
+	MaxDepth       int    // deepest scroll milestone reached: 0, 25, 50, 75 or 100
+	EngagedSeconds int
+	ViewedAt       time.Time
 }
 
+// TrafficSource describes where a page view came from.
+type TrafficSource struct {
+	ReferrerDomain string // e.g. "linkedin.com"; empty for direct visits
+	Channel        string // one of the Channel* constants
+	UTMSource      string
+	UTMMedium      string
+	UTMCampaign    string
+}
+
+// Channel groups used to normalize referrers.
+const (
+	ChannelDirect    = "direct"
+	ChannelSearch    = "search"
+	ChannelSocial    = "social"
+	ChannelDeveloper = "developer"
+	ChannelEmail     = "email"
+	ChannelPaid      = "paid"
+	ChannelCampaign  = "campaign"
+	ChannelReferral  = "referral"
+	ChannelInternal  = "internal"
+)
+
 type PostMetric struct {
-	PostID    int64
-	Title     string
-	Slug      string
-	ViewCount int64
+	PostID         int64
+	Title          string
+	Slug           string
+	ViewCount      int64
+	UniqueVisitors int64 // distinct daily visitor hashes
 }
 
 type DailyCount struct {
 	Day   string // "2006-01-02"
 	Count int64
 }
+
+// LabelCount is a generic (label, count) pair used for ranked breakdowns
+// such as top referrers or channels.
+type LabelCount struct {
+	Label string
+	Count int64
+}
+
+type CampaignMetric struct {
+	Source   string
+	Medium   string
+	Campaign string
+	Count    int64
+}
+
+// PostSourceMetric breaks a post's views down by channel.
+type PostSourceMetric struct {
+	PostID   int64
+	Title    string
+	Slug     string
+	Total    int64
+	Channels []*LabelCount // sorted by count, descending
+}
+
+// PostEngagement summarizes how far and how long readers read a post.
+type PostEngagement struct {
+	PostID        int64
+	Title         string
+	Slug          string
+	Views         int64
+	Reached25     int64
+	Reached50     int64
+	Reached75     int64
+	Reached100    int64
+	MedianSeconds float64 // median engaged time over views that reported any
+}
+
+// ReadThroughRate is the percentage of views that scrolled to the end of the post.
+func (e *PostEngagement) ReadThroughRate() float64 {
+	if e.Views == 0 {
+		return 0
+	}
+	return float64(e.Reached100) * 100 / float64(e.Views)
+}
+
+// MedianReadingTime formats MedianSeconds as "m:ss".
+func (e *PostEngagement) MedianReadingTime() string {
+	secs := int(e.MedianSeconds + 0.5)
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+// AnalyticsFilter narrows analytics queries to a range of UTC days and,
+// optionally, a single post. Zero values mean "no restriction".
+type AnalyticsFilter struct {
+	From   string // "2006-01-02", inclusive
+	To     string // "2006-01-02", inclusive
+	PostID int64
+}
+
+// DateRange is an inclusive range of UTC days.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Days returns the number of days in the range, counting both ends.
+func (r DateRange) Days() int {
+	return int(r.To.Sub(r.From).Hours()/24) + 1
+}
+
+// Previous returns the range of the same length ending the day before r.
+func (r DateRange) Previous() DateRange {
+	to := r.From.AddDate(0, 0, -1)
+	return DateRange{From: to.AddDate(0, 0, -(r.Days() - 1)), To: to}
+}
+
+// Filter converts the range into an AnalyticsFilter for postID (0 = all posts).
+func (r DateRange) Filter(postID int64) AnalyticsFilter {
+	return AnalyticsFilter{From: r.From.Format("2006-01-02"), To: r.To.Format("2006-01-02"), PostID: postID}
+}
+
+// RangePreset is a named shortcut for the date range selector.
+type RangePreset struct {
+	Label string
+	From  string
+	To    string
+}
+
+// ViewTotals are the headline numbers for a filtered period.
+type ViewTotals struct {
+	Views    int64
+	Visitors int64
+}
+
+// PostReport is everything the per-post analytics page shows for one period.
+type PostReport struct {
+	Range      DateRange
+	Totals     ViewTotals
+	Previous   ViewTotals // same-length period right before Range
+	Daily      []*DailyCount
+	Channels   []*LabelCount
+	Referrers  []*LabelCount
+	Campaigns  []*CampaignMetric
+	Engagement *PostEngagement // nil when the post has no views in range
+}
+
+// ViewsChange is the percentage change in views against the previous period.
+// It returns 0 when the previous period had no views.
+func (r *PostReport) ViewsChange() float64 {
+	return percentChange(r.Previous.Views, r.Totals.Views)
+}
+
+// VisitorsChange is the percentage change in unique visitors.
+func (r *PostReport) VisitorsChange() float64 {
+	return percentChange(r.Previous.Visitors, r.Totals.Visitors)
+}
+
+func percentChange(before, after int64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return float64(after-before) * 100 / float64(before)
+}
+
+// ExportedView is a raw page view as included in analytics exports. Visitor
+// hashes and user agents are deliberately left out.
+type ExportedView struct {
+	ViewedAt       string
+	PostID         int64
+	Slug           string
+	Source         TrafficSource
+	MaxDepth       int
+	EngagedSeconds int
+}
+
+// Digest is the weekly analytics summary sent by email.
+type Digest struct {
+	Range    DateRange
+	Totals   ViewTotals
+	Previous ViewTotals
+	Posts    []*DigestPost // top posts of the period, by views
+}
+
+// ViewsChange is the percentage change in views against the previous period.
+func (d *Digest) ViewsChange() float64 {
+	return percentChange(d.Previous.Views, d.Totals.Views)
+}
+
+// VisitorsChange is the percentage change in unique visitors.
+func (d *Digest) VisitorsChange() float64 {
+	return percentChange(d.Previous.Visitors, d.Totals.Visitors)
+}
+
+type DigestPost struct {
+	Title         string
+	Slug          string
+	Views         int64
+	PreviousViews int64
+}
+
+// Change is the percentage change in views against the previous period.
+func (p *DigestPost) Change() float64 {
+	return percentChange(p.PreviousViews, p.Views)
+}
+
+// LiveView is a recorded page view as streamed to the live dashboard.
+type LiveView struct {
+	PostID         int64
+	Channel        string
+	ReferrerDomain string
+	ViewedAt       time.Time
+}
+
+// LiveReaders is the number of visitors active on a post within the live window.
+type LiveReaders struct {
+	PostID  int64
+	Readers int
+}
+
+// PipelineStats counts analytics events since startup. Queued events end up
+// written, deduplicated or failed; dropped events never entered the queue.
+type PipelineStats struct {
+	Queued        int64
+	Written       int64
+	Deduplicated  int64
+	Dropped       int64 // queue full or service closed
+	Failed        int64 // database errors
+	QueueDepth    int
+	QueueCapacity int
+}
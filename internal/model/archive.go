@@ -0,0 +1,51 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ArchiveMonth is a month, in UTC, in which posts were published.
+type ArchiveMonth struct {
+	Year  int
+	Month time.Month
+	Count int // posts published in the month
+}
+
+// Label returns the month as "March 2024".
+func (m ArchiveMonth) Label() string {
+	return m.Month.String() + " " + strconv.Itoa(m.Year)
+}
+
+// Path returns the path of the month's archive page.
+func (m ArchiveMonth) Path() string {
+	return ArchiveMonthPath(m.Year, m.Month)
+}
+
+// ArchiveYear is a year in which posts were published.
+type ArchiveYear struct {
+	Year   int
+	Count  int            // posts published in the year
+	Months []ArchiveMonth // latest first
+}
+
+// Path returns the path of the year's archive page.
+func (y ArchiveYear) Path() string {
+	return ArchiveYearPath(y.Year)
+}
+
+// MonthPosts is a month and some of the posts published in it, as listed on
+// the timeline; Count is still the month's total.
+type MonthPosts struct {
+	ArchiveMonth
+	Posts []*Post
+}
+
+func ArchiveYearPath(year int) string {
+	return fmt.Sprintf("/archive/%04d", year)
+}
+
+func ArchiveMonthPath(year int, month time.Month) string {
+	return fmt.Sprintf("/archive/%04d/%02d", year, int(month))
+}
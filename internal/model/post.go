@@ -1,28 +1,47 @@
 package model
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 type Post struct {
-	ID          int64
-	UUID        string
-	Title       string
-	Slug        string
-	Excerpt     string
-	ContentMD   string
-	ContentHTML string
-	CoverImage  string
-	Category    string
-	Tags        string // comma-separated
-	Status      string // "draft" or "published"
-	PublishedAt *time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID             int64
+	UUID           string
+	Title          string
+	Slug           string
+	Excerpt        string
+	ContentMD      string
+	ContentHTML    string
+	TOC            TOC  // headings of ContentMD
+	HideTOC        bool // the author turned the table of contents off
+	RenderVersion  int  // version of the Markdown pipeline ContentHTML and TOC come from
+	CoverImage     string
+	Category       string
+	Tags           string // comma-separated
+	Status         string // "draft" or "published"
+	WordCount      int    // words of ContentMD, without markup
+	ReadingMinutes int    // estimated from WordCount, rounded up; 0 for an empty post
+	PublishedAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
 
 func (p *Post) IsPublished() bool {
 	return p.Status == "published"
 }
 
+// ReadingTime returns the estimated reading time, such as "4 min read".
+func (p *Post) ReadingTime() string {
+	return strconv.Itoa(max(p.ReadingMinutes, 1)) + " min read"
+}
+
+// ShowTOC reports whether the post's page shows its table of contents: it
+// has at least MinTOCHeadings headings and the author didn't hide it.
+func (p *Post) ShowTOC() bool {
+	return !p.HideTOC && p.TOC.Len() >= MinTOCHeadings
+}
+
 func (p *Post) TagList() []string {
 	if p.Tags == "" {
 		return nil
@@ -60,3 +79,40 @@ func trim(s string) string {
 	}
 	return s
 }
+
+// Orders of the studio post list. Public lists always show the most
+// recently published posts first.
+const (
+	SortNewest    = "newest"    // most recently created first
+	SortOldest    = "oldest"    // first created first
+	SortUpdated   = "updated"   // most recently edited first
+	SortPublished = "published" // most recently published first, drafts last
+	SortTitle     = "title"     // A to Z
+)
+
+// PostQuery selects a page of posts. Zero values mean "no restriction".
+type PostQuery struct {
+	Status   string      // "draft" or "published"
+	Category string      // exact category
+	Sort     string      // one of the Sort constants; SortPublished if empty
+	After    *PostCursor // the page following this position
+	Before   *PostCursor // the page preceding this position; set After or Before, not both
+	Since    time.Time   // published at or after this time
+	Until    time.Time   // published before this time
+	Limit    int         // posts per page; 0 returns every post on one page
+}
+
+// PostCursor is a position in an ordered post list: the value the list is
+// sorted by and the post ID, which breaks ties.
+type PostCursor struct {
+	Key string
+	ID  int64
+}
+
+// PostPage is one page of a post list. Prev and Next are the positions to
+// ask for the neighbouring pages from, and nil at either end of the list.
+type PostPage struct {
+	Posts []*Post
+	Prev  *PostCursor
+	Next  *PostCursor
+}
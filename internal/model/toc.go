@@ -0,0 +1,27 @@
+package model
+
+// MinTOCHeadings is how many headings a post needs for its page to show a
+// table of contents; shorter posts are read at a glance.
+const MinTOCHeadings = 3
+
+// TOC is a post's table of contents: its top-level headings, each holding
+// the headings of its section.
+type TOC []TOCEntry
+
+// TOCEntry is a heading and the headings below it, up to the next heading
+// of its level or higher.
+type TOCEntry struct {
+	ID       string `json:"id"` // the heading's anchor
+	Text     string `json:"text"`
+	Level    int    `json:"level"` // 1 for <h1>, and so on
+	Children TOC    `json:"children,omitempty"`
+}
+
+// Len returns the number of headings in t, at every level.
+func (t TOC) Len() int {
+	n := len(t)
+	for _, e := range t {
+		n += e.Children.Len()
+	}
+	return n
+}
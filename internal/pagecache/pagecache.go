@@ -0,0 +1,257 @@
+// Package pagecache keeps rendered public pages in memory until a post
+// change makes them stale, and answers revalidation with 304 Not Modified.
+package pagecache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+// Cache-Control values. Pages are revalidated on every request, which the
+// ETag makes cheap; shared caches may keep the public ones.
+const (
+	Public  = "public, no-cache"
+	Private = "private, no-cache"
+)
+
+// Page is a rendered response.
+type Page struct {
+	Body        []byte
+	ContentType string
+	ETag        string
+	Value       any // handler data kept with the page, such as the post shown
+
+	key, path string
+}
+
+// NewPage returns a page for body with its ETag computed.
+func NewPage(body []byte, contentType string) *Page {
+	sum := sha256.Sum256(body)
+	return &Page{Body: body, ContentType: contentType, ETag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+}
+
+// Cache is a least-recently-used cache of rendered pages. A nil *Cache is
+// valid and caches nothing.
+type Cache struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *Page
+	lru     *list.List               // most recently used first
+	gen     uint64                   // bumped by every invalidation
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+}
+
+// New returns a cache of up to maxEntries pages, or nil if maxEntries is 0.
+func New(maxEntries int) *Cache {
+	if maxEntries <= 0 {
+		return nil
+	}
+	return &Cache{max: maxEntries, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Fill returns the page cached under key for path, or calls render and
+// caches what it returns. render may return a nil page for responses that
+// must not be cached. A page rendered while an invalidation ran isn't
+// stored, since it may show the state from before.
+func (c *Cache) Fill(key, path string, render func() (*Page, error)) (*Page, error) {
+	if c == nil {
+		return render()
+	}
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return el.Value.(*Page), nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	p, err := render()
+	if err != nil || p == nil {
+		return p, err
+	}
+	// Strings from fiber may alias the reused request buffer.
+	key, path = strings.Clone(key), strings.Clone(path)
+	p.key, p.path = key, path
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return p, nil
+	}
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(p)
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*Page).key)
+	}
+	return p, nil
+}
+
+// Invalidate drops every page cached for the given paths, whatever their
+// query strings.
+func (c *Cache) Invalidate(paths ...string) {
+	c.invalidate("", paths)
+}
+
+// invalidate drops the pages cached for paths and, unless prefix is empty,
+// for every path starting with prefix.
+func (c *Cache) invalidate(prefix string, paths []string) {
+	if c == nil {
+		return
+	}
+	drop := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		drop[p] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key, el := range c.entries {
+		path := el.Value.(*Page).path
+		if drop[path] || (prefix != "" && strings.HasPrefix(path, prefix)) {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+			c.invalidations.Add(1)
+		}
+	}
+}
+
+// PostChanged invalidates the pages a post change affects: every post page,
+// as any may list the post as related, the pages listing posts, and the
+// categories and archive months the post was and is in. Changes to drafts
+// affect nothing. Its signature matches service.PostService.OnChange.
+func (c *Cache) PostChanged(before, after *model.Post) {
+	if !published(before) && !published(after) {
+		return
+	}
+	paths := []string{"/", "/timeline", "/categories", "/feed.xml", "/sitemap.xml"}
+	for _, p := range []*model.Post{before, after} {
+		if p == nil {
+			continue
+		}
+		if p.Category != "" {
+			paths = append(paths, "/categories/"+p.Category, "/categories/"+p.Category+"/feed.xml")
+		}
+		if p.PublishedAt != nil {
+			t := p.PublishedAt.UTC()
+			paths = append(paths, model.ArchiveYearPath(t.Year()), model.ArchiveMonthPath(t.Year(), t.Month()))
+		}
+	}
+	c.invalidate("/posts/", paths)
+}
+
+func published(p *model.Post) bool {
+	return p != nil && p.IsPublished()
+}
+
+// Len returns the number of cached pages.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Send writes p with its ETag and cacheControl, or 304 Not Modified if the
+// client already has it.
+func Send(c *fiber.Ctx, p *Page, cacheControl string) error {
+	c.Set(fiber.HeaderCacheControl, cacheControl)
+	c.Set(fiber.HeaderETag, p.ETag)
+	if etagMatch(c.Get(fiber.HeaderIfNoneMatch), p.ETag) {
+		c.Response().ResetBody()
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Set(fiber.HeaderContentType, p.ContentType)
+	return c.Status(fiber.StatusOK).Send(p.Body)
+}
+
+// etagMatch reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires.
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Path returns the request path decoded, as pages are invalidated by it.
+func Path(c *fiber.Ctx) string {
+	p, err := url.PathUnescape(c.Path())
+	if err != nil {
+		return c.Path()
+	}
+	return p
+}
+
+// Middleware caches the 200 responses of GET requests to a public route,
+// keyed by path and query string. The route must answer every visitor alike.
+func (c *Cache) Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if c == nil || ctx.Method() != fiber.MethodGet || strings.HasPrefix(ctx.Path(), "/studio") {
+			return ctx.Next()
+		}
+		path := Path(ctx)
+		key := path
+		if q := ctx.Request().URI().QueryArgs(); q.Len() > 0 {
+			// Normalize the order so equal queries share an entry.
+			values, _ := url.ParseQuery(string(q.QueryString()))
+			key += "?" + values.Encode()
+		}
+
+		p, err := c.Fill(key, path, func() (*Page, error) {
+			if err := ctx.Next(); err != nil {
+				return nil, err
+			}
+			if ctx.Response().StatusCode() != fiber.StatusOK {
+				return nil, nil
+			}
+			return NewPage(bytes.Clone(ctx.Response().Body()), string(ctx.Response().Header.ContentType())), nil
+		})
+		if err != nil || p == nil {
+			return err
+		}
+		return Send(ctx, p, Public)
+	}
+}
+
+// RegisterMetrics exposes hits, misses, invalidations and the cache size.
+func (c *Cache) RegisterMetrics(r *metrics.Registry) {
+	if c == nil {
+		return
+	}
+	r.Register("page_cache_requests_total", "Requests for cacheable pages by cache result.", metrics.Counter, func() []metrics.Sample {
+		return []metrics.Sample{
+			{Labels: []string{"result", "hit"}, Value: float64(c.hits.Load())},
+			{Labels: []string{"result", "miss"}, Value: float64(c.misses.Load())},
+		}
+	})
+	r.Register("page_cache_invalidations_total", "Cached pages dropped because a post changed.", metrics.Counter,
+		metrics.Value(func() float64 { return float64(c.invalidations.Load()) }))
+	r.Register("page_cache_entries", "Pages in the cache.", metrics.Gauge,
+		metrics.Value(func() float64 { return float64(c.Len()) }))
+}
@@ -0,0 +1,148 @@
+package postio
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+type ghostExport struct {
+	DB []struct {
+		Data ghostData `json:"data"`
+	} `json:"db"`
+	Data *ghostData `json:"data"` // exports trimmed to the data object
+}
+
+type ghostData struct {
+	Posts []struct {
+		ID            string `json:"id"`
+		Title         string `json:"title"`
+		Slug          string `json:"slug"`
+		HTML          string `json:"html"`
+		Mobiledoc     string `json:"mobiledoc"`
+		Plaintext     string `json:"plaintext"`
+		FeatureImage  string `json:"feature_image"`
+		CustomExcerpt string `json:"custom_excerpt"`
+		Status        string `json:"status"`
+		Type          string `json:"type"`
+		Page          bool   `json:"page"` // Ghost 1.x–2.x
+		PublishedAt   string `json:"published_at"`
+		CreatedAt     string `json:"created_at"`
+		UpdatedAt     string `json:"updated_at"`
+	} `json:"posts"`
+	Tags []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"tags"`
+	PostsTags []struct {
+		PostID    string `json:"post_id"`
+		TagID     string `json:"tag_id"`
+		SortOrder int    `json:"sort_order"`
+	} `json:"posts_tags"`
+}
+
+// ParseGhost reads the posts of a Ghost JSON export. Pages are skipped and
+// counted in skipped. A post written as a single Markdown card keeps its
+// Markdown; others keep their HTML as the Markdown source. Ghost has no
+// categories, so the primary (first) tag becomes the category and every tag
+// is kept as a tag.
+func ParseGhost(r io.Reader) (posts []*model.Post, skipped int, err error) {
+	var export ghostExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, 0, err
+	}
+	data := export.Data
+	if len(export.DB) > 0 {
+		data = &export.DB[0].Data
+	}
+	if data == nil {
+		return nil, 0, errors.New("not a Ghost export: no db or data object")
+	}
+
+	tagNames := make(map[string]string, len(data.Tags))
+	for _, t := range data.Tags {
+		tagNames[t.ID] = t.Name
+	}
+	sort.SliceStable(data.PostsTags, func(i, j int) bool { return data.PostsTags[i].SortOrder < data.PostsTags[j].SortOrder })
+	postTags := make(map[string][]string)
+	for _, pt := range data.PostsTags {
+		if name := tagNames[pt.TagID]; name != "" {
+			postTags[pt.PostID] = append(postTags[pt.PostID], name)
+		}
+	}
+
+	for _, gp := range data.Posts {
+		if gp.Page || gp.Type == "page" {
+			skipped++
+			continue
+		}
+		p := &model.Post{
+			Title:      strings.TrimSpace(gp.Title),
+			Slug:       gp.Slug,
+			Excerpt:    gp.CustomExcerpt,
+			CoverImage: gp.FeatureImage,
+			Tags:       strings.Join(postTags[gp.ID], ", "),
+			Status:     "draft",
+		}
+		if tags := postTags[gp.ID]; len(tags) > 0 {
+			p.Category = tags[0]
+		}
+
+		switch md, ok := mobiledocMarkdown(gp.Mobiledoc); {
+		case ok:
+			p.ContentMD = md
+		case gp.HTML != "":
+			p.ContentMD = gp.HTML
+		default:
+			p.ContentMD = gp.Plaintext
+		}
+
+		if t, err := time.Parse(time.RFC3339, gp.CreatedAt); err == nil {
+			p.CreatedAt = t.UTC()
+		}
+		if t, err := time.Parse(time.RFC3339, gp.UpdatedAt); err == nil {
+			p.UpdatedAt = t.UTC()
+		}
+		// Scheduled posts and newsletters come in as drafts.
+		if gp.Status == "published" {
+			p.Status = "published"
+			if t, err := time.Parse(time.RFC3339, gp.PublishedAt); err == nil {
+				t = t.UTC()
+				p.PublishedAt = &t
+			}
+		}
+		posts = append(posts, p)
+	}
+	return posts, skipped, nil
+}
+
+// mobiledocMarkdown returns the source of a mobiledoc document that consists
+// of a single Markdown card, as posts written in Ghost's Markdown editor are.
+func mobiledocMarkdown(doc string) (string, bool) {
+	if doc == "" {
+		return "", false
+	}
+	var md struct {
+		Cards    [][]json.RawMessage `json:"cards"`
+		Sections [][]json.RawMessage `json:"sections"`
+	}
+	if err := json.Unmarshal([]byte(doc), &md); err != nil || len(md.Cards) != 1 || len(md.Sections) != 1 || len(md.Cards[0]) != 2 {
+		return "", false
+	}
+	var name string
+	var payload struct {
+		Markdown string `json:"markdown"`
+	}
+	if json.Unmarshal(md.Cards[0][0], &name) != nil || (name != "markdown" && name != "card-markdown") {
+		return "", false
+	}
+	if json.Unmarshal(md.Cards[0][1], &payload) != nil {
+		return "", false
+	}
+	return payload.Markdown, true
+}
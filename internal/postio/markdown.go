@@ -0,0 +1,204 @@
+// Package postio converts posts to and from the formats other blogs use:
+// Markdown files with YAML front matter, WordPress WXR and Ghost JSON.
+package postio
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+// WriteMarkdown writes p as a Markdown file whose YAML front matter holds
+// the post's metadata. ParseMarkdown reads it back.
+func WriteMarkdown(w io.Writer, p *model.Post) error {
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	field := func(key, value string) { fmt.Fprintf(&b, "%s: %s\n", key, value) }
+	field("title", quote(p.Title))
+	field("slug", quote(p.Slug))
+	field("excerpt", quote(p.Excerpt))
+	field("category", quote(p.Category))
+	tags := make([]string, 0, len(p.TagList()))
+	for _, t := range p.TagList() {
+		tags = append(tags, quote(t))
+	}
+	field("tags", "["+strings.Join(tags, ", ")+"]")
+	field("status", p.Status)
+	if p.PublishedAt != nil {
+		field("published_at", p.PublishedAt.UTC().Format(time.RFC3339))
+	}
+	field("created_at", p.CreatedAt.UTC().Format(time.RFC3339))
+	field("updated_at", p.UpdatedAt.UTC().Format(time.RFC3339))
+	field("cover", quote(p.CoverImage))
+	if p.HideTOC {
+		field("toc", "false")
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(p.ContentMD)
+	if !strings.HasSuffix(p.ContentMD, "\n") {
+		b.WriteByte('\n')
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// quote writes s as a double-quoted YAML scalar. JSON strings are valid
+// YAML, so encoding/json does the escaping.
+func quote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ErrNoFrontMatter is returned by ParseMarkdown for files that don't start
+// with a front matter block.
+var ErrNoFrontMatter = errors.New("no front matter")
+
+// ParseMarkdown reads a Markdown file with YAML front matter, as written by
+// WriteMarkdown or by static site generators such as Hugo and Jekyll. Only
+// the metadata is filled in; IDs and rendered HTML are left to the caller.
+//
+// Besides its own keys it understands the common aliases: date, lastmod,
+// description, summary, categories, image, cover_image and draft.
+func ParseMarkdown(data []byte) (*model.Post, error) {
+	src := strings.ReplaceAll(string(data), "\r\n", "\n")
+	src = strings.TrimPrefix(src, "\ufeff") // byte order mark
+	rest, ok := strings.CutPrefix(src, "---\n")
+	if !ok {
+		return nil, ErrNoFrontMatter
+	}
+	header, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		if header, ok = strings.CutSuffix(rest, "\n---"); !ok {
+			return nil, errors.New("front matter is not closed with ---")
+		}
+	}
+	var fm frontMatter
+	if err := yaml.Unmarshal([]byte(header), &fm); err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+
+	p := &model.Post{
+		Title:      strings.TrimRight(fm.Title, "\n"), // after a block scalar
+		Slug:       fm.Slug,
+		Excerpt:    strings.TrimRight(cmp.Or(fm.Excerpt, fm.Description, fm.Summary), "\n"),
+		Category:   fm.Category,
+		Tags:       strings.Join(fm.Tags, ", "),
+		CoverImage: cmp.Or(fm.Cover, fm.CoverImage, fm.Image),
+		ContentMD:  strings.TrimLeft(body, "\n"),
+		HideTOC:    fm.TOC != nil && !*fm.TOC,
+	}
+	if p.Title == "" {
+		return nil, errors.New("front matter has no title")
+	}
+	if p.Category == "" && len(fm.Categories) > 0 {
+		p.Category = fm.Categories[0]
+	}
+
+	var err error
+	if s := cmp.Or(fm.PublishedAt, fm.Date, fm.PublishDate); s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, fmt.Errorf("published_at: %w", err)
+		}
+		p.PublishedAt = &t
+	}
+	if fm.CreatedAt != "" {
+		if p.CreatedAt, err = parseTime(fm.CreatedAt); err != nil {
+			return nil, fmt.Errorf("created_at: %w", err)
+		}
+	}
+	if s := cmp.Or(fm.UpdatedAt, fm.Lastmod); s != "" {
+		if p.UpdatedAt, err = parseTime(s); err != nil {
+			return nil, fmt.Errorf("updated_at: %w", err)
+		}
+	}
+
+	// An explicit status wins; otherwise dated posts are published unless
+	// marked as drafts, as static site generators treat them.
+	switch status := fm.Status; {
+	case status == "published" || status == "draft":
+		p.Status = status
+	case status != "":
+		return nil, fmt.Errorf("status must be published or draft, not %q", status)
+	case fm.Draft || p.PublishedAt == nil:
+		p.Status = "draft"
+	default:
+		p.Status = "published"
+	}
+	return p, nil
+}
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseTime accepts RFC 3339 and the plainer forms front matter often uses;
+// times without a zone are taken as UTC.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// frontMatter holds the keys ParseMarkdown reads, under both its own names
+// and the aliases static site generators use. Other keys are ignored.
+type frontMatter struct {
+	Title       string     `yaml:"title"`
+	Slug        string     `yaml:"slug"`
+	Excerpt     string     `yaml:"excerpt"`
+	Description string     `yaml:"description"`
+	Summary     string     `yaml:"summary"`
+	Category    string     `yaml:"category"`
+	Categories  stringList `yaml:"categories"`
+	Tags        stringList `yaml:"tags"`
+	Cover       string     `yaml:"cover"`
+	CoverImage  string     `yaml:"cover_image"`
+	Image       string     `yaml:"image"`
+	Status      string     `yaml:"status"`
+	Draft       bool       `yaml:"draft"`
+	TOC         *bool      `yaml:"toc"`
+	PublishedAt string     `yaml:"published_at"`
+	Date        string     `yaml:"date"`
+	PublishDate string     `yaml:"publishDate"`
+	CreatedAt   string     `yaml:"created_at"`
+	UpdatedAt   string     `yaml:"updated_at"`
+	Lastmod     string     `yaml:"lastmod"`
+}
+
+// stringList is a list of strings written either as a YAML list or as one
+// comma-separated string. Blank items are dropped.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	var items []string
+	if n.Kind == yaml.SequenceNode {
+		if err := n.Decode(&items); err != nil {
+			return err
+		}
+	} else {
+		var s string
+		if err := n.Decode(&s); err != nil {
+			return err
+		}
+		items = strings.Split(s, ",")
+	}
+	*l = nil
+	for _, s := range items {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
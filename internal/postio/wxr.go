@@ -0,0 +1,134 @@
+package postio
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+// wxrItem is an <item> of a WordPress eXtended RSS export. The wp: namespace
+// URL changes with the export version, so fields match on local names only.
+type wxrItem struct {
+	Title      string        `xml:"title"`
+	Encoded    []wxrEncoded  `xml:"encoded"` // content:encoded and excerpt:encoded
+	PostID     string        `xml:"post_id"`
+	PostDate   string        `xml:"post_date_gmt"`
+	Modified   string        `xml:"post_modified_gmt"`
+	Name       string        `xml:"post_name"`
+	Status     string        `xml:"status"`
+	Type       string        `xml:"post_type"`
+	Categories []wxrCategory `xml:"category"`
+	Meta       []wxrMeta     `xml:"postmeta"`
+	Attachment string        `xml:"attachment_url"`
+}
+
+type wxrEncoded struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
+
+type wxrCategory struct {
+	Domain   string `xml:"domain,attr"`
+	Nicename string `xml:"nicename,attr"`
+	Name     string `xml:",chardata"`
+}
+
+type wxrMeta struct {
+	Key   string `xml:"meta_key"`
+	Value string `xml:"meta_value"`
+}
+
+// wpBlockComment matches the <!-- wp:… --> delimiters of the block editor.
+var wpBlockComment = regexp.MustCompile(`<!-- /?wp:[^>]*-->\n?`)
+
+// ParseWXR reads the posts of a WordPress export. Pages, attachments and
+// trashed or auto-saved posts are skipped and counted in skipped. The HTML
+// content is kept as the Markdown source, which Markdown allows; featured
+// images point at the attachment's original URL.
+func ParseWXR(r io.Reader) (posts []*model.Post, skipped int, err error) {
+	var doc struct {
+		Items []wxrItem `xml:"channel>item"`
+	}
+	dec := xml.NewDecoder(r)
+	dec.Strict = false // real-world exports contain stray entities
+	dec.Entity = xml.HTMLEntity
+	if err := dec.Decode(&doc); err != nil {
+		return nil, 0, err
+	}
+
+	attachments := make(map[string]string)
+	for _, it := range doc.Items {
+		if it.Type == "attachment" && it.Attachment != "" {
+			attachments[it.PostID] = it.Attachment
+		}
+	}
+
+	for _, it := range doc.Items {
+		if it.Type == "attachment" {
+			continue
+		}
+		if it.Type != "post" || it.Status == "trash" || it.Status == "auto-draft" || it.Status == "inherit" {
+			skipped++
+			continue
+		}
+
+		p := &model.Post{
+			Title: strings.TrimSpace(it.Title),
+			Slug:  it.Name,
+		}
+		for _, e := range it.Encoded {
+			if strings.Contains(e.XMLName.Space, "excerpt") {
+				p.Excerpt = strings.TrimSpace(e.Text)
+			} else {
+				p.ContentMD = strings.TrimSpace(wpBlockComment.ReplaceAllString(e.Text, ""))
+			}
+		}
+
+		var tags []string
+		for _, c := range it.Categories {
+			switch {
+			case c.Domain == "category" && p.Category == "" && c.Nicename != "uncategorized":
+				p.Category = strings.TrimSpace(c.Name)
+			case c.Domain == "post_tag":
+				tags = append(tags, strings.TrimSpace(c.Name))
+			}
+		}
+		p.Tags = strings.Join(tags, ", ")
+
+		for _, m := range it.Meta {
+			if m.Key == "_thumbnail_id" {
+				p.CoverImage = attachments[m.Value]
+			}
+		}
+
+		if t, ok := wpTime(it.PostDate); ok {
+			p.CreatedAt = t
+			if it.Status == "publish" {
+				p.PublishedAt = &t
+			}
+		}
+		if t, ok := wpTime(it.Modified); ok {
+			p.UpdatedAt = t
+		}
+		// Scheduled, pending and private posts come in as drafts.
+		p.Status = "draft"
+		if it.Status == "publish" {
+			p.Status = "published"
+		}
+		posts = append(posts, p)
+	}
+	return posts, skipped, nil
+}
+
+// wpTime parses WordPress's GMT timestamps; drafts carry all zeros.
+func wpTime(s string) (time.Time, bool) {
+	t, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(s))
+	if err != nil || t.Year() < 1970 {
+		return time.Time{}, false
+	}
+	return t, true
+}
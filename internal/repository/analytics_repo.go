@@ -1,34 +1,145 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"strings"
+	"time"
 
+	"github.com/mhtecdev/blog-ai/internal/database"
 	"github.com/mhtecdev/blog-ai/internal/model"
 )
 
 type AnalyticsRepo struct {
-	db *sql.DB
+	db *database.DB
 }
 
-func NewAnalyticsRepo(db *sql.DB) *AnalyticsRepo {
+func NewAnalyticsRepo(db *database.DB) *AnalyticsRepo {
 	return &AnalyticsRepo{db: db}
 }
 
-func (r *AnalyticsRepo) RecordView(postID int64, ipHash, userAgent string) error {
-	_, err := r.db.Exec(
-		`INSERT INTO page_views (post_id, ip_hash, user_agent) VALUES (?, ?, ?)`,
-		postID, ipHash, userAgent)
+// AnalyticsBatch writes a group of analytics events in one transaction.
+// Reads within the batch see the batch's own writes, so duplicates inside a
+// single flush are detected too.
+type AnalyticsBatch struct {
+	tx *sql.Tx
+}
+
+// BeginBatch starts a write batch. The caller must Commit or Rollback it.
+func (r *AnalyticsRepo) BeginBatch(ctx context.Context) (*AnalyticsBatch, error) {
+	tx, err := r.db.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &AnalyticsBatch{tx: tx}, nil
+}
+
+func (b *AnalyticsBatch) Commit() error   { return b.tx.Commit() }
+func (b *AnalyticsBatch) Rollback() error { return b.tx.Rollback() }
+
+func (b *AnalyticsBatch) RecordView(ctx context.Context, postID int64, ipHash, userAgent, viewToken string, src model.TrafficSource) error {
+	_, err := b.tx.ExecContext(ctx,
+		`INSERT INTO page_views (post_id, ip_hash, user_agent, view_token, referrer_domain, channel, utm_source, utm_medium, utm_campaign)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		postID, ipHash, userAgent, viewToken, src.ReferrerDomain, src.Channel, src.UTMSource, src.UTMMedium, src.UTMCampaign)
 	return err
 }
 
-func (r *AnalyticsRepo) GetPostMetrics() ([]*model.PostMetric, error) {
-	rows, err := r.db.Query(`
-		SELECT p.id, p.title, p.slug, COUNT(pv.id) AS view_count
+// RecordRead raises the scroll depth and engaged time of the view identified
+// by viewToken. Values only ever grow, so repeated beacons are harmless.
+// Views older than since are left untouched.
+func (b *AnalyticsBatch) RecordRead(ctx context.Context, viewToken string, depth, engagedSeconds int, since time.Time) error {
+	_, err := b.tx.ExecContext(ctx,
+		`UPDATE page_views SET max_depth = MAX(max_depth, ?), engaged_seconds = MAX(engaged_seconds, ?)
+		 WHERE view_token = ? AND viewed_at >= ?`,
+		depth, engagedSeconds, viewToken, since.UTC().Format(time.RFC3339))
+	return err
+}
+
+// HasRecentView reports whether the visitor already viewed the post since the
+// given time. It is served by the idx_pv_post_ip index.
+func (b *AnalyticsBatch) HasRecentView(ctx context.Context, postID int64, ipHash string, since time.Time) (bool, error) {
+	var exists bool
+	err := b.tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM page_views WHERE post_id = ? AND ip_hash = ? AND viewed_at >= ?)`,
+		postID, ipHash, since.UTC().Format(time.RFC3339)).Scan(&exists)
+	return exists, err
+}
+
+// GetOrCreateSalt returns the visitor salt for day, storing candidate if none
+// exists yet. Salts for earlier days are deleted.
+func (r *AnalyticsRepo) GetOrCreateSalt(ctx context.Context, day, candidate string) (string, error) {
+	if _, err := r.db.Write.ExecContext(ctx,
+		`INSERT OR IGNORE INTO visitor_salts (day, salt) VALUES (?, ?)`, day, candidate); err != nil {
+		return "", err
+	}
+	if _, err := r.db.Write.ExecContext(ctx, `DELETE FROM visitor_salts WHERE day < ?`, day); err != nil {
+		return "", err
+	}
+	var salt string
+	err := r.db.Write.QueryRowContext(ctx, `SELECT salt FROM visitor_salts WHERE day = ?`, day).Scan(&salt)
+	return salt, err
+}
+
+// Reads combine the daily rollup tables, which hold every day up to the last
+// rolled-up one, with raw page_views for the days after it. rollupCutoff is
+// the first day not covered by the rollups (empty when nothing is rolled up yet).
+const rollupCutoff = `(SELECT CASE WHEN MAX(day) IS NULL THEN '' ELSE date(MAX(day), '+1 day') END FROM page_view_daily)`
+
+// dailyPostsCTE yields (day, post_id, views, visitors, reached25..reached100).
+const dailyPostsCTE = `daily AS (
+	SELECT day, post_id, views, visitors, reached25, reached50, reached75, reached100
+	FROM page_view_daily
+	UNION ALL
+	SELECT date(viewed_at), post_id, COUNT(*), COUNT(DISTINCT ip_hash),
+	       SUM(max_depth >= 25), SUM(max_depth >= 50), SUM(max_depth >= 75), SUM(max_depth >= 100)
+	FROM page_views
+	WHERE viewed_at >= ` + rollupCutoff + `
+	GROUP BY 1, 2
+)`
+
+// dailySourcesCTE yields (day, post_id, channel, referrer_domain, utm_source,
+// utm_medium, utm_campaign, views).
+const dailySourcesCTE = `sources AS (
+	SELECT day, post_id, channel, referrer_domain, utm_source, utm_medium, utm_campaign, views
+	FROM page_view_daily_sources
+	UNION ALL
+	SELECT date(viewed_at), post_id, channel, referrer_domain, utm_source, utm_medium, utm_campaign, COUNT(*)
+	FROM page_views
+	WHERE viewed_at >= ` + rollupCutoff + `
+	GROUP BY 1, 2, 3, 4, 5, 6, 7
+)`
+
+// filterSQL renders f as SQL conditions on the given day and post columns.
+func filterSQL(f model.AnalyticsFilter, dayCol, postCol string) (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if f.From != "" {
+		conds = append(conds, dayCol+" >= ?")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		conds = append(conds, dayCol+" <= ?")
+		args = append(args, f.To)
+	}
+	if f.PostID != 0 {
+		conds = append(conds, postCol+" = ?")
+		args = append(args, f.PostID)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (r *AnalyticsRepo) GetPostMetrics(ctx context.Context, f model.AnalyticsFilter) ([]*model.PostMetric, error) {
+	cond, args := filterSQL(f, "d.day", "d.post_id")
+	rows, err := r.db.Read.QueryContext(ctx, `
+		WITH `+dailyPostsCTE+`
+		SELECT p.id, p.title, p.slug, COALESCE(SUM(d.views), 0) AS view_count,
+		       COALESCE(SUM(d.visitors), 0) AS unique_visitors
 		FROM posts p
-		LEFT JOIN page_views pv ON pv.post_id = p.id
+		LEFT JOIN daily d ON d.post_id = p.id AND `+cond+`
 		WHERE p.status = 'published'
 		GROUP BY p.id
-		ORDER BY view_count DESC`)
+		ORDER BY view_count DESC`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +148,7 @@ func (r *AnalyticsRepo) GetPostMetrics() ([]*model.PostMetric, error) {
 	var metrics []*model.PostMetric
 	for rows.Next() {
 		m := &model.PostMetric{}
-		if err := rows.Scan(&m.PostID, &m.Title, &m.Slug, &m.ViewCount); err != nil {
+		if err := rows.Scan(&m.PostID, &m.Title, &m.Slug, &m.ViewCount, &m.UniqueVisitors); err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, m)
@@ -45,39 +156,48 @@ func (r *AnalyticsRepo) GetPostMetrics() ([]*model.PostMetric, error) {
 	return metrics, rows.Err()
 }
 
-func (r *AnalyticsRepo) GetViewsOverTime(postID int64, days int) ([]*model.DailyCount, error) {
-	rows, err := r.db.Query(`
-		SELECT date(viewed_at) AS day, COUNT(*) AS count
-		FROM page_views
-		WHERE post_id = ? AND viewed_at >= date('now', ?)
+func (r *AnalyticsRepo) GetViewsOverTime(ctx context.Context, postID int64, days int) ([]*model.DailyCount, error) {
+	return r.queryDailyCounts(ctx, `
+		WITH `+dailyPostsCTE+`
+		SELECT day, SUM(views) AS count
+		FROM daily
+		WHERE post_id = ? AND day >= date('now', ?)
 		GROUP BY day ORDER BY day ASC`,
 		postID, "-"+intToStr(days)+" days")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+}
 
-	var counts []*model.DailyCount
-	for rows.Next() {
-		c := &model.DailyCount{}
-		if err := rows.Scan(&c.Day, &c.Count); err != nil {
-			return nil, err
-		}
-		counts = append(counts, c)
-	}
-	return counts, rows.Err()
+// DailyViews returns view counts per day, for days with at least one view.
+func (r *AnalyticsRepo) DailyViews(ctx context.Context, f model.AnalyticsFilter) ([]*model.DailyCount, error) {
+	cond, args := filterSQL(f, "day", "post_id")
+	return r.queryDailyCounts(ctx, `
+		WITH `+dailyPostsCTE+`
+		SELECT day, SUM(views) AS count
+		FROM daily
+		WHERE `+cond+`
+		GROUP BY day ORDER BY day ASC`, args...)
 }
 
-func (r *AnalyticsRepo) TotalViews() (int64, error) {
+func (r *AnalyticsRepo) ViewTotals(ctx context.Context, f model.AnalyticsFilter) (model.ViewTotals, error) {
+	cond, args := filterSQL(f, "day", "post_id")
+	var t model.ViewTotals
+	err := r.db.Read.QueryRowContext(ctx, `
+		WITH `+dailyPostsCTE+`
+		SELECT COALESCE(SUM(views), 0), COALESCE(SUM(visitors), 0)
+		FROM daily
+		WHERE `+cond, args...).Scan(&t.Views, &t.Visitors)
+	return t, err
+}
+
+func (r *AnalyticsRepo) TotalViews(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.QueryRow(`SELECT COUNT(*) FROM page_views`).Scan(&count)
+	err := r.db.Read.QueryRowContext(ctx, `WITH `+dailyPostsCTE+` SELECT COALESCE(SUM(views), 0) FROM daily`).Scan(&count)
 	return count, err
 }
 
-func (r *AnalyticsRepo) TotalViewsToday() (int64, error) {
+func (r *AnalyticsRepo) TotalViewsToday(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.QueryRow(
-		`SELECT COUNT(*) FROM page_views WHERE date(viewed_at) = date('now')`).Scan(&count)
+	err := r.db.Read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM page_views WHERE viewed_at >= date('now')`).Scan(&count)
 	return count, err
 }
 
@@ -96,32 +216,279 @@ func intToStr(n int) string {
 	return string(digits)
 }
 
-func (r *AnalyticsRepo) GetAllPostMetrics() ([]*model.PostMetric, error) {
-	return r.GetPostMetrics()
+func (r *AnalyticsRepo) GetAllPostMetrics(ctx context.Context) ([]*model.PostMetric, error) {
+	return r.GetPostMetrics(ctx, model.AnalyticsFilter{})
 }
 
-func (r *AnalyticsRepo) GetViewsByPost(postID int64) (int64, error) {
+func (r *AnalyticsRepo) GetViewsByPost(ctx context.Context, postID int64) (int64, error) {
 	var count int64
-	err := r.db.QueryRow(
-		`SELECT COUNT(*) FROM page_views WHERE post_id = ?`, postID).Scan(&count)
+	err := r.db.Read.QueryRowContext(ctx,
+		`WITH `+dailyPostsCTE+` SELECT COALESCE(SUM(views), 0) FROM daily WHERE post_id = ?`, postID).Scan(&count)
 	return count, err
 }
 
-// UniqueViewsByPost counts distinct IPs per post.
-func (r *AnalyticsRepo) UniqueViewsByPost(postID int64) (int64, error) {
+// UniqueViewsByPost counts distinct visitor hashes per post. Hashes rotate
+// daily, so a reader returning on another day counts again.
+func (r *AnalyticsRepo) UniqueViewsByPost(ctx context.Context, postID int64) (int64, error) {
 	var count int64
-	err := r.db.QueryRow(
-		`SELECT COUNT(DISTINCT ip_hash) FROM page_views WHERE post_id = ?`, postID).Scan(&count)
+	err := r.db.Read.QueryRowContext(ctx,
+		`WITH `+dailyPostsCTE+` SELECT COALESCE(SUM(visitors), 0) FROM daily WHERE post_id = ?`, postID).Scan(&count)
 	return count, err
 }
 
-func (r *AnalyticsRepo) GetRecentViews(limit int) ([]*model.DailyCount, error) {
-	rows, err := r.db.Query(`
-		SELECT date(viewed_at) AS day, COUNT(*) AS count
-		FROM page_views
-		WHERE viewed_at >= date('now', ?)
+func (r *AnalyticsRepo) GetRecentViews(ctx context.Context, limit int) ([]*model.DailyCount, error) {
+	return r.queryDailyCounts(ctx, `
+		WITH `+dailyPostsCTE+`
+		SELECT day, SUM(views) AS count
+		FROM daily
+		WHERE day >= date('now', ?)
 		GROUP BY day ORDER BY day ASC`,
 		"-"+intToStr(limit)+" days")
+}
+
+func (r *AnalyticsRepo) TotalPosts(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.Read.QueryRowContext(ctx, `SELECT COUNT(*) FROM posts WHERE status = 'published'`).Scan(&count)
+	return count, err
+}
+
+func (r *AnalyticsRepo) TopReferrers(ctx context.Context, f model.AnalyticsFilter, limit int) ([]*model.LabelCount, error) {
+	cond, args := filterSQL(f, "day", "post_id")
+	return r.queryLabelCounts(ctx, `
+		WITH `+dailySourcesCTE+`
+		SELECT referrer_domain, SUM(views) AS count
+		FROM sources
+		WHERE referrer_domain != '' AND `+cond+`
+		GROUP BY referrer_domain ORDER BY count DESC LIMIT ?`, append(args, limit)...)
+}
+
+func (r *AnalyticsRepo) ViewsByChannel(ctx context.Context, f model.AnalyticsFilter) ([]*model.LabelCount, error) {
+	cond, args := filterSQL(f, "day", "post_id")
+	return r.queryLabelCounts(ctx, `
+		WITH `+dailySourcesCTE+`
+		SELECT channel, SUM(views) AS count
+		FROM sources
+		WHERE `+cond+`
+		GROUP BY channel ORDER BY count DESC`, args...)
+}
+
+func (r *AnalyticsRepo) TopCampaigns(ctx context.Context, f model.AnalyticsFilter, limit int) ([]*model.CampaignMetric, error) {
+	cond, args := filterSQL(f, "day", "post_id")
+	rows, err := r.db.Read.QueryContext(ctx, `
+		WITH `+dailySourcesCTE+`
+		SELECT utm_source, utm_medium, utm_campaign, SUM(views) AS count
+		FROM sources
+		WHERE (utm_source != '' OR utm_campaign != '') AND `+cond+`
+		GROUP BY utm_source, utm_medium, utm_campaign
+		ORDER BY count DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*model.CampaignMetric
+	for rows.Next() {
+		m := &model.CampaignMetric{}
+		if err := rows.Scan(&m.Source, &m.Medium, &m.Campaign, &m.Count); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, m)
+	}
+	return campaigns, rows.Err()
+}
+
+// GetPostSourceMetrics returns per-post view counts split by channel, ordered
+// by the post's total views.
+func (r *AnalyticsRepo) GetPostSourceMetrics(ctx context.Context, f model.AnalyticsFilter) ([]*model.PostSourceMetric, error) {
+	cond, args := filterSQL(f, "s.day", "s.post_id")
+	rows, err := r.db.Read.QueryContext(ctx, `
+		WITH `+dailySourcesCTE+`
+		SELECT p.id, p.title, p.slug, s.channel, SUM(s.views) AS count,
+		       SUM(SUM(s.views)) OVER (PARTITION BY p.id) AS total
+		FROM sources s
+		JOIN posts p ON p.id = s.post_id
+		WHERE `+cond+`
+		GROUP BY p.id, s.channel
+		ORDER BY total DESC, p.id, count DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []*model.PostSourceMetric
+	var cur *model.PostSourceMetric
+	for rows.Next() {
+		var (
+			id          int64
+			title, slug string
+			channel     model.LabelCount
+			total       int64
+		)
+		if err := rows.Scan(&id, &title, &slug, &channel.Label, &channel.Count, &total); err != nil {
+			return nil, err
+		}
+		if cur == nil || cur.PostID != id {
+			cur = &model.PostSourceMetric{PostID: id, Title: title, Slug: slug, Total: total}
+			metrics = append(metrics, cur)
+		}
+		cur.Channels = append(cur.Channels, &channel)
+	}
+	return metrics, rows.Err()
+}
+
+// GetPostEngagement returns scroll-depth milestones and the median engaged
+// time for every post that has views, ordered by views. Milestones come from
+// the rollups; the median can't be rolled up, so it only covers raw views
+// still inside the retention period.
+func (r *AnalyticsRepo) GetPostEngagement(ctx context.Context, f model.AnalyticsFilter) ([]*model.PostEngagement, error) {
+	rawCond, rawArgs := filterSQL(f, "date(viewed_at)", "post_id")
+	cond, args := filterSQL(f, "d.day", "d.post_id")
+	rows, err := r.db.Read.QueryContext(ctx, `
+		WITH `+dailyPostsCTE+`,
+		medians AS (
+			SELECT post_id, AVG(engaged_seconds) AS median
+			FROM (
+				SELECT post_id, engaged_seconds,
+				       ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY engaged_seconds) AS rn,
+				       COUNT(*) OVER (PARTITION BY post_id) AS cnt
+				FROM page_views WHERE engaged_seconds > 0 AND `+rawCond+`
+			)
+			WHERE rn IN ((cnt + 1) / 2, (cnt + 2) / 2)
+			GROUP BY post_id
+		)
+		SELECT p.id, p.title, p.slug, SUM(d.views),
+		       SUM(d.reached25), SUM(d.reached50), SUM(d.reached75), SUM(d.reached100),
+		       COALESCE(m.median, 0)
+		FROM posts p
+		JOIN daily d ON d.post_id = p.id
+		LEFT JOIN medians m ON m.post_id = p.id
+		WHERE `+cond+`
+		GROUP BY p.id
+		ORDER BY SUM(d.views) DESC`, append(rawArgs, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var engagement []*model.PostEngagement
+	for rows.Next() {
+		e := &model.PostEngagement{}
+		if err := rows.Scan(&e.PostID, &e.Title, &e.Slug, &e.Views,
+			&e.Reached25, &e.Reached50, &e.Reached75, &e.Reached100, &e.MedianSeconds); err != nil {
+			return nil, err
+		}
+		engagement = append(engagement, e)
+	}
+	return engagement, rows.Err()
+}
+
+// Rollup aggregates raw page views into the daily rollup tables for every day
+// before `before` ("2006-01-02"). The last rolled-up day and the one before
+// it are recomputed, so reading beacons that arrive after midnight are still
+// counted, but never a day whose raw views have been purged: its rollup is
+// all that's left of it. It is idempotent and runs in a single transaction.
+func (r *AnalyticsRepo) Rollup(ctx context.Context, before string) error {
+	tx, err := r.db.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var from, oldestRaw string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT date(MAX(day), '-1 day') FROM page_view_daily), ''),
+		       COALESCE((SELECT date(MIN(viewed_at)) FROM page_views), '')`).Scan(&from, &oldestRaw); err != nil {
+		return err
+	}
+	if oldestRaw == "" {
+		return nil // nothing to roll up, and nothing to recompute from
+	}
+	// PurgeViewsBefore deletes whole days, so the oldest day with raw views
+	// still has all of them.
+	from = max(from, oldestRaw)
+
+	for _, q := range []string{
+		`DELETE FROM page_view_daily WHERE day >= ?1 AND day < ?2`,
+		`DELETE FROM page_view_daily_sources WHERE day >= ?1 AND day < ?2`,
+		`INSERT INTO page_view_daily (day, post_id, views, visitors, reached25, reached50, reached75, reached100)
+		 SELECT date(viewed_at), post_id, COUNT(*), COUNT(DISTINCT ip_hash),
+		        SUM(max_depth >= 25), SUM(max_depth >= 50), SUM(max_depth >= 75), SUM(max_depth >= 100)
+		 FROM page_views WHERE viewed_at >= ?1 AND viewed_at < ?2
+		 GROUP BY 1, 2`,
+		`INSERT INTO page_view_daily_sources (day, post_id, channel, referrer_domain, utm_source, utm_medium, utm_campaign, views)
+		 SELECT date(viewed_at), post_id, channel, referrer_domain, utm_source, utm_medium, utm_campaign, COUNT(*)
+		 FROM page_views WHERE viewed_at >= ?1 AND viewed_at < ?2
+		 GROUP BY 1, 2, 3, 4, 5, 6, 7`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, from, before); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListViews returns the raw page views matching f, oldest first. Views older
+// than the retention period have been purged and only survive in the rollups.
+func (r *AnalyticsRepo) ListViews(ctx context.Context, f model.AnalyticsFilter) ([]*model.ExportedView, error) {
+	cond, args := filterSQL(f, "date(pv.viewed_at)", "pv.post_id")
+	rows, err := r.db.Read.QueryContext(ctx, `
+		SELECT pv.viewed_at, pv.post_id, p.slug, pv.channel, pv.referrer_domain,
+		       pv.utm_source, pv.utm_medium, pv.utm_campaign, pv.max_depth, pv.engaged_seconds
+		FROM page_views pv
+		JOIN posts p ON p.id = pv.post_id
+		WHERE `+cond+`
+		ORDER BY pv.viewed_at ASC, pv.id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []*model.ExportedView
+	for rows.Next() {
+		v := &model.ExportedView{}
+		if err := rows.Scan(&v.ViewedAt, &v.PostID, &v.Slug, &v.Source.Channel, &v.Source.ReferrerDomain,
+			&v.Source.UTMSource, &v.Source.UTMMedium, &v.Source.UTMCampaign, &v.MaxDepth, &v.EngagedSeconds); err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// ClaimDigest records that the digest for period is being sent. It returns
+// false if it was already claimed.
+func (r *AnalyticsRepo) ClaimDigest(ctx context.Context, period string) (bool, error) {
+	res, err := r.db.Write.ExecContext(ctx, `INSERT OR IGNORE INTO digest_runs (period) VALUES (?)`, period)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseDigest removes a claim so a failed digest is retried.
+func (r *AnalyticsRepo) ReleaseDigest(ctx context.Context, period string) error {
+	_, err := r.db.Write.ExecContext(ctx, `DELETE FROM digest_runs WHERE period = ?`, period)
+	return err
+}
+
+// PurgeViewsBefore deletes raw page views from the days before cutoff's UTC
+// day, but only for days that are already covered by the rollups. Days go
+// whole, so Rollup can recompute any day that still has raw views. It
+// returns the rows deleted.
+func (r *AnalyticsRepo) PurgeViewsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.db.Write.ExecContext(ctx, `
+		DELETE FROM page_views
+		WHERE viewed_at < date(?) AND viewed_at < (SELECT date(MAX(day), '+1 day') FROM page_view_daily)`,
+		cutoff.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *AnalyticsRepo) queryDailyCounts(ctx context.Context, query string, args ...interface{}) ([]*model.DailyCount, error) {
+	rows, err := r.db.Read.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -138,8 +505,20 @@ func (r *AnalyticsRepo) GetRecentViews(limit int) ([]*model.DailyCount, error) {
 	return counts, rows.Err()
 }
 
-func (r *AnalyticsRepo) TotalPosts() (int64, error) {
-	var count int64
-	err := r.db.QueryRow(`SELECT COUNT(*) FROM posts WHERE status = 'published'`).Scan(&count)
-	return count, err
+func (r *AnalyticsRepo) queryLabelCounts(ctx context.Context, query string, args ...interface{}) ([]*model.LabelCount, error) {
+	rows, err := r.db.Read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*model.LabelCount
+	for rows.Next() {
+		c := &model.LabelCount{}
+		if err := rows.Scan(&c.Label, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
 }
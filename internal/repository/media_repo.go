@@ -1,22 +1,24 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
+	"github.com/mhtecdev/blog-ai/internal/database"
 	"github.com/mhtecdev/blog-ai/internal/model"
 )
 
 type MediaRepo struct {
-	db *sql.DB
+	db *database.DB
 }
 
-func NewMediaRepo(db *sql.DB) *MediaRepo {
+func NewMediaRepo(db *database.DB) *MediaRepo {
 	return &MediaRepo{db: db}
 }
 
-func (r *MediaRepo) Create(m *model.Media) (*model.Media, error) {
-	res, err := r.db.Exec(
+func (r *MediaRepo) Create(ctx context.Context, m *model.Media) (*model.Media, error) {
+	res, err := r.db.Write.ExecContext(ctx,
 		`INSERT INTO media (filename, original, mime_type, size_bytes, url, uploaded_by)
 		 VALUES (?, ?, ?, ?, ?, ?)`,
 		m.Filename, m.Original, m.MimeType, m.SizeBytes, m.URL, m.UploadedBy)
@@ -24,11 +26,11 @@ func (r *MediaRepo) Create(m *model.Media) (*model.Media, error) {
 		return nil, err
 	}
 	id, _ := res.LastInsertId()
-	return r.GetByID(id)
+	return r.GetByID(ctx, id)
 }
 
-func (r *MediaRepo) GetByID(id int64) (*model.Media, error) {
-	row := r.db.QueryRow(
+func (r *MediaRepo) GetByID(ctx context.Context, id int64) (*model.Media, error) {
+	row := r.db.Read.QueryRowContext(ctx,
 		`SELECT id, filename, original, mime_type, size_bytes, url, uploaded_by, created_at
 		 FROM media WHERE id = ?`, id)
 	m := &model.Media{}
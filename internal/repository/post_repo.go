@@ -1,66 +1,84 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/mhtecdev/blog-ai/internal/database"
 	"github.com/mhtecdev/blog-ai/internal/model"
 )
 
 type PostRepo struct {
-	db *sql.DB
+	db *database.DB
 }
 
-func NewPostRepo(db *sql.DB) *PostRepo {
+func NewPostRepo(db *database.DB) *PostRepo {
 	return &PostRepo{db: db}
 }
 
-func (r *PostRepo) Create(p *model.Post) (*model.Post, error) {
-	res, err := r.db.Exec(
-		`INSERT INTO posts (title, slug, excerpt, content_md, content_html, cover_image, category, tags, status, published_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+func (r *PostRepo) Create(ctx context.Context, p *model.Post) (*model.Post, error) {
+	res, err := r.db.Write.ExecContext(ctx,
+		`INSERT INTO posts (title, slug, excerpt, content_md, content_html, cover_image, category, tags, status, published_at,
+		                    word_count, reading_minutes, toc, hide_toc, render_version, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+		         COALESCE(?, strftime('%Y-%m-%dT%H:%M:%SZ','now')), COALESCE(?, strftime('%Y-%m-%dT%H:%M:%SZ','now')))`,
 		p.Title, p.Slug, p.Excerpt, p.ContentMD, p.ContentHTML,
-		p.CoverImage, p.Category, p.Tags, p.Status, nullTime(p.PublishedAt))
+		p.CoverImage, p.Category, p.Tags, p.Status, nullTime(p.PublishedAt),
+		p.WordCount, p.ReadingMinutes, tocJSON(p.TOC), p.HideTOC, p.RenderVersion,
+		nullZeroTime(p.CreatedAt), nullZeroTime(p.UpdatedAt))
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
 	if err != nil {
 		return nil, err
 	}
 	id, _ := res.LastInsertId()
-	return r.GetByID(id)
+	return r.GetByID(ctx, id)
 }
 
-func (r *PostRepo) Update(p *model.Post) (*model.Post, error) {
-	_, err := r.db.Exec(
+func (r *PostRepo) Update(ctx context.Context, p *model.Post) (*model.Post, error) {
+	_, err := r.db.Write.ExecContext(ctx,
 		`UPDATE posts SET title=?, slug=?, excerpt=?, content_md=?, content_html=?,
 		 cover_image=?, category=?, tags=?, status=?, published_at=?,
+		 word_count=?, reading_minutes=?, toc=?, hide_toc=?, render_version=?,
 		 updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now')
 		 WHERE id=?`,
 		p.Title, p.Slug, p.Excerpt, p.ContentMD, p.ContentHTML,
-		p.CoverImage, p.Category, p.Tags, p.Status, nullTime(p.PublishedAt), p.ID)
+		p.CoverImage, p.Category, p.Tags, p.Status, nullTime(p.PublishedAt),
+		p.WordCount, p.ReadingMinutes, tocJSON(p.TOC), p.HideTOC, p.RenderVersion, p.ID)
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
 	if err != nil {
 		return nil, err
 	}
-	return r.GetByID(p.ID)
+	return r.GetByID(ctx, p.ID)
 }
 
-func (r *PostRepo) Delete(id int64) error {
-	_, err := r.db.Exec(`DELETE FROM posts WHERE id = ?`, id)
+func (r *PostRepo) Delete(ctx context.Context, id int64) error {
+	_, err := r.db.Write.ExecContext(ctx, `DELETE FROM posts WHERE id = ?`, id)
 	return err
 }
 
-func (r *PostRepo) GetByID(id int64) (*model.Post, error) {
-	row := r.db.QueryRow(`SELECT `+postCols+` FROM posts WHERE id = ?`, id)
+func (r *PostRepo) GetByID(ctx context.Context, id int64) (*model.Post, error) {
+	row := r.db.Read.QueryRowContext(ctx, `SELECT `+postCols+` FROM posts WHERE id = ?`, id)
 	return scanPost(row)
 }
 
-func (r *PostRepo) GetBySlug(slug string) (*model.Post, error) {
-	row := r.db.QueryRow(`SELECT `+postCols+` FROM posts WHERE slug = ?`, slug)
+func (r *PostRepo) GetBySlug(ctx context.Context, slug string) (*model.Post, error) {
+	row := r.db.Read.QueryRowContext(ctx, `SELECT `+postCols+` FROM posts WHERE slug = ?`, slug)
 	return scanPost(row)
 }
 
-func (r *PostRepo) ListAll() ([]*model.Post, error) {
-	rows, err := r.db.Query(
-		`SELECT ` + postCols + ` FROM posts ORDER BY created_at DESC`)
+func (r *PostRepo) ListAll(ctx context.Context) ([]*model.Post, error) {
+	rows, err := r.db.Read.QueryContext(ctx,
+		`SELECT `+postCols+` FROM posts ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +86,9 @@ func (r *PostRepo) ListAll() ([]*model.Post, error) {
 	return scanPosts(rows)
 }
 
-func (r *PostRepo) ListPublished() ([]*model.Post, error) {
-	rows, err := r.db.Query(
-		`SELECT ` + postCols + ` FROM posts WHERE status='published' ORDER BY published_at DESC`)
+func (r *PostRepo) ListPublished(ctx context.Context) ([]*model.Post, error) {
+	rows, err := r.db.Read.QueryContext(ctx,
+		`SELECT `+postCols+` FROM posts WHERE status='published' ORDER BY published_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -78,19 +96,184 @@ func (r *PostRepo) ListPublished() ([]*model.Post, error) {
 	return scanPosts(rows)
 }
 
-func (r *PostRepo) ListPublishedByCategory(category string) ([]*model.Post, error) {
-	rows, err := r.db.Query(
-		`SELECT `+postCols+` FROM posts WHERE status='published' AND category=? ORDER BY published_at DESC`,
-		category)
+// postOrders maps each sort to the expression posts are ordered by and
+// whether the largest value comes first. The ID breaks ties in the same
+// direction, so every post has a distinct position to page from.
+var postOrders = map[string]struct {
+	key  string
+	desc bool
+}{
+	model.SortNewest:    {"created_at", true},
+	model.SortOldest:    {"created_at", false},
+	model.SortUpdated:   {"updated_at", true},
+	model.SortPublished: {publishedKey, true},
+	model.SortTitle:     {"title COLLATE NOCASE", false},
+}
+
+// publishedKey is the expression the 011 indexes key posts on: a post not
+// yet published sorts as "". Filters on the publication date compare it
+// rather than published_at, so they seek within those indexes.
+const publishedKey = "COALESCE(published_at, '')"
+
+// List returns the page of posts q selects. Pages are found by seeking past
+// the cursor rather than by offset, so deep pages cost no more than the
+// first and posts published meanwhile don't shift later pages.
+func (r *PostRepo) List(ctx context.Context, q model.PostQuery) (*model.PostPage, error) {
+	order, ok := postOrders[q.Sort]
+	if !ok {
+		order = postOrders[model.SortPublished]
+	}
+	var filter []string
+	var args []any
+	if q.Status != "" {
+		filter, args = append(filter, "status = ?"), append(args, q.Status)
+	}
+	if q.Category != "" {
+		filter, args = append(filter, "category = ?"), append(args, q.Category)
+	}
+	if !q.Since.IsZero() {
+		filter, args = append(filter, publishedKey+" >= ?"), append(args, nullTime(&q.Since))
+	}
+	if !q.Until.IsZero() {
+		filter, args = append(filter, publishedKey+" > ''", publishedKey+" < ?"), append(args, nullTime(&q.Until))
+	}
+
+	// A page before the cursor is read in reverse order, then flipped.
+	cursor, backward := q.After, false
+	if q.Before != nil {
+		cursor, backward = q.Before, true
+	}
+	desc := order.desc != backward
+	where, whereArgs := filter, args
+	if cursor != nil {
+		// Capped slices, so filter and args stay as they are for exists.
+		where = append(filter[:len(filter):len(filter)], "("+order.key+", id) "+compare(desc)+" (?, ?)")
+		whereArgs = append(args[:len(args):len(args)], cursor.Key, cursor.ID)
+	}
+	query := `SELECT ` + postCols + `, ` + order.key + ` FROM posts` + whereClause(where) +
+		` ORDER BY ` + order.key + direction(desc) + `, id` + direction(desc)
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		whereArgs = append(whereArgs, q.Limit+1) // one more shows whether another page follows
+	}
+
+	rows, err := r.db.Read.QueryContext(ctx, query, whereArgs...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	return scanPosts(rows)
+	var posts []*model.Post
+	var keys []string
+	for rows.Next() {
+		var key sql.NullString
+		p, err := scanPostFrom(rows, &key)
+		if err != nil {
+			return nil, err
+		}
+		posts, keys = append(posts, p), append(keys, key.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &model.PostPage{Posts: posts}
+	if len(posts) == 0 {
+		return page, nil
+	}
+	more := q.Limit > 0 && len(posts) > q.Limit
+	if more {
+		posts, keys = posts[:q.Limit], keys[:q.Limit]
+	}
+	if backward {
+		slices.Reverse(posts)
+		slices.Reverse(keys)
+	}
+	page.Posts = posts
+	first := &model.PostCursor{Key: keys[0], ID: posts[0].ID}
+	last := &model.PostCursor{Key: keys[len(keys)-1], ID: posts[len(posts)-1].ID}
+
+	// The side the query ran towards is known from the extra row; the side it
+	// came from is looked up, as the posts there may have been deleted.
+	if backward {
+		if more {
+			page.Prev = first
+		}
+		if ok, err := r.exists(ctx, order.key, order.desc, filter, args, last); err != nil {
+			return nil, err
+		} else if ok {
+			page.Next = last
+		}
+	} else {
+		if more {
+			page.Next = last
+		}
+		if cursor != nil {
+			if ok, err := r.exists(ctx, order.key, !order.desc, filter, args, first); err != nil {
+				return nil, err
+			} else if ok {
+				page.Prev = first
+			}
+		}
+	}
+	return page, nil
+}
+
+// exists reports whether a post matching filter lies beyond cursor when
+// reading in the given direction.
+func (r *PostRepo) exists(ctx context.Context, key string, desc bool, filter []string, args []any, cursor *model.PostCursor) (bool, error) {
+	where := append(filter[:len(filter):len(filter)], "("+key+", id) "+compare(desc)+" (?, ?)")
+	var found bool
+	err := r.db.Read.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM posts`+whereClause(where)+`)`,
+		append(args[:len(args):len(args)], cursor.Key, cursor.ID)...).Scan(&found)
+	return found, err
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+func compare(desc bool) string {
+	if desc {
+		return "<"
+	}
+	return ">"
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+// ArchiveMonths counts the published posts of each month, in UTC, latest
+// first. Timestamps are stored as RFC 3339 text, so the year and month are
+// its leading digits.
+func (r *PostRepo) ArchiveMonths(ctx context.Context) ([]model.ArchiveMonth, error) {
+	rows, err := r.db.Read.QueryContext(ctx,
+		`SELECT CAST(substr(`+publishedKey+`, 1, 4) AS INTEGER), CAST(substr(`+publishedKey+`, 6, 2) AS INTEGER), COUNT(*)
+		 FROM posts WHERE status='published' AND `+publishedKey+` > ''
+		 GROUP BY 1, 2 ORDER BY 1 DESC, 2 DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var months []model.ArchiveMonth
+	for rows.Next() {
+		var m model.ArchiveMonth
+		if err := rows.Scan(&m.Year, &m.Month, &m.Count); err != nil {
+			return nil, err
+		}
+		months = append(months, m)
+	}
+	return months, rows.Err()
 }
 
-func (r *PostRepo) ListCategories() ([]string, error) {
-	rows, err := r.db.Query(
+func (r *PostRepo) ListCategories(ctx context.Context) ([]string, error) {
+	rows, err := r.db.Read.QueryContext(ctx,
 		`SELECT DISTINCT category FROM posts WHERE status='published' AND category != '' ORDER BY category`)
 	if err != nil {
 		return nil, err
@@ -107,29 +290,62 @@ func (r *PostRepo) ListCategories() ([]string, error) {
 	return cats, rows.Err()
 }
 
-func (r *PostRepo) SlugExists(slug string) (bool, error) {
+// ListStale returns the posts rendered by a version of the Markdown
+// pipeline older than version.
+func (r *PostRepo) ListStale(ctx context.Context, version int) ([]*model.Post, error) {
+	rows, err := r.db.Read.QueryContext(ctx,
+		`SELECT `+postCols+` FROM posts WHERE render_version < ?`, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+// SetRendered stores what a post's Markdown renders to — its HTML, table of
+// contents, word count and reading time — without marking it edited.
+func (r *PostRepo) SetRendered(ctx context.Context, p *model.Post) error {
+	_, err := r.db.Write.ExecContext(ctx,
+		`UPDATE posts SET content_html = ?, toc = ?, word_count = ?, reading_minutes = ?, render_version = ?
+		 WHERE id = ?`,
+		p.ContentHTML, tocJSON(p.TOC), p.WordCount, p.ReadingMinutes, p.RenderVersion, p.ID)
+	return err
+}
+
+func (r *PostRepo) SlugExists(ctx context.Context, slug string) (bool, error) {
 	var count int
-	err := r.db.QueryRow(`SELECT COUNT(*) FROM posts WHERE slug = ?`, slug).Scan(&count)
+	err := r.db.Read.QueryRowContext(ctx, `SELECT COUNT(*) FROM posts WHERE slug = ?`, slug).Scan(&count)
 	return count > 0, err
 }
 
 const postCols = `id, uuid, title, slug, excerpt, content_md, content_html,
-	cover_image, category, tags, status, published_at, created_at, updated_at`
+	cover_image, category, tags, status, published_at, created_at, updated_at,
+	word_count, reading_minutes, toc, hide_toc, render_version`
 
-func scanPost(row *sql.Row) (*model.Post, error) {
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPostFrom scans the postCols of one row, followed by extra columns.
+func scanPostFrom(row rowScanner, extra ...any) (*model.Post, error) {
 	p := &model.Post{}
 	var publishedAt, createdAt, updatedAt sql.NullString
-	err := row.Scan(
+	var toc string
+	err := row.Scan(append([]any{
 		&p.ID, &p.UUID, &p.Title, &p.Slug, &p.Excerpt,
 		&p.ContentMD, &p.ContentHTML, &p.CoverImage,
 		&p.Category, &p.Tags, &p.Status,
-		&publishedAt, &createdAt, &updatedAt)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+		&publishedAt, &createdAt, &updatedAt,
+		&p.WordCount, &p.ReadingMinutes, &toc, &p.HideTOC, &p.RenderVersion}, extra...)...)
 	if err != nil {
 		return nil, err
 	}
+	if toc != "" {
+		if err := json.Unmarshal([]byte(toc), &p.TOC); err != nil {
+			return nil, fmt.Errorf("post %d: toc: %w", p.ID, err)
+		}
+	}
 	if publishedAt.Valid && publishedAt.String != "" {
 		t, _ := time.Parse(time.RFC3339, publishedAt.String)
 		p.PublishedAt = &t
@@ -139,33 +355,48 @@ func scanPost(row *sql.Row) (*model.Post, error) {
 	return p, nil
 }
 
+func scanPost(row *sql.Row) (*model.Post, error) {
+	p, err := scanPostFrom(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
 func scanPosts(rows *sql.Rows) ([]*model.Post, error) {
 	var posts []*model.Post
 	for rows.Next() {
-		p := &model.Post{}
-		var publishedAt, createdAt, updatedAt sql.NullString
-		err := rows.Scan(
-			&p.ID, &p.UUID, &p.Title, &p.Slug, &p.Excerpt,
-			&p.ContentMD, &p.ContentHTML, &p.CoverImage,
-			&p.Category, &p.Tags, &p.Status,
-			&publishedAt, &createdAt, &updatedAt)
+		p, err := scanPostFrom(rows)
 		if err != nil {
 			return nil, err
 		}
-		if publishedAt.Valid && publishedAt.String != "" {
-			t, _ := time.Parse(time.RFC3339, publishedAt.String)
-			p.PublishedAt = &t
-		}
-		p.CreatedAt, _ = time.Parse(time.RFC3339, createdAt.String)
-		p.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt.String)
 		posts = append(posts, p)
 	}
 	return posts, rows.Err()
 }
 
+// nullZeroTime is nullTime for timestamps that are unset when zero, such as
+// the creation time of a new post, which the database then fills in.
+func nullZeroTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return nullTime(&t)
+}
+
 func nullTime(t *time.Time) interface{} {
 	if t == nil {
 		return nil
 	}
 	return t.UTC().Format(time.RFC3339)
 }
+
+// tocJSON encodes a table of contents for the toc column; a post without
+// headings stores "".
+func tocJSON(toc model.TOC) string {
+	if len(toc) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(toc)
+	return string(b)
+}
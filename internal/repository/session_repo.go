@@ -1,31 +1,33 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/mhtecdev/blog-ai/internal/database"
 	"github.com/mhtecdev/blog-ai/internal/model"
 )
 
 type SessionRepo struct {
-	db *sql.DB
+	db *database.DB
 }
 
-func NewSessionRepo(db *sql.DB) *SessionRepo {
+func NewSessionRepo(db *database.DB) *SessionRepo {
 	return &SessionRepo{db: db}
 }
 
-func (r *SessionRepo) Create(s *model.Session) error {
-	_, err := r.db.Exec(
+func (r *SessionRepo) Create(ctx context.Context, s *model.Session) error {
+	_, err := r.db.Write.ExecContext(ctx,
 		`INSERT INTO sessions (id, user_id, data, ip_hash, user_agent, expires_at)
 		 VALUES (?, ?, ?, ?, ?, ?)`,
 		s.ID, s.UserID, s.Data, s.IPHash, s.UserAgent, s.ExpiresAt.UTC().Format(time.RFC3339))
 	return err
 }
 
-func (r *SessionRepo) Get(id string) (*model.Session, error) {
-	row := r.db.QueryRow(
+func (r *SessionRepo) Get(ctx context.Context, id string) (*model.Session, error) {
+	row := r.db.Read.QueryRowContext(ctx,
 		`SELECT id, user_id, data, ip_hash, user_agent, expires_at, created_at
 		 FROM sessions WHERE id = ?`, id)
 
@@ -43,13 +45,13 @@ func (r *SessionRepo) Get(id string) (*model.Session, error) {
 	return s, nil
 }
 
-func (r *SessionRepo) Delete(id string) error {
-	_, err := r.db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+func (r *SessionRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Write.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
 	return err
 }
 
-func (r *SessionRepo) DeleteExpired() error {
-	_, err := r.db.Exec(
+func (r *SessionRepo) DeleteExpired(ctx context.Context) error {
+	_, err := r.db.Write.ExecContext(ctx,
 		`DELETE FROM sessions WHERE expires_at < ?`,
 		time.Now().UTC().Format(time.RFC3339))
 	return err
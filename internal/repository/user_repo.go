@@ -1,24 +1,36 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strings"
 
+	"github.com/mhtecdev/blog-ai/internal/database"
 	"github.com/mhtecdev/blog-ai/internal/model"
 )
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write violates a UNIQUE constraint.
+	ErrConflict = errors.New("conflict")
+)
+
+// isUniqueViolation reports whether err is SQLite's UNIQUE constraint error.
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
 
 type UserRepo struct {
-	db *sql.DB
+	db *database.DB
 }
 
-func NewUserRepo(db *sql.DB) *UserRepo {
+func NewUserRepo(db *database.DB) *UserRepo {
 	return &UserRepo{db: db}
 }
 
-func (r *UserRepo) GetByUsername(username string) (*model.AdminUser, error) {
-	row := r.db.QueryRow(
+func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*model.AdminUser, error) {
+	row := r.db.Read.QueryRowContext(ctx,
 		`SELECT id, username, password_hash, email, created_at, updated_at
 		 FROM admin_users WHERE username = ?`, username)
 
@@ -30,8 +42,8 @@ func (r *UserRepo) GetByUsername(username string) (*model.AdminUser, error) {
 	return u, err
 }
 
-func (r *UserRepo) GetByID(id int64) (*model.AdminUser, error) {
-	row := r.db.QueryRow(
+func (r *UserRepo) GetByID(ctx context.Context, id int64) (*model.AdminUser, error) {
+	row := r.db.Read.QueryRowContext(ctx,
 		`SELECT id, username, password_hash, email, created_at, updated_at
 		 FROM admin_users WHERE id = ?`, id)
 
@@ -43,13 +55,13 @@ func (r *UserRepo) GetByID(id int64) (*model.AdminUser, error) {
 	return u, err
 }
 
-func (r *UserRepo) Create(username, passwordHash, email string) (*model.AdminUser, error) {
-	res, err := r.db.Exec(
+func (r *UserRepo) Create(ctx context.Context, username, passwordHash, email string) (*model.AdminUser, error) {
+	res, err := r.db.Write.ExecContext(ctx,
 		`INSERT INTO admin_users (username, password_hash, email) VALUES (?, ?, ?)`,
 		username, passwordHash, email)
 	if err != nil {
 		return nil, err
 	}
 	id, _ := res.LastInsertId()
-	return r.GetByID(id)
+	return r.GetByID(ctx, id)
 }
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+// ErrUnsupportedExport is returned by Export for unknown datasets or formats.
+var ErrUnsupportedExport = apperr.New(http.StatusBadRequest, "Unsupported export: use dataset posts, daily or views and format csv or json.")
+
+// Export datasets and formats accepted by AnalyticsService.Export.
+const (
+	ExportPosts = "posts"
+	ExportDaily = "daily"
+	ExportViews = "views"
+
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+type exportTable struct {
+	header []string
+	rows   [][]string
+	items  interface{} // JSON representation of the same rows
+}
+
+type postExport struct {
+	PostID         int64  `json:"post_id"`
+	Title          string `json:"title"`
+	Slug           string `json:"slug"`
+	Views          int64  `json:"views"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
+type dailyExport struct {
+	Day   string `json:"day"`
+	Views int64  `json:"views"`
+}
+
+type viewExport struct {
+	ViewedAt       string `json:"viewed_at"`
+	PostID         int64  `json:"post_id"`
+	Slug           string `json:"slug"`
+	Channel        string `json:"channel"`
+	ReferrerDomain string `json:"referrer_domain"`
+	UTMSource      string `json:"utm_source"`
+	UTMMedium      string `json:"utm_medium"`
+	UTMCampaign    string `json:"utm_campaign"`
+	MaxDepth       int    `json:"max_depth"`
+	EngagedSeconds int    `json:"engaged_seconds"`
+}
+
+// Export writes one dataset for r as CSV or JSON:
+//
+//   - posts: views and unique visitors per published post
+//   - daily: views per day, including days without views
+//   - views: raw page views (only those still within the retention period)
+func (s *AnalyticsService) Export(ctx context.Context, w io.Writer, dataset, format string, r model.DateRange) error {
+	if format != FormatCSV && format != FormatJSON {
+		return ErrUnsupportedExport
+	}
+	table, err := s.exportTable(ctx, dataset, r)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Dataset string      `json:"dataset"`
+			From    string      `json:"from"`
+			To      string      `json:"to"`
+			Rows    interface{} `json:"rows"`
+		}{dataset, r.From.Format("2006-01-02"), r.To.Format("2006-01-02"), table.items})
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(table.header); err != nil {
+		return err
+	}
+	for _, row := range table.rows {
+		for i := range row {
+			row[i] = csvSafe(row[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *AnalyticsService) exportTable(ctx context.Context, dataset string, r model.DateRange) (*exportTable, error) {
+	f := r.Filter(0)
+	switch dataset {
+	case ExportPosts:
+		metrics, err := s.repo.GetPostMetrics(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		t := &exportTable{header: []string{"post_id", "title", "slug", "views", "unique_visitors"}}
+		items := make([]postExport, 0, len(metrics))
+		for _, m := range metrics {
+			items = append(items, postExport{m.PostID, m.Title, m.Slug, m.ViewCount, m.UniqueVisitors})
+			t.rows = append(t.rows, []string{itoa64(m.PostID), m.Title, m.Slug, itoa64(m.ViewCount), itoa64(m.UniqueVisitors)})
+		}
+		t.items = items
+		return t, nil
+
+	case ExportDaily:
+		days, err := s.GetDailyViews(ctx, r, 0)
+		if err != nil {
+			return nil, err
+		}
+		t := &exportTable{header: []string{"day", "views"}}
+		items := make([]dailyExport, 0, len(days))
+		for _, d := range days {
+			items = append(items, dailyExport{d.Day, d.Count})
+			t.rows = append(t.rows, []string{d.Day, itoa64(d.Count)})
+		}
+		t.items = items
+		return t, nil
+
+	case ExportViews:
+		views, err := s.repo.ListViews(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		t := &exportTable{header: []string{"viewed_at", "post_id", "slug", "channel", "referrer_domain",
+			"utm_source", "utm_medium", "utm_campaign", "max_depth", "engaged_seconds"}}
+		items := make([]viewExport, 0, len(views))
+		for _, v := range views {
+			items = append(items, viewExport{v.ViewedAt, v.PostID, v.Slug, v.Source.Channel, v.Source.ReferrerDomain,
+				v.Source.UTMSource, v.Source.UTMMedium, v.Source.UTMCampaign, v.MaxDepth, v.EngagedSeconds})
+			t.rows = append(t.rows, []string{v.ViewedAt, itoa64(v.PostID), v.Slug, v.Source.Channel, v.Source.ReferrerDomain,
+				v.Source.UTMSource, v.Source.UTMMedium, v.Source.UTMCampaign,
+				strconv.Itoa(v.MaxDepth), strconv.Itoa(v.EngagedSeconds)})
+		}
+		t.items = items
+		return t, nil
+	}
+	return nil, ErrUnsupportedExport
+}
+
+// csvSafe neutralizes cells that spreadsheets would evaluate as formulas.
+// Referrers and UTM values come straight from visitors, so they can't be
+// trusted to be plain text.
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func itoa64(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -1,10 +1,24 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
 	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/logging"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
 	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/repository"
 )
@@ -12,62 +26,563 @@ import (
 type AnalyticsService struct {
 	repo *repository.AnalyticsRepo
 	cfg  *config.Config
-	ch   chan viewEvent
+	ch   chan analyticsEvent
+	live *liveHub
+
+	// closeMu guards closed and the close of ch: senders hold it for reading.
+	closeMu sync.RWMutex
+	closed  bool
+	stop    chan struct{} // closed by Close to stop rollupLoop
+	rolled  chan struct{} // closed when rollupLoop has returned
+	done    chan struct{} // closed when the worker has drained ch
+
+	// ctx bounds the background writes; cancel aborts them when Close runs
+	// out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stats pipelineCounters
+
+	saltMu  sync.Mutex
+	saltDay string
+	salt    string
 }
 
-type viewEvent struct {
+// pipelineCounters track every event from enqueue to database write.
+type pipelineCounters struct {
+	queued       atomic.Int64
+	written      atomic.Int64
+	deduplicated atomic.Int64
+	dropped      atomic.Int64
+	failed       atomic.Int64
+}
+
+type eventKind int
+
+const (
+	eventView eventKind = iota
+	eventRead
+)
+
+// analyticsEvent is either a page view or a reading beacon. Both share one
+// channel so a beacon is always applied after the view it refers to.
+type analyticsEvent struct {
+	kind      eventKind
+	token     string
 	postID    int64
 	ipHash    string
 	userAgent string
+	source    model.TrafficSource
+	depth     int
+	engaged   int    // seconds
+	requestID string // for correlating write failures with the request
 }
 
+const (
+	// queueSize is the capacity of the event channel; events beyond it are dropped.
+	queueSize = 256
+	// maxBatch caps how many queued events are written in one transaction.
+	maxBatch = 64
+	// maxEngagedSeconds caps reported reading time per view.
+	maxEngagedSeconds = 4 * 60 * 60
+	// readBeaconMaxAge is how long after a view its beacons are accepted.
+	readBeaconMaxAge = 24 * time.Hour
+	// minRetention keeps raw views long enough for the rollup job to
+	// recompute the days that late reading beacons may still change.
+	minRetention = 72 * time.Hour
+	// batchTimeout bounds the transaction of one flushed batch.
+	batchTimeout = 10 * time.Second
+)
+
 func NewAnalyticsService(repo *repository.AnalyticsRepo, cfg *config.Config) *AnalyticsService {
 	svc := &AnalyticsService{
 		repo: repo,
 		cfg:  cfg,
-		ch:   make(chan viewEvent, 256),
+		ch:   make(chan analyticsEvent, queueSize),
+		live: newLiveHub(),
+		stop:   make(chan struct{}),
+		rolled: make(chan struct{}),
+		done:   make(chan struct{}),
 	}
+	svc.ctx, svc.cancel = context.WithCancel(context.Background())
 	go svc.worker()
+	if cfg.AnalyticsRollupInterval > 0 {
+		go svc.rollupLoop()
+	} else {
+		close(svc.rolled)
+	}
 	return svc
 }
 
+// rollupLoop aggregates finished days into the rollup tables and purges raw
+// views past the retention period, once at startup and then every
+// AnalyticsRollupInterval.
+func (s *AnalyticsService) rollupLoop() {
+	defer close(s.rolled)
+	ticker := time.NewTicker(s.cfg.AnalyticsRollupInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Rollup(s.ctx, time.Now()); err != nil {
+			slog.Error("analytics: rollup failed", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Rollup aggregates every day before now's UTC day and then applies the
+// retention policy.
+func (s *AnalyticsService) Rollup(ctx context.Context, now time.Time) error {
+	if err := s.repo.Rollup(ctx, now.UTC().Format("2006-01-02")); err != nil {
+		return err
+	}
+	if s.cfg.AnalyticsRetention <= 0 {
+		return nil
+	}
+	purged, err := s.repo.PurgeViewsBefore(ctx, now.Add(-max(s.cfg.AnalyticsRetention, minRetention)))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		slog.Info("analytics: purged raw page views past retention", "count", purged)
+	}
+	return nil
+}
+
+// Close stops accepting events and waits until the worker has written
+// everything already queued and a running rollup has finished, or until ctx
+// is done, in which case the in-flight writes are cancelled. Either way
+// nothing touches the database once it returns. Events recorded after Close
+// are counted as dropped.
+func (s *AnalyticsService) Close(ctx context.Context) error {
+	s.closeMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+		close(s.ch)
+	}
+	s.closeMu.Unlock()
+	s.live.closeAll()
+
+	defer s.cancel()
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.cancel()
+		<-s.rolled // a cancelled rollup returns promptly
+		return fmt.Errorf("analytics: %d events not written: %w", len(s.ch), ctx.Err())
+	}
+	select {
+	case <-s.rolled:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.rolled
+		return fmt.Errorf("analytics: rollup not finished: %w", ctx.Err())
+	}
+}
+
+// StopLive ends all live subscriptions. Call it before shutting the server
+// down, since open event streams would otherwise keep it waiting.
+func (s *AnalyticsService) StopLive() {
+	s.live.closeAll()
+}
+
+// Stats returns a snapshot of the pipeline counters since startup.
+func (s *AnalyticsService) Stats() model.PipelineStats {
+	return model.PipelineStats{
+		Queued:        s.stats.queued.Load(),
+		Written:       s.stats.written.Load(),
+		Deduplicated:  s.stats.deduplicated.Load(),
+		Dropped:       s.stats.dropped.Load(),
+		Failed:        s.stats.failed.Load(),
+		QueueDepth:    len(s.ch),
+		QueueCapacity: cap(s.ch),
+	}
+}
+
+// RegisterMetrics exposes the pipeline counters and queue depth.
+func (s *AnalyticsService) RegisterMetrics(r *metrics.Registry) {
+	r.Register("analytics_queue_depth", "Analytics events waiting to be written.", metrics.Gauge,
+		metrics.Value(func() float64 { return float64(len(s.ch)) }))
+	r.Register("analytics_queue_capacity", "Capacity of the analytics event queue.", metrics.Gauge,
+		metrics.Value(func() float64 { return float64(cap(s.ch)) }))
+	r.Register("analytics_events_total", "Analytics events by outcome.", metrics.Counter, func() []metrics.Sample {
+		st := s.Stats()
+		return []metrics.Sample{
+			{Labels: []string{"result", "queued"}, Value: float64(st.Queued)},
+			{Labels: []string{"result", "written"}, Value: float64(st.Written)},
+			{Labels: []string{"result", "deduplicated"}, Value: float64(st.Deduplicated)},
+			{Labels: []string{"result", "dropped"}, Value: float64(st.Dropped)},
+			{Labels: []string{"result", "failed"}, Value: float64(st.Failed)},
+		}
+	})
+}
+
+// worker writes queued events in batches: it blocks for the first event,
+// then takes whatever else is already waiting, up to maxBatch.
 func (s *AnalyticsService) worker() {
+	defer close(s.done)
+	batch := make([]analyticsEvent, 0, maxBatch)
 	for e := range s.ch {
-		_ = s.repo.RecordView(e.postID, e.ipHash, e.userAgent)
+		batch = append(batch[:0], e)
+	fill:
+		for len(batch) < maxBatch {
+			select {
+			case e, ok := <-s.ch:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+		s.flush(batch)
+	}
+}
+
+// flush writes events in a single transaction. An event whose statement
+// fails is counted as failed without aborting the rest of the batch.
+func (s *AnalyticsService) flush(events []analyticsEvent) {
+	ctx, cancel := context.WithTimeout(s.ctx, batchTimeout)
+	defer cancel()
+
+	now := time.Now()
+	b, err := s.repo.BeginBatch(ctx)
+	if err != nil {
+		s.stats.failed.Add(int64(len(events)))
+		slog.Error("analytics: begin batch", "events", len(events), "error", err)
+		return
+	}
+
+	var written, failed int64
+	var firstErr error
+	var firstErrReq string // request that queued the first failed event
+	var views []*model.LiveView
+	fail := func(e analyticsEvent, err error) {
+		failed++
+		if firstErr == nil {
+			firstErr, firstErrReq = err, e.requestID
+		}
+	}
+
+	for _, e := range events {
+		switch e.kind {
+		case eventView:
+			// Reloads still count as presence even when deduplicated below.
+			s.live.touchView(e.postID, e.ipHash, e.token, now)
+			if s.cfg.AnalyticsDedupWindow > 0 {
+				seen, err := b.HasRecentView(ctx, e.postID, e.ipHash, now.Add(-s.cfg.AnalyticsDedupWindow))
+				if err != nil {
+					fail(e, err)
+					continue
+				}
+				if seen {
+					s.stats.deduplicated.Add(1)
+					continue
+				}
+			}
+			if err := b.RecordView(ctx, e.postID, e.ipHash, e.userAgent, e.token, e.source); err != nil {
+				fail(e, err)
+				continue
+			}
+			views = append(views, &model.LiveView{
+				PostID:         e.postID,
+				Channel:        e.source.Channel,
+				ReferrerDomain: e.source.ReferrerDomain,
+				ViewedAt:       now.UTC(),
+			})
+		case eventRead:
+			s.live.touchRead(e.token, now)
+			if err := b.RecordRead(ctx, e.token, e.depth, e.engaged, now.Add(-readBeaconMaxAge)); err != nil {
+				fail(e, err)
+				continue
+			}
+		}
+		written++
+	}
+
+	if err := b.Commit(); err != nil {
+		_ = b.Rollback()
+		s.stats.failed.Add(failed + written)
+		slog.Error("analytics: commit batch", "events", len(events), "error", err)
+		return
+	}
+	s.stats.written.Add(written)
+	s.stats.failed.Add(failed)
+	if firstErr != nil {
+		slog.ErrorContext(logging.WithRequestID(context.Background(), firstErrReq),
+			"analytics: events failed", "failed", failed, "events", len(events), "error", firstErr)
+	}
+	for _, v := range views {
+		s.live.publish(v)
 	}
 }
 
-// RecordView queues a view event asynchronously (non-blocking).
-func (s *AnalyticsService) RecordView(postID int64, rawIP, userAgent string) {
-	ipHash := hashIPAnalytics(rawIP, s.cfg.IPHashSecret)
+func (s *AnalyticsService) enqueue(e analyticsEvent) bool {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closed {
+		s.stats.dropped.Add(1)
+		return false
+	}
 	select {
-	case s.ch <- viewEvent{postID: postID, ipHash: ipHash, userAgent: userAgent}:
+	case s.ch <- e:
+		s.stats.queued.Add(1)
+		return true
 	default:
 		// Channel full — drop the event rather than blocking the request
+		s.stats.dropped.Add(1)
+		return false
 	}
 }
 
-func (s *AnalyticsService) GetPostMetrics() ([]*model.PostMetric, error) {
-	return s.repo.GetPostMetrics()
+// RecordView queues a view event asynchronously (non-blocking) and returns
+// the view token reading beacons should report against, or "" if the view
+// isn't recorded. Bots are ignored, and repeat views from the same visitor
+// within AnalyticsDedupWindow are collapsed by the worker.
+func (s *AnalyticsService) RecordView(ctx context.Context, postID int64, rawIP, userAgent string, src model.TrafficSource) string {
+	if isBot(userAgent) {
+		return ""
+	}
+	salt, err := s.dailySalt(ctx, time.Now())
+	if err != nil {
+		return ""
+	}
+	// Strings from Fiber handlers may alias the reused request buffer, so
+	// copy everything that outlives the request.
+	src.ReferrerDomain = strings.Clone(src.ReferrerDomain)
+	src.UTMSource = strings.Clone(src.UTMSource)
+	src.UTMMedium = strings.Clone(src.UTMMedium)
+	src.UTMCampaign = strings.Clone(src.UTMCampaign)
+	e := analyticsEvent{
+		kind:      eventView,
+		token:     uuid.New().String(),
+		postID:    postID,
+		ipHash:    hashVisitor(rawIP, userAgent, salt, s.cfg.IPHashSecret),
+		userAgent: strings.Clone(userAgent),
+		source:    src,
+		requestID: logging.RequestID(ctx),
+	}
+	if !s.enqueue(e) {
+		return ""
+	}
+	return e.token
 }
 
-func (s *AnalyticsService) GetRecentViews(days int) ([]*model.DailyCount, error) {
-	return s.repo.GetRecentViews(days)
+// RecordRead queues a reading beacon for the view identified by token.
+// depth is rounded down to the nearest 25% milestone and engagedSeconds is
+// clamped, so a forged beacon can at worst inflate a single view.
+func (s *AnalyticsService) RecordRead(ctx context.Context, token string, depth, engagedSeconds int) {
+	if _, err := uuid.Parse(token); err != nil {
+		return
+	}
+	depth = min(max(depth, 0), 100) / 25 * 25
+	engagedSeconds = min(max(engagedSeconds, 0), maxEngagedSeconds)
+	if depth == 0 && engagedSeconds == 0 {
+		return
+	}
+	s.enqueue(analyticsEvent{
+		kind:      eventRead,
+		token:     strings.Clone(token),
+		depth:     depth,
+		engaged:   engagedSeconds,
+		requestID: logging.RequestID(ctx),
+	})
 }
 
-func (s *AnalyticsService) TotalViews() (int64, error) {
-	return s.repo.TotalViews()
+// SubscribeLive streams views as they are recorded. The channel is closed
+// when cancel is called, or earlier if the subscriber doesn't keep up, so
+// recording views never waits on a slow dashboard.
+func (s *AnalyticsService) SubscribeLive() (<-chan *model.LiveView, func()) {
+	return s.live.subscribe()
 }
 
-func (s *AnalyticsService) TotalViewsToday() (int64, error) {
-	return s.repo.TotalViewsToday()
+// LiveReaders returns the visitors per post active within LiveWindow.
+func (s *AnalyticsService) LiveReaders(now time.Time) []*model.LiveReaders {
+	return s.live.snapshot(now)
 }
 
-func (s *AnalyticsService) TotalPublishedPosts() (int64, error) {
-	return s.repo.TotalPosts()
+func (s *AnalyticsService) GetPostMetrics(ctx context.Context, f model.AnalyticsFilter) ([]*model.PostMetric, error) {
+	return s.repo.GetPostMetrics(ctx, f)
+}
+
+func (s *AnalyticsService) GetRecentViews(ctx context.Context, days int) ([]*model.DailyCount, error) {
+	return s.repo.GetRecentViews(ctx, days)
+}
+
+// GetDailyViews returns one entry per day of r, including days without views.
+func (s *AnalyticsService) GetDailyViews(ctx context.Context, r model.DateRange, postID int64) ([]*model.DailyCount, error) {
+	counts, err := s.repo.DailyViews(ctx, r.Filter(postID))
+	if err != nil {
+		return nil, err
+	}
+	return fillDays(r, counts), nil
+}
+
+func (s *AnalyticsService) GetViewTotals(ctx context.Context, f model.AnalyticsFilter) (model.ViewTotals, error) {
+	return s.repo.ViewTotals(ctx, f)
+}
+
+func (s *AnalyticsService) TotalViews(ctx context.Context) (int64, error) {
+	return s.repo.TotalViews(ctx)
+}
+
+func (s *AnalyticsService) TotalViewsToday(ctx context.Context) (int64, error) {
+	return s.repo.TotalViewsToday(ctx)
+}
+
+func (s *AnalyticsService) TotalPublishedPosts(ctx context.Context) (int64, error) {
+	return s.repo.TotalPosts(ctx)
+}
+
+func (s *AnalyticsService) TopReferrers(ctx context.Context, f model.AnalyticsFilter, limit int) ([]*model.LabelCount, error) {
+	return s.repo.TopReferrers(ctx, f, limit)
+}
+
+func (s *AnalyticsService) TopCampaigns(ctx context.Context, f model.AnalyticsFilter, limit int) ([]*model.CampaignMetric, error) {
+	return s.repo.TopCampaigns(ctx, f, limit)
+}
+
+func (s *AnalyticsService) ViewsByChannel(ctx context.Context, f model.AnalyticsFilter) ([]*model.LabelCount, error) {
+	return s.repo.ViewsByChannel(ctx, f)
+}
+
+func (s *AnalyticsService) GetPostSourceMetrics(ctx context.Context, f model.AnalyticsFilter) ([]*model.PostSourceMetric, error) {
+	return s.repo.GetPostSourceMetrics(ctx, f)
+}
+
+func (s *AnalyticsService) GetPostEngagement(ctx context.Context, f model.AnalyticsFilter) ([]*model.PostEngagement, error) {
+	return s.repo.GetPostEngagement(ctx, f)
+}
+
+// GetPostReport gathers the per-post analytics for r, together with the
+// totals of the previous period of the same length for comparison.
+func (s *AnalyticsService) GetPostReport(ctx context.Context, postID int64, r model.DateRange) (*model.PostReport, error) {
+	f := r.Filter(postID)
+	report := &model.PostReport{Range: r}
+	var err error
+
+	if report.Totals, err = s.repo.ViewTotals(ctx, f); err != nil {
+		return nil, err
+	}
+	if report.Previous, err = s.repo.ViewTotals(ctx, r.Previous().Filter(postID)); err != nil {
+		return nil, err
+	}
+	if report.Daily, err = s.GetDailyViews(ctx, r, postID); err != nil {
+		return nil, err
+	}
+	if report.Channels, err = s.repo.ViewsByChannel(ctx, f); err != nil {
+		return nil, err
+	}
+	if report.Referrers, err = s.repo.TopReferrers(ctx, f, 20); err != nil {
+		return nil, err
+	}
+	if report.Campaigns, err = s.repo.TopCampaigns(ctx, f, 20); err != nil {
+		return nil, err
+	}
+	engagement, err := s.repo.GetPostEngagement(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if len(engagement) > 0 {
+		report.Engagement = engagement[0]
+	}
+	return report, nil
+}
+
+// ErrInvalidDateRange is returned by ParseDateRange for malformed or
+// out-of-bounds ranges.
+var ErrInvalidDateRange = apperr.New(http.StatusBadRequest, "The date range is invalid. Use YYYY-MM-DD dates, at most three years apart.")
+
+const (
+	defaultRangeDays = 30
+	maxRangeDays     = 3 * 366
+)
+
+// ParseDateRange parses "2006-01-02" bounds as an inclusive range of UTC
+// days. Missing bounds default to the 30 days ending today.
+func ParseDateRange(from, to string, now time.Time) (model.DateRange, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	r := model.DateRange{To: today}
+	var err error
+	if to != "" {
+		if r.To, err = time.Parse("2006-01-02", to); err != nil {
+			return model.DateRange{}, ErrInvalidDateRange
+		}
+	}
+	r.From = r.To.AddDate(0, 0, -(defaultRangeDays - 1))
+	if from != "" {
+		if r.From, err = time.Parse("2006-01-02", from); err != nil {
+			return model.DateRange{}, ErrInvalidDateRange
+		}
+	}
+	if r.From.After(r.To) || r.Days() > maxRangeDays {
+		return model.DateRange{}, ErrInvalidDateRange
+	}
+	return r, nil
+}
+
+// DateRangePresets returns the shortcuts offered next to the date inputs.
+func DateRangePresets(now time.Time) []model.RangePreset {
+	today := now.UTC()
+	var presets []model.RangePreset
+	for _, p := range []struct {
+		label string
+		days  int
+	}{{"7 days", 7}, {"30 days", 30}, {"90 days", 90}, {"1 year", 365}} {
+		presets = append(presets, model.RangePreset{
+			Label: p.label,
+			From:  today.AddDate(0, 0, -(p.days - 1)).Format("2006-01-02"),
+			To:    today.Format("2006-01-02"),
+		})
+	}
+	return presets
+}
+
+// fillDays expands sparse daily counts into one entry per day of r.
+func fillDays(r model.DateRange, counts []*model.DailyCount) []*model.DailyCount {
+	byDay := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byDay[c.Day] = c.Count
+	}
+	days := make([]*model.DailyCount, 0, r.Days())
+	for d := r.From; !d.After(r.To); d = d.AddDate(0, 0, 1) {
+		day := d.Format("2006-01-02")
+		days = append(days, &model.DailyCount{Day: day, Count: byDay[day]})
+	}
+	return days
+}
+
+// dailySalt returns the salt for the UTC day containing now. The salt is
+// persisted so restarts keep deduplicating, and discarded the next day so a
+// visitor can't be followed from one day to another.
+func (s *AnalyticsService) dailySalt(ctx context.Context, now time.Time) (string, error) {
+	day := now.UTC().Format("2006-01-02")
+
+	s.saltMu.Lock()
+	defer s.saltMu.Unlock()
+	if s.saltDay == day {
+		return s.salt, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	salt, err := s.repo.GetOrCreateSalt(ctx, day, hex.EncodeToString(b))
+	if err != nil {
+		return "", err
+	}
+	s.saltDay, s.salt = day, salt
+	return salt, nil
 }
 
-func hashIPAnalytics(ip, secret string) string {
-	h := sha256.Sum256([]byte(ip + secret))
+func hashVisitor(ip, userAgent, salt, secret string) string {
+	h := sha256.Sum256([]byte(salt + ip + userAgent + secret))
 	return base64.StdEncoding.EncodeToString(h[:])
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -42,8 +43,8 @@ func NewAuthService(users *repository.UserRepo, sessions *repository.SessionRepo
 	return &AuthService{users: users, sessions: sessions, cfg: cfg, gcm: gcm}, nil
 }
 
-func (s *AuthService) Login(username, password, rawIP, userAgent string) (*model.Session, error) {
-	user, err := s.users.GetByUsername(username)
+func (s *AuthService) Login(ctx context.Context, username, password, rawIP, userAgent string) (*model.Session, error) {
+	user, err := s.users.GetByUsername(ctx, username)
 	if errors.Is(err, repository.ErrNotFound) {
 		// Constant-time comparison to prevent timing attacks
 		_ = bcrypt.CompareHashAndPassword([]byte("$2a$12$fakehash"), []byte(password))
@@ -72,14 +73,14 @@ func (s *AuthService) Login(username, password, rawIP, userAgent string) (*model
 		ExpiresAt: time.Now().Add(s.cfg.SessionDuration),
 	}
 
-	if err := s.sessions.Create(session); err != nil {
+	if err := s.sessions.Create(ctx, session); err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
-func (s *AuthService) Validate(sessionID string) (*model.AdminUser, error) {
-	session, err := s.sessions.Get(sessionID)
+func (s *AuthService) Validate(ctx context.Context, sessionID string) (*model.AdminUser, error) {
+	session, err := s.sessions.Get(ctx, sessionID)
 	if errors.Is(err, repository.ErrNotFound) {
 		return nil, ErrSessionExpired
 	}
@@ -87,26 +88,26 @@ func (s *AuthService) Validate(sessionID string) (*model.AdminUser, error) {
 		return nil, err
 	}
 	if session.IsExpired() {
-		_ = s.sessions.Delete(sessionID)
+		_ = s.sessions.Delete(ctx, sessionID)
 		return nil, ErrSessionExpired
 	}
-	user, err := s.users.GetByID(session.UserID)
+	user, err := s.users.GetByID(ctx, session.UserID)
 	if errors.Is(err, repository.ErrNotFound) {
 		return nil, ErrSessionExpired
 	}
 	return user, err
 }
 
-func (s *AuthService) Logout(sessionID string) error {
-	return s.sessions.Delete(sessionID)
+func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
+	return s.sessions.Delete(ctx, sessionID)
 }
 
-func (s *AuthService) CreateUser(username, password, email string) error {
+func (s *AuthService) CreateUser(ctx context.Context, username, password, email string) error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
-	_, err = s.users.Create(username, string(hash), email)
+	_, err = s.users.Create(ctx, username, string(hash), email)
 	return err
 }
 
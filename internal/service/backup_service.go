@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+	"github.com/mhtecdev/blog-ai/internal/backup"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/database"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+)
+
+var ErrBackupNotFound = apperr.New(http.StatusNotFound, "This backup doesn't exist. It may have been rotated out.")
+
+// BackupService takes backups on demand and on a schedule, deleting the
+// oldest ones beyond cfg.BackupKeep.
+type BackupService struct {
+	db  *database.DB
+	cfg *config.Config
+
+	mu          sync.Mutex // one backup at a time
+	lastSuccess atomic.Int64
+	failures    atomic.Int64
+
+	stop     chan struct{}
+	done     chan struct{} // closed when loop returns
+	stopOnce sync.Once
+	ctx      context.Context // cancelled when Close runs out of time
+	cancel   context.CancelFunc
+}
+
+func NewBackupService(db *database.DB, cfg *config.Config) *BackupService {
+	svc := &BackupService{
+		db:   db,
+		cfg:  cfg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	svc.ctx, svc.cancel = context.WithCancel(context.Background())
+	if cfg.BackupInterval > 0 {
+		go svc.loop()
+	} else {
+		close(svc.done)
+	}
+	return svc
+}
+
+// backupRetry is how long the schedule waits to try again after a failed
+// backup. It doubles with each failure in a row, up to BackupInterval.
+const backupRetry = time.Minute
+
+// loop takes a backup whenever the newest archive is BackupInterval old, so
+// restarts neither skip nor repeat one. A failed backup writes no archive,
+// leaving the next one due at once, so failures back off instead.
+func (s *BackupService) loop() {
+	defer close(s.done)
+	var retry time.Duration // zero unless the last backup failed
+	for {
+		timer := time.NewTimer(max(s.untilDue(time.Now()), retry))
+		select {
+		case <-timer.C:
+			if _, err := s.Create(s.ctx); err != nil {
+				retry = min(max(2*retry, backupRetry), s.cfg.BackupInterval)
+				slog.Error("backup: scheduled backup failed", "error", err, "retry_in", retry.String())
+			} else {
+				retry = 0
+			}
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (s *BackupService) untilDue(now time.Time) time.Duration {
+	archives, err := backup.List(s.cfg.BackupDir)
+	if err != nil {
+		slog.Error("backup: list archives", "error", err)
+		return s.cfg.BackupInterval
+	}
+	if len(archives) == 0 {
+		return 0
+	}
+	return max(archives[0].CreatedAt.Add(s.cfg.BackupInterval).Sub(now), 0)
+}
+
+// Close stops the schedule and waits for a backup in progress to finish, or
+// until ctx is done, in which case the backup is cancelled.
+func (s *BackupService) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	defer s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Create writes a new archive of the database and uploads, then rotates old
+// ones out.
+func (s *BackupService) Create(ctx context.Context) (*backup.Archive, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := time.Now()
+	a, err := backup.Create(ctx, s.db, s.cfg.UploadDir, s.cfg.BackupDir, start)
+	if err != nil {
+		s.failures.Add(1)
+		return nil, err
+	}
+	s.lastSuccess.Store(a.CreatedAt.Unix())
+	slog.InfoContext(ctx, "backup: created", "archive", a.Name, "bytes", a.Size, "duration", time.Since(start).String())
+
+	removed, err := backup.Prune(s.cfg.BackupDir, s.cfg.BackupKeep)
+	if err != nil {
+		slog.ErrorContext(ctx, "backup: rotate", "error", err)
+	}
+	for _, name := range removed {
+		slog.InfoContext(ctx, "backup: rotated out", "archive", name)
+	}
+	return a, nil
+}
+
+// List returns the archives in the backup directory, newest first.
+func (s *BackupService) List() ([]backup.Archive, error) {
+	return backup.List(s.cfg.BackupDir)
+}
+
+// Path returns the file of the archive called name.
+func (s *BackupService) Path(name string) (string, error) {
+	p, err := backup.Path(s.cfg.BackupDir, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrBackupNotFound
+	}
+	return p, err
+}
+
+// RegisterMetrics exposes when the last backup succeeded and how many failed.
+func (s *BackupService) RegisterMetrics(r *metrics.Registry) {
+	r.Register("backup_last_success_timestamp_seconds", "Unix time of the last successful backup by this process.", metrics.Gauge,
+		metrics.Value(func() float64 { return float64(s.lastSuccess.Load()) }))
+	r.Register("backup_failures_total", "Backups that failed.", metrics.Counter,
+		metrics.Value(func() float64 { return float64(s.failures.Load()) }))
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/mailer"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/repository"
+)
+
+const (
+	digestCheckInterval = 15 * time.Minute
+	digestTopPosts      = 5
+)
+
+// DigestService emails a weekly summary of the blog's analytics.
+type DigestService struct {
+	repo      *repository.AnalyticsRepo
+	analytics *AnalyticsService
+	mailer    mailer.Mailer
+	cfg       *config.Config
+
+	stop     chan struct{}
+	done     chan struct{} // closed when loop returns
+	stopOnce sync.Once
+	ctx      context.Context // cancelled when Close runs out of time
+	cancel   context.CancelFunc
+}
+
+func NewDigestService(repo *repository.AnalyticsRepo, analytics *AnalyticsService, m mailer.Mailer, cfg *config.Config) *DigestService {
+	svc := &DigestService{
+		repo:      repo,
+		analytics: analytics,
+		mailer:    m,
+		cfg:       cfg,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	svc.ctx, svc.cancel = context.WithCancel(context.Background())
+	if cfg.DigestEnabled {
+		go svc.loop()
+	} else {
+		close(svc.done)
+	}
+	return svc
+}
+
+func (s *DigestService) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDue(s.ctx, time.Now()); err != nil {
+			slog.Error("digest: send failed", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close stops the schedule and waits for a digest being sent to finish, or
+// until ctx is done, in which case the send is cancelled.
+func (s *DigestService) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	defer s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendDue sends the digest for the most recent scheduled week unless it was
+// already sent, and reports whether it sent one. A digest missed while the
+// server was down goes out at the next check.
+func (s *DigestService) SendDue(ctx context.Context, now time.Time) (bool, error) {
+	r := digestRange(lastSchedule(now, s.cfg.DigestWeekday, s.cfg.DigestHour))
+	period := r.From.Format("2006-01-02") + "/" + r.To.Format("2006-01-02")
+
+	claimed, err := s.repo.ClaimDigest(ctx, period)
+	if err != nil || !claimed {
+		return false, err
+	}
+	if err := s.send(ctx, r); err != nil {
+		if rerr := s.repo.ReleaseDigest(ctx, period); rerr != nil {
+			slog.Error("digest: release claim", "period", period, "error", rerr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Send builds and sends the digest for the seven days before now's UTC day,
+// regardless of the schedule.
+func (s *DigestService) Send(ctx context.Context, now time.Time) error {
+	return s.send(ctx, digestRange(now))
+}
+
+func (s *DigestService) send(ctx context.Context, r model.DateRange) error {
+	d, err := s.Build(ctx, r)
+	if err != nil {
+		return err
+	}
+	msg, err := s.Render(d)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Build collects the totals and top posts of r, each compared against the
+// previous period of the same length.
+func (s *DigestService) Build(ctx context.Context, r model.DateRange) (*model.Digest, error) {
+	d := &model.Digest{Range: r}
+	var err error
+	if d.Totals, err = s.analytics.GetViewTotals(ctx, r.Filter(0)); err != nil {
+		return nil, err
+	}
+	if d.Previous, err = s.analytics.GetViewTotals(ctx, r.Previous().Filter(0)); err != nil {
+		return nil, err
+	}
+
+	current, err := s.analytics.GetPostMetrics(ctx, r.Filter(0))
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.analytics.GetPostMetrics(ctx, r.Previous().Filter(0))
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[int64]int64, len(previous))
+	for _, m := range previous {
+		before[m.PostID] = m.ViewCount
+	}
+	for _, m := range current {
+		if m.ViewCount == 0 || len(d.Posts) == digestTopPosts {
+			break
+		}
+		d.Posts = append(d.Posts, &model.DigestPost{
+			Title:         m.Title,
+			Slug:          m.Slug,
+			Views:         m.ViewCount,
+			PreviousViews: before[m.PostID],
+		})
+	}
+	return d, nil
+}
+
+var digestTmpl = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"day":   func(t time.Time) string { return t.Format("Jan 2, 2006") },
+	"delta": formatDelta,
+	"inc":   func(i int) int { return i + 1 },
+}).Parse(`Weekly report for {{day .Digest.Range.From}} – {{day .Digest.Range.To}}
+
+Views:            {{.Digest.Totals.Views}} ({{delta .Digest.Previous.Views .Digest.ViewsChange}})
+Unique visitors:  {{.Digest.Totals.Visitors}} ({{delta .Digest.Previous.Visitors .Digest.VisitorsChange}})
+{{if .Digest.Posts}}
+Top posts
+{{range $i, $p := .Digest.Posts}}
+{{inc $i}}. {{$p.Title}}
+   {{$p.Views}} views ({{delta $p.PreviousViews $p.Change}})
+   {{$.SiteURL}}/posts/{{$p.Slug}}
+{{end}}{{else}}
+No views this week.
+{{end}}
+Full metrics: {{.SiteURL}}/studio/metrics?from={{.Digest.Range.From.Format "2006-01-02"}}&to={{.Digest.Range.To.Format "2006-01-02"}}
+`))
+
+// Render turns d into the email sent to the digest recipients.
+func (s *DigestService) Render(d *model.Digest) (*mailer.Message, error) {
+	var body bytes.Buffer
+	if err := digestTmpl.Execute(&body, map[string]interface{}{
+		"Digest":  d,
+		"SiteURL": s.cfg.SiteURL,
+	}); err != nil {
+		return nil, err
+	}
+	return &mailer.Message{
+		From:    s.cfg.MailFrom,
+		To:      s.cfg.DigestTo,
+		Subject: fmt.Sprintf("Weekly blog report: %d views (%s)", d.Totals.Views, formatDelta(d.Previous.Views, d.ViewsChange())),
+		Body:    body.String(),
+	}, nil
+}
+
+// formatDelta describes a percentage change, or "new" when there was nothing
+// to compare against.
+func formatDelta(before int64, change float64) string {
+	if before == 0 {
+		return "new"
+	}
+	return fmt.Sprintf("%+.0f%% vs previous week", change)
+}
+
+// digestRange is the seven full UTC days before now's day.
+func digestRange(now time.Time) model.DateRange {
+	to := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	return model.DateRange{From: to.AddDate(0, 0, -6), To: to}
+}
+
+// lastSchedule returns the most recent weekday/hour (UTC) not after now.
+func lastSchedule(now time.Time, weekday time.Weekday, hour int) time.Time {
+	now = now.UTC()
+	day := now.Truncate(24 * time.Hour)
+	at := day.AddDate(0, 0, -int((now.Weekday()-weekday+7)%7)).Add(time.Duration(hour) * time.Hour)
+	if at.After(now) {
+		at = at.AddDate(0, 0, -7)
+	}
+	return at
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/mhtecdev/blog-ai/internal/diagram"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeRenderer renders fenced code blocks highlighted by Chroma. Tokens get
+// classes rather than inline styles, so highlighting works under the strict
+// CSP; CodeCSS returns the stylesheet colouring them.
+//
+// The fence's info string names the language and may set, in braces:
+//
+//	```go {linenos=true hl_lines="3 5-7" linenostart=10}
+//
+// linenos shows line numbers, hl_lines highlights lines by their displayed
+// number and linenostart numbers the first line.
+//
+// Mermaid blocks are drawn as SVG by the diagram package; one it can't draw
+// is shown as code.
+type codeRenderer struct{}
+
+func (codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, renderCodeBlock)
+}
+
+func renderCodeBlock(w util.BufWriter, src []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		code.Write(seg.Value(src))
+	}
+	var info string
+	if n.Info != nil {
+		info = string(n.Info.Segment.Value(src))
+	}
+	lang, opts := parseFence(info)
+	if lang == "mermaid" {
+		if svg, ok := diagram.Render(code.String()); ok {
+			w.WriteString(`<div class="diagram">` + svg + "</div>\n")
+			return ast.WalkSkipChildren, nil
+		}
+	}
+
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	// The style only matters for inline styles, which are off.
+	if err := chromahtml.New(opts...).Format(w, styles.Fallback, tokens); err != nil {
+		return ast.WalkStop, err
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+var fenceAttrRe = regexp.MustCompile(`(\w+)\s*=\s*(\[[^\]]*\]|"[^"]*"|[^\s,}]+)`)
+
+// parseFence splits a fence's info string into its language and the
+// formatter options its attributes ask for. Unknown attributes and values
+// that don't parse are ignored.
+func parseFence(info string) (string, []chromahtml.Option) {
+	lang, attrs, _ := strings.Cut(strings.TrimSpace(info), "{")
+	lang = strings.TrimSpace(lang)
+	if i := strings.IndexAny(lang, " \t"); i >= 0 {
+		lang = lang[:i]
+	}
+	opts := []chromahtml.Option{chromahtml.WithClasses(true)}
+	for _, m := range fenceAttrRe.FindAllStringSubmatch(attrs, -1) {
+		value := strings.Trim(m[2], `"`)
+		switch m[1] {
+		case "linenos":
+			opts = append(opts, chromahtml.WithLineNumbers(value != "false"))
+		case "linenostart":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				opts = append(opts, chromahtml.BaseLineNumber(n))
+			}
+		case "hl_lines":
+			opts = append(opts, chromahtml.HighlightLines(lineRanges(value)))
+		}
+	}
+	return lang, opts
+}
+
+// lineRanges parses line numbers and ranges such as "3 5-7" or [3,"5-7"].
+func lineRanges(s string) [][2]int {
+	var ranges [][2]int
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune(` ,[]"`, r) }) {
+		from, to, isRange := strings.Cut(f, "-")
+		a, err := strconv.Atoi(from)
+		if err != nil {
+			continue
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(to); err != nil || b < a {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{a, b})
+	}
+	return ranges
+}
+
+// codeClassRe matches the class attribute of an element Chroma emits: one
+// or more of its class names.
+var codeClassRe = func() *regexp.Regexp {
+	var names []string
+	for _, class := range chroma.StandardTypes {
+		if class != "" {
+			names = append(names, regexp.QuoteMeta(class))
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+	name := `(?:` + strings.Join(names, `|`) + `)`
+	return regexp.MustCompile(`^` + name + `(?: ` + name + `)*$`)
+}()
+
+// CodeCSS returns the stylesheet colouring highlighted code: the Chroma
+// style named light, and dark under the dark theme.
+func CodeCSS(light, dark string) (string, error) {
+	var b bytes.Buffer
+	for _, theme := range []struct{ name, scope string }{{light, ""}, {dark, `[data-theme="dark"] `}} {
+		style, ok := styles.Registry[theme.name]
+		if !ok {
+			return "", fmt.Errorf("unknown code theme %q; Chroma has %s", theme.name, strings.Join(styles.Names(), ", "))
+		}
+		var css bytes.Buffer
+		if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&css, style); err != nil {
+			return "", err
+		}
+		for _, line := range strings.SplitAfter(css.String(), "\n") {
+			// Each rule is "/* Name */ .chroma .k { … }".
+			comment, rule, ok := strings.Cut(line, "*/ ")
+			if !ok || strings.HasPrefix(rule, ".bg ") {
+				continue
+			}
+			b.WriteString(comment + "*/ " + theme.scope + rule)
+		}
+	}
+	return b.String(), nil
+}
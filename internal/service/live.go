@@ -0,0 +1,157 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+const (
+	// LiveWindow is how long a visitor counts as a current reader after their
+	// last view or reading beacon.
+	LiveWindow = 5 * time.Minute
+	// liveBuffer is the per-subscriber backlog; subscribers that fall further
+	// behind are dropped.
+	liveBuffer = 32
+	// maxLiveReaders bounds the presence table so a flood of fake visitors
+	// can't grow it without limit.
+	maxLiveReaders = 10000
+)
+
+// liveHub fans view events out to subscribers and tracks which visitors were
+// active on which post within LiveWindow. It is fed by the analytics worker
+// and read by the live dashboard stream.
+type liveHub struct {
+	mu        sync.Mutex
+	subs      map[chan *model.LiveView]struct{}
+	readers   map[liveKey]time.Time // last activity per visitor and post
+	tokens    map[string]liveKey    // view token -> reader, for beacons
+	lastPrune time.Time
+}
+
+type liveKey struct {
+	postID  int64
+	visitor string
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{
+		subs:    make(map[chan *model.LiveView]struct{}),
+		readers: make(map[liveKey]time.Time),
+		tokens:  make(map[string]liveKey),
+	}
+}
+
+// subscribe registers a listener for view events. The returned channel is
+// closed when the subscriber is dropped for falling behind or when cancel is
+// called.
+func (h *liveHub) subscribe() (<-chan *model.LiveView, func()) {
+	ch := make(chan *model.LiveView, liveBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// publish delivers v to every subscriber without blocking.
+func (h *liveHub) publish(v *model.LiveView) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- v:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeAll ends every subscription, e.g. so open streams don't hold up a
+// server shutdown.
+func (h *liveHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// touchView marks the visitor behind a view as reading postID.
+func (h *liveHub) touchView(postID int64, visitor, token string, now time.Time) {
+	key := liveKey{postID: postID, visitor: visitor}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(now)
+	if _, ok := h.readers[key]; !ok && len(h.readers) >= maxLiveReaders {
+		return
+	}
+	h.readers[key] = now
+	if len(h.tokens) < maxLiveReaders {
+		h.tokens[token] = key
+	}
+}
+
+// touchRead refreshes the reader a beacon's view token belongs to.
+func (h *liveHub) touchRead(token string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if key, ok := h.tokens[token]; ok {
+		h.readers[key] = now
+	}
+}
+
+// snapshot counts active visitors per post, busiest first.
+func (h *liveHub) snapshot(now time.Time) []*model.LiveReaders {
+	h.mu.Lock()
+	counts := make(map[int64]int)
+	for key, seen := range h.readers {
+		if now.Sub(seen) <= LiveWindow {
+			counts[key.postID]++
+		}
+	}
+	h.mu.Unlock()
+
+	list := make([]*model.LiveReaders, 0, len(counts))
+	for postID, n := range counts {
+		list = append(list, &model.LiveReaders{PostID: postID, Readers: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Readers != list[j].Readers {
+			return list[i].Readers > list[j].Readers
+		}
+		return list[i].PostID < list[j].PostID
+	})
+	return list
+}
+
+// prune drops readers idle for longer than LiveWindow, at most once a minute.
+// Callers must hold h.mu.
+func (h *liveHub) prune(now time.Time) {
+	if now.Sub(h.lastPrune) < time.Minute {
+		return
+	}
+	h.lastPrune = now
+	for key, seen := range h.readers {
+		if now.Sub(seen) > LiveWindow {
+			delete(h.readers, key)
+		}
+	}
+	for token, key := range h.tokens {
+		if _, ok := h.readers[key]; !ok {
+			delete(h.tokens, token)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+
+	"github.com/mhtecdev/blog-ai/internal/mathml"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// mathExtension renders LaTeX math to MathML: $…$ inline, and $$…$$ as a
+// display formula, either inside a paragraph or on lines of its own. A
+// display block must be closed by a $$ ending a line before the next blank
+// one; otherwise its lines stay text.
+//
+// As in Pandoc, inline math must not start with a space after the opening $
+// or end with one before the closing $, and the closing $ must not be
+// followed by a digit, so "$5 and $10" stays text. \$ is a literal dollar.
+// Inline math ends at the next $ and on its line.
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 750)),
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 500)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 500)))
+}
+
+var (
+	kindMath      = ast.NewNodeKind("Math")
+	kindMathBlock = ast.NewNodeKind("MathBlock")
+)
+
+// mathNode is a formula within a paragraph.
+type mathNode struct {
+	ast.BaseInline
+	tex     string
+	display bool
+}
+
+func (n *mathNode) Kind() ast.NodeKind { return kindMath }
+
+func (n *mathNode) Dump(src []byte, level int) {
+	ast.DumpHelper(n, src, level, map[string]string{"TeX": n.tex}, nil)
+}
+
+// mathBlock is a display formula on lines of its own.
+type mathBlock struct {
+	ast.BaseBlock
+	tex    string
+	closed bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) Dump(src []byte, level int) {
+	ast.DumpHelper(n, src, level, map[string]string{"TeX": n.tex}, nil)
+}
+
+var mathDelim = []byte("$$")
+
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], mathDelim) {
+		return nil, parser.NoChildren
+	}
+	rest := line[pos+2:]
+	if end := bytes.Index(rest, mathDelim); end >= 0 {
+		// $$…$$ on one line is a block only if nothing follows it.
+		if !util.IsBlank(rest[end+2:]) {
+			return nil, parser.NoChildren
+		}
+		return &mathBlock{tex: string(rest[:end]), closed: true}, parser.NoChildren
+	}
+	// As in Pandoc, a $$ that nothing closes is text: "$$ is the shell's
+	// PID" mustn't swallow the rest of the post.
+	if !closedLater(reader.Source()[segment.Stop:]) {
+		return nil, parser.NoChildren
+	}
+	return &mathBlock{tex: string(rest)}, parser.NoChildren
+}
+
+// closedLater reports whether a line of src before the first blank one has a
+// closing $$ with nothing after it.
+func closedLater(src []byte) bool {
+	for len(src) > 0 {
+		var line []byte
+		line, src, _ = bytes.Cut(src, []byte("\n"))
+		if util.IsBlank(line) {
+			return false
+		}
+		if end := bytes.Index(line, mathDelim); end >= 0 {
+			return util.IsBlank(line[end+2:])
+		}
+	}
+	return false
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*mathBlock)
+	if n.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	if end := bytes.Index(line, mathDelim); end >= 0 {
+		n.tex += string(line[:end])
+		newline := 0
+		if line[len(line)-1] == '\n' {
+			newline = 1
+		}
+		reader.Advance(segment.Stop - segment.Start - newline + segment.Padding)
+		return parser.Close
+	}
+	n.tex += string(line)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if bytes.HasPrefix(line, mathDelim) {
+		end := bytes.Index(line[2:], mathDelim)
+		if end < 1 {
+			return nil
+		}
+		block.Advance(end + 4)
+		return &mathNode{tex: string(line[2 : 2+end]), display: true}
+	}
+	if len(line) < 3 || util.IsSpace(line[1]) {
+		return nil
+	}
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			if util.IsSpace(line[i-1]) || i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+				return nil
+			}
+			block.Advance(i + 1)
+			return &mathNode{tex: string(line[1:i])}
+		case '\n':
+			return nil
+		}
+	}
+	return nil
+}
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, func(w util.BufWriter, src []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			n := node.(*mathNode)
+			w.WriteString(mathml.Convert(n.tex, n.display))
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	reg.Register(kindMathBlock, func(w util.BufWriter, src []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			w.WriteString(`<div class="math-display">`)
+			w.WriteString(mathml.Convert(node.(*mathBlock).tex, true))
+			w.WriteString("</div>\n")
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
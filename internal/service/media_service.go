@@ -1,15 +1,21 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
 	"github.com/mhtecdev/blog-ai/internal/config"
 	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/repository"
@@ -26,6 +32,9 @@ var allowedMIMEs = map[string]string{
 	"audio/ogg":   ".ogg",
 }
 
+// ErrUnsupportedMedia is returned by Upload for files outside allowedMIMEs.
+var ErrUnsupportedMedia = apperr.New(http.StatusBadRequest, "This file type is not supported. Upload an image (JPEG, PNG, GIF, WebP), video (MP4, WebM) or audio (MP3, Ogg) file.")
+
 type MediaService struct {
 	repo *repository.MediaRepo
 	cfg  *config.Config
@@ -35,7 +44,7 @@ func NewMediaService(repo *repository.MediaRepo, cfg *config.Config) *MediaServi
 	return &MediaService{repo: repo, cfg: cfg}
 }
 
-func (s *MediaService) Upload(fh *multipart.FileHeader, uploaderID int64) (*model.Media, error) {
+func (s *MediaService) Upload(ctx context.Context, fh *multipart.FileHeader, uploaderID int64) (*model.Media, error) {
 	mimeType := fh.Header.Get("Content-Type")
 	// Strip parameters (e.g. "image/jpeg; charset=utf-8" → "image/jpeg")
 	if idx := strings.Index(mimeType, ";"); idx != -1 {
@@ -44,12 +53,13 @@ func (s *MediaService) Upload(fh *multipart.FileHeader, uploaderID int64) (*mode
 
 	ext, ok := allowedMIMEs[mimeType]
 	if !ok {
-		return nil, errors.New("unsupported file type")
+		return nil, ErrUnsupportedMedia
 	}
 
 	maxBytes := s.cfg.UploadMaxMB * 1024 * 1024
 	if fh.Size > maxBytes {
-		return nil, fmt.Errorf("file too large (max %dMB)", s.cfg.UploadMaxMB)
+		return nil, apperr.New(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("The file is too large (max %dMB).", s.cfg.UploadMaxMB))
 	}
 
 	filename := uuid.New().String() + ext
@@ -84,5 +94,75 @@ func (s *MediaService) Upload(fh *multipart.FileHeader, uploaderID int64) (*mode
 		UploadedBy: uploaderID,
 	}
 
-	return s.repo.Create(media)
+	return s.repo.Create(ctx, media)
+}
+
+// importNameRe limits imported media to plain file names, like the ones
+// Upload generates.
+var importNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Import stores an imported file under its own name, so the posts that link
+// to it keep working, and returns the name it was stored under. A name that
+// already holds the same bytes is reused rather than stored again (created is
+// false); one holding a different file is kept, and the import goes to the
+// next free name-2.ext, name-3.ext and so on. Types Upload would refuse are
+// ErrUnsupportedMedia.
+func (s *MediaService) Import(ctx context.Context, name string, data []byte, uploaderID int64) (stored string, created bool, err error) {
+	mimeType := mimeForExt(filepath.Ext(name))
+	if mimeType == "" || !importNameRe.MatchString(name) {
+		return "", false, ErrUnsupportedMedia
+	}
+	if err := os.MkdirAll(s.cfg.UploadDir, 0o755); err != nil {
+		return "", false, err
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	var dst *os.File
+	for n := 1; ; n++ {
+		stored = name
+		if n > 1 {
+			stored = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		path := filepath.Join(s.cfg.UploadDir, stored)
+		dst, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", false, err
+		}
+		if existing, rerr := os.ReadFile(path); rerr == nil && bytes.Equal(existing, data) {
+			return stored, false, nil
+		}
+	}
+	defer dst.Close()
+	if _, err := dst.Write(data); err != nil {
+		return "", false, err
+	}
+
+	_, err = s.repo.Create(ctx, &model.Media{
+		Filename:   stored,
+		Original:   name,
+		MimeType:   mimeType,
+		SizeBytes:  int64(len(data)),
+		URL:        "/static/uploads/" + stored,
+		UploadedBy: uploaderID,
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return stored, true, nil
+}
+
+func mimeForExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+	for mimeType, e := range allowedMIMEs {
+		if e == ext {
+			return mimeType
+		}
+	}
+	return ""
 }
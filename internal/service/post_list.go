@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+var ErrInvalidCursor = apperr.New(http.StatusBadRequest, "This page link is invalid. Go back to the first page and try again.")
+
+// ListPage returns the page of posts q selects.
+func (s *PostService) ListPage(ctx context.Context, q model.PostQuery) (*model.PostPage, error) {
+	return s.repo.List(ctx, q)
+}
+
+// Archive returns the years and months in which posts were published,
+// latest first.
+func (s *PostService) Archive(ctx context.Context) ([]model.ArchiveYear, error) {
+	months, err := s.repo.ArchiveMonths(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var years []model.ArchiveYear
+	for _, m := range months {
+		if len(years) == 0 || years[len(years)-1].Year != m.Year {
+			years = append(years, model.ArchiveYear{Year: m.Year})
+		}
+		y := &years[len(years)-1]
+		y.Count += m.Count
+		y.Months = append(y.Months, m)
+	}
+	return years, nil
+}
+
+// EncodeCursor returns c as it appears in page links, or "" if c is nil.
+// The form is opaque to readers but not signed: a forged cursor only picks
+// another starting point.
+func EncodeCursor(c *model.PostCursor) string {
+	if c == nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.ID, 10) + ":" + c.Key))
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor.
+func DecodeCursor(s string) (*model.PostCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, apperr.Wrap(err, ErrInvalidCursor)
+	}
+	id, key, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, apperr.Wrap(errors.New("cursor without id"), ErrInvalidCursor)
+	}
+	c := &model.PostCursor{Key: key}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, apperr.Wrap(err, ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+// SetCursor points q at the page named by the after or before parameter of
+// a page link; with neither, q stays on the first page.
+func SetCursor(q *model.PostQuery, after, before string) error {
+	var err error
+	switch {
+	case after != "":
+		q.After, err = DecodeCursor(after)
+	case before != "":
+		q.Before, err = DecodeCursor(before)
+	}
+	return err
+}
@@ -1,25 +1,32 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"regexp"
 	"strings"
 	"time"
 	"unicode"
 
-	"github.com/microcosm-cc/bluemonday"
+	"github.com/mhtecdev/blog-ai/internal/apperr"
 	"github.com/mhtecdev/blog-ai/internal/model"
 	"github.com/mhtecdev/blog-ai/internal/repository"
+	"github.com/microcosm-cc/bluemonday"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 )
 
 var (
-	ErrSlugConflict = errors.New("slug already in use")
-	ErrNotFound     = errors.New("not found")
+	ErrSlugConflict = apperr.New(http.StatusConflict, "Another post already uses this slug. Change the title and try again.")
+	ErrNotFound     = apperr.New(http.StatusNotFound, "The post you're looking for doesn't exist.")
 )
 
 type PostInput struct {
@@ -29,12 +36,14 @@ type PostInput struct {
 	CoverImage string
 	Category   string
 	Tags       string
+	HideTOC    bool
 }
 
 type PostService struct {
 	repo   *repository.PostRepo
 	mdParser goldmark.Markdown
 	sanitizer *bluemonday.Policy
+	onChange []func(before, after *model.Post)
 }
 
 func NewPostService(repo *repository.PostRepo) *PostService {
@@ -42,6 +51,8 @@ func NewPostService(repo *repository.PostRepo) *PostService {
 		goldmark.WithExtensions(
 			extension.GFM,
 			extension.Footnote,
+			mathExtension{},
+			shortcodeExtension{},
 		),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
@@ -50,75 +61,145 @@ func NewPostService(repo *repository.PostRepo) *PostService {
 			html.WithHardWraps(),
 			html.WithXHTML(),
 			html.WithUnsafe(), // allow raw HTML in Markdown (needed for <video>/<audio>)
+			renderer.WithNodeRenderers(util.Prioritized(codeRenderer{}, 200)), // before goldmark's, at 1000
 		),
 	)
 
 	policy := bluemonday.UGCPolicy()
-	// Allow video/audio tags inserted by the editor
+	// Allow video/audio tags, from shortcodes and from raw HTML in older posts
 	policy.AllowElements("video", "audio", "source")
 	policy.AllowAttrs("controls", "src", "type", "width", "height").OnElements("video", "audio")
 	policy.AllowAttrs("src", "type").OnElements("source")
+	// Heading anchors added by renderMarkdown
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^heading-anchor$`)).OnElements("a")
+	// Highlighted code
+	policy.AllowAttrs("class").Matching(codeClassRe).OnElements("pre", "span")
+	// Mermaid diagrams drawn by the diagram package
+	svgNumber := regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^diagram$`)).OnElements("div", "svg")
+	policy.AllowAttrs("viewbox").Matching(regexp.MustCompile(`^-?[0-9.]+( -?[0-9.]+){3}$`)).OnElements("svg")
+	policy.AllowAttrs("role").Matching(regexp.MustCompile(`^img$`)).OnElements("svg")
+	policy.AllowAttrs("aria-label").Matching(bluemonday.Paragraph).OnElements("svg")
+	policy.AllowAttrs("width", "height").Matching(svgNumber).OnElements("svg", "rect")
+	policy.AllowAttrs("x", "y").Matching(svgNumber).OnElements("rect", "tspan")
+	policy.AllowAttrs("rx").Matching(svgNumber).OnElements("rect")
+	policy.AllowAttrs("cx", "cy", "r").Matching(svgNumber).OnElements("circle")
+	policy.AllowAttrs("points").Matching(regexp.MustCompile(`^-?[0-9.]+,-?[0-9.]+( -?[0-9.]+,-?[0-9.]+)*$`)).OnElements("polygon", "polyline")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^(node node-(rect|round|stadium|circle|diamond|hexagon)|edge edge-(solid|dotted|thick)|`+
+		`(node|edge|actor|message|note|frame)-label|edge-label-text|arrowhead|actor|note|frame|frame-(tab|kind)|message( dashed)?|message-head|(lifeline|frame-divider) dashed)$`)).
+		OnElements("rect", "circle", "polygon", "polyline", "text")
+	policy.AllowAttrs("fill").Matching(regexp.MustCompile(`^(none|currentColor)$`)).OnElements("rect", "circle", "polygon", "polyline", "text")
+	policy.AllowAttrs("stroke").Matching(regexp.MustCompile(`^currentColor$`)).OnElements("rect", "circle", "polygon", "polyline")
+	policy.AllowAttrs("stroke-dasharray").Matching(regexp.MustCompile(`^[0-9]+ [0-9]+$`)).OnElements("polyline")
+	policy.AllowAttrs("text-anchor").Matching(regexp.MustCompile(`^(start|middle|end)$`)).OnElements("text")
+	policy.AllowAttrs("dominant-baseline").Matching(regexp.MustCompile(`^central$`)).OnElements("text")
+	policy.AllowAttrs("font-size").Matching(svgNumber).OnElements("text")
+	// MathML from mathExtension
+	policy.AllowNoAttrs().OnElements("math", "semantics", "annotation", "mrow", "mi", "mn", "mo", "mtext", "mspace",
+		"msub", "msup", "msubsup", "munder", "mover", "munderover", "mfrac", "msqrt", "mroot",
+		"mtable", "mtr", "mtd", "merror")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^math-display$`)).OnElements("div")
+	policy.AllowAttrs("display").Matching(regexp.MustCompile(`^(block|inline)$`)).OnElements("math")
+	policy.AllowAttrs("encoding").Matching(regexp.MustCompile(`^application/x-tex$`)).OnElements("annotation")
+	policy.AllowAttrs("mathvariant").Matching(regexp.MustCompile(`^normal$`)).OnElements("mi")
+	policy.AllowAttrs("fence", "stretchy").Matching(regexp.MustCompile(`^(true|false)$`)).OnElements("mo")
+	policy.AllowAttrs("minsize", "maxsize").Matching(regexp.MustCompile(`^[0-9.]+em$`)).OnElements("mo")
+	policy.AllowAttrs("accent").Matching(regexp.MustCompile(`^true$`)).OnElements("mover")
+	policy.AllowAttrs("accentunder").Matching(regexp.MustCompile(`^true$`)).OnElements("munder")
+	policy.AllowAttrs("linethickness").Matching(regexp.MustCompile(`^0$`)).OnElements("mfrac")
+	policy.AllowAttrs("columnalign").Matching(regexp.MustCompile(`^(left|right|center)( (left|right|center))*$`)).OnElements("mtable")
+	policy.AllowAttrs("width").Matching(regexp.MustCompile(`^[0-9.]+em$`)).OnElements("mspace")
+	// Shortcodes from shortcodeExtension
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed embed-(figure|video|audio|youtube)$`)).OnElements("figure")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed-frame$`)).OnElements("div")
+	policy.AllowAttrs("loading").Matching(regexp.MustCompile(`^lazy$`)).OnElements("img", "iframe")
+	policy.AllowAttrs("preload").Matching(regexp.MustCompile(`^metadata$`)).OnElements("video", "audio")
+	policy.AllowAttrs("src").Matching(regexp.MustCompile(`^https://www\.youtube-nocookie\.com/embed/[A-Za-z0-9_-]{11}(\?start=[0-9]+)?$`)).OnElements("iframe")
+	policy.AllowAttrs("title").Matching(bluemonday.Paragraph).OnElements("iframe")
+	policy.AllowAttrs("allow").Matching(regexp.MustCompile(`^encrypted-media; picture-in-picture; fullscreen$`)).OnElements("iframe")
+	policy.AllowAttrs("sandbox").Matching(regexp.MustCompile(`^allow-scripts allow-same-origin allow-presentation allow-popups$`)).OnElements("iframe")
+	policy.AllowAttrs("allowfullscreen").OnElements("iframe")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed-card embed-(gist|github)$`)).OnElements("a")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed-card-(kind|title|text|url)$`)).OnElements("span")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^callout callout-(note|tip|important|warning|caution)$`)).OnElements("aside")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^callout-title$`)).OnElements("p")
 
 	return &PostService{repo: repo, mdParser: md, sanitizer: policy}
 }
 
-func (s *PostService) GetBySlug(slug string) (*model.Post, error) {
-	post, err := s.repo.GetBySlug(slug)
+// OnChange registers fn to be called after a post is created, updated,
+// published, unpublished or deleted, with the post as it was before (nil if
+// new) and after (nil if deleted). Register hooks before serving requests.
+func (s *PostService) OnChange(fn func(before, after *model.Post)) {
+	s.onChange = append(s.onChange, fn)
+}
+
+func (s *PostService) notify(before, after *model.Post) {
+	for _, fn := range s.onChange {
+		fn(before, after)
+	}
+}
+
+func (s *PostService) GetBySlug(ctx context.Context, slug string) (*model.Post, error) {
+	post, err := s.repo.GetBySlug(ctx, slug)
 	if errors.Is(err, repository.ErrNotFound) {
 		return nil, ErrNotFound
 	}
 	return post, err
 }
 
-func (s *PostService) GetByID(id int64) (*model.Post, error) {
-	post, err := s.repo.GetByID(id)
+func (s *PostService) GetByID(ctx context.Context, id int64) (*model.Post, error) {
+	post, err := s.repo.GetByID(ctx, id)
 	if errors.Is(err, repository.ErrNotFound) {
 		return nil, ErrNotFound
 	}
 	return post, err
 }
 
-func (s *PostService) ListPublished() ([]*model.Post, error) {
-	return s.repo.ListPublished()
-}
-
-func (s *PostService) ListAll() ([]*model.Post, error) {
-	return s.repo.ListAll()
+func (s *PostService) ListPublished(ctx context.Context) ([]*model.Post, error) {
+	return s.repo.ListPublished(ctx)
 }
 
-func (s *PostService) ListPublishedByCategory(category string) ([]*model.Post, error) {
-	return s.repo.ListPublishedByCategory(category)
+func (s *PostService) ListAll(ctx context.Context) ([]*model.Post, error) {
+	return s.repo.ListAll(ctx)
 }
 
-func (s *PostService) ListCategories() ([]string, error) {
-	return s.repo.ListCategories()
+func (s *PostService) ListCategories(ctx context.Context) ([]string, error) {
+	return s.repo.ListCategories(ctx)
 }
 
-func (s *PostService) Create(input PostInput) (*model.Post, error) {
-	slug, err := s.generateSlug(input.Title, 0)
+func (s *PostService) Create(ctx context.Context, input PostInput) (*model.Post, error) {
+	slug, err := s.generateSlug(ctx, input.Title, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	html := s.renderMarkdown(input.ContentMD)
-
 	post := &model.Post{
-		Title:       input.Title,
-		Slug:        slug,
-		Excerpt:     input.Excerpt,
-		ContentMD:   input.ContentMD,
-		ContentHTML: html,
-		CoverImage:  input.CoverImage,
-		Category:    input.Category,
-		Tags:        input.Tags,
-		Status:      "draft",
+		Title:      input.Title,
+		Slug:       slug,
+		Excerpt:    input.Excerpt,
+		ContentMD:  input.ContentMD,
+		CoverImage: input.CoverImage,
+		Category:   input.Category,
+		Tags:       input.Tags,
+		HideTOC:    input.HideTOC,
+		Status:     "draft",
 	}
+	s.render(post)
 
-	return s.repo.Create(post)
+	created, err := s.repo.Create(ctx, post)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, apperr.Wrap(err, ErrSlugConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.notify(nil, created)
+	return created, nil
 }
 
-func (s *PostService) Update(id int64, input PostInput) (*model.Post, error) {
-	existing, err := s.repo.GetByID(id)
+func (s *PostService) Update(ctx context.Context, id int64, input PostInput) (*model.Post, error) {
+	existing, err := s.repo.GetByID(ctx, id)
 	if errors.Is(err, repository.ErrNotFound) {
 		return nil, ErrNotFound
 	}
@@ -129,73 +210,132 @@ func (s *PostService) Update(id int64, input PostInput) (*model.Post, error) {
 	// Re-generate slug only if title changed
 	slug := existing.Slug
 	if !strings.EqualFold(existing.Title, input.Title) {
-		slug, err = s.generateSlugExcluding(input.Title, existing.Slug)
+		slug, err = s.generateSlugExcluding(ctx, input.Title, existing.Slug)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	html := s.renderMarkdown(input.ContentMD)
-
+	before := *existing
 	existing.Title = input.Title
 	existing.Slug = slug
 	existing.Excerpt = input.Excerpt
 	existing.ContentMD = input.ContentMD
-	existing.ContentHTML = html
 	existing.CoverImage = input.CoverImage
 	existing.Category = input.Category
 	existing.Tags = input.Tags
+	existing.HideTOC = input.HideTOC
+	s.render(existing)
 
-	return s.repo.Update(existing)
+	updated, err := s.repo.Update(ctx, existing)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, apperr.Wrap(err, ErrSlugConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.notify(&before, updated)
+	return updated, nil
 }
 
-func (s *PostService) Publish(id int64) error {
-	post, err := s.repo.GetByID(id)
+func (s *PostService) Publish(ctx context.Context, id int64) error {
+	post, err := s.repo.GetByID(ctx, id)
 	if errors.Is(err, repository.ErrNotFound) {
 		return ErrNotFound
 	}
 	if err != nil {
 		return err
 	}
+	before := *post
 	now := time.Now()
 	post.Status = "published"
 	if post.PublishedAt == nil {
 		post.PublishedAt = &now
 	}
-	_, err = s.repo.Update(post)
-	return err
+	return s.update(ctx, &before, post)
 }
 
-func (s *PostService) Unpublish(id int64) error {
-	post, err := s.repo.GetByID(id)
+func (s *PostService) Unpublish(ctx context.Context, id int64) error {
+	post, err := s.repo.GetByID(ctx, id)
 	if errors.Is(err, repository.ErrNotFound) {
 		return ErrNotFound
 	}
 	if err != nil {
 		return err
 	}
+	before := *post
 	post.Status = "draft"
-	_, err = s.repo.Update(post)
-	return err
+	return s.update(ctx, &before, post)
 }
 
-func (s *PostService) Delete(id int64) error {
-	_, err := s.repo.GetByID(id)
+// update saves a status change and reports it.
+func (s *PostService) update(ctx context.Context, before, post *model.Post) error {
+	updated, err := s.repo.Update(ctx, post)
+	if err != nil {
+		return err
+	}
+	s.notify(before, updated)
+	return nil
+}
+
+func (s *PostService) Delete(ctx context.Context, id int64) error {
+	post, err := s.repo.GetByID(ctx, id)
 	if errors.Is(err, repository.ErrNotFound) {
 		return ErrNotFound
 	}
 	if err != nil {
 		return err
 	}
-	return s.repo.Delete(id)
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.notify(post, nil)
+	return nil
+}
+
+// renderVersion is the version of the Markdown pipeline. Bump it whenever
+// renderMarkdown's output changes, so RenderStale renders saved posts again.
+const renderVersion = 7
+
+// render fills in what p's ContentMD renders to: its HTML, table of contents,
+// word count and reading time.
+func (s *PostService) render(p *model.Post) {
+	p.ContentHTML, p.TOC = s.renderMarkdown(p.ContentMD)
+	p.RenderVersion = renderVersion
+	s.setReadingTime(p)
 }
 
-func (s *PostService) renderMarkdown(md string) string {
+// renderMarkdown returns the sanitised HTML of md, with an anchor link on
+// each heading, and its table of contents.
+func (s *PostService) renderMarkdown(md string) (string, model.TOC) {
+	src := []byte(md)
+	doc := s.mdParser.Parser().Parse(text.NewReader(src))
+	toc := anchorHeadings(doc, src)
 	var buf strings.Builder
-	if err := s.mdParser.Convert([]byte(md), &buf); err != nil {
-		return ""
+	if err := s.mdParser.Renderer().Render(&buf, src, doc); err != nil {
+		return "", nil
+	}
+	return s.sanitizer.Sanitize(buf.String()), toc
+}
+
+// RenderStale renders the posts saved by an older version of the Markdown
+// pipeline again, and returns how many it rendered. Run at startup, before
+// pages are served or built.
+func (s *PostService) RenderStale(ctx context.Context) (int, error) {
+	posts, err := s.repo.ListStale(ctx, renderVersion)
+	if err != nil {
+		return 0, err
+	}
+	for i, p := range posts {
+		s.render(p)
+		if err := s.repo.SetRendered(ctx, p); err != nil {
+			return i, err
+		}
+	}
+	if len(posts) > 0 {
+		slog.InfoContext(ctx, "posts: rendered again", "posts", len(posts), "version", renderVersion)
 	}
-	return s.sanitizer.Sanitize(buf.String())
+	return len(posts), nil
 }
 
 var nonAlphanumRe = regexp.MustCompile(`[^a-z0-9]+`)
@@ -219,27 +359,27 @@ func slugify(title string) string {
 	return slug
 }
 
-func (s *PostService) generateSlug(title string, attempt int) (string, error) {
+func (s *PostService) generateSlug(ctx context.Context, title string, attempt int) (string, error) {
 	base := slugify(title)
 	slug := base
 	if attempt > 0 {
 		slug = fmt.Sprintf("%s-%d", base, attempt+1)
 	}
-	exists, err := s.repo.SlugExists(slug)
+	exists, err := s.repo.SlugExists(ctx, slug)
 	if err != nil {
 		return "", err
 	}
 	if !exists {
 		return slug, nil
 	}
-	return s.generateSlug(title, attempt+1)
+	return s.generateSlug(ctx, title, attempt+1)
 }
 
 // generateSlugExcluding generates a slug excluding the currentSlug from collision check.
-func (s *PostService) generateSlugExcluding(title, currentSlug string) (string, error) {
+func (s *PostService) generateSlugExcluding(ctx context.Context, title, currentSlug string) (string, error) {
 	candidate := slugify(title)
 	if candidate == currentSlug {
 		return currentSlug, nil
 	}
-	return s.generateSlug(title, 0)
+	return s.generateSlug(ctx, title, 0)
 }
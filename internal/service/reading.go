@@ -0,0 +1,68 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// wordsPerMinute is the reading speed reading times assume. Study notes with
+// code read slower than the 230 or so words a minute usual for prose.
+const wordsPerMinute = 200
+
+// setReadingTime fills in p's word count and reading time from ContentMD.
+func (s *PostService) setReadingTime(p *model.Post) {
+	p.WordCount = countWords(s.plainText(p.ContentMD))
+	p.ReadingMinutes = (p.WordCount + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// plainText returns what a reader reads of a Markdown document: its text and
+// code, without markup, link targets, image descriptions or raw HTML.
+func (s *PostService) plainText(md string) string {
+	src := []byte(md)
+	doc := s.mdParser.Parser().Parse(text.NewReader(src))
+	var b strings.Builder
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if n.Type() == ast.TypeBlock {
+			b.WriteByte('\n')
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(src))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				seg := lines.At(i)
+				b.Write(seg.Value(src))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Image, *ast.RawHTML, *ast.HTMLBlock, *ast.AutoLink:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// countWords counts the whitespace-separated words of s that hold a letter
+// or digit, so list markers, dashes and table rules don't count.
+func countWords(s string) int {
+	n := 0
+	for _, f := range strings.Fields(s) {
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			n++
+		}
+	}
+	return n
+}
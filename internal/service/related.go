@@ -0,0 +1,254 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+// Weights of what a related post is ranked by. Tags are picked by the
+// author, so each shared tag counts most; term similarity is the cosine of
+// the posts' TF-IDF vectors, between 0 and 1.
+const (
+	relatedTagWeight      = 3.0
+	relatedCategoryWeight = 2.0
+	relatedTermWeight     = 4.0
+
+	// relatedMinScore keeps posts that only share a few ordinary words out.
+	relatedMinScore = 0.4
+)
+
+// RelatedService ranks the published posts related to a post. It builds a
+// term index of all published posts on first use and keeps it, along with
+// each post's results, until a published post changes.
+type RelatedService struct {
+	posts *PostService
+
+	mu    sync.Mutex
+	index *relatedIndex // nil until built and after a change
+	gen   uint64        // bumped by every change
+}
+
+type relatedIndex struct {
+	posts   []*model.Post
+	vectors map[int64]termVector // by post ID
+	idf     map[string]float64
+	results map[int64][]*model.Post // by post ID, guarded by RelatedService.mu
+}
+
+// termVector maps terms to their TF-IDF weight, normalised to unit length.
+type termVector map[string]float64
+
+// NewRelatedService returns a service ranking posts of posts. It registers
+// for post changes, so create it before any OnChange hook that renders
+// pages, or they may render with the old results.
+func NewRelatedService(posts *PostService) *RelatedService {
+	r := &RelatedService{posts: posts}
+	posts.OnChange(r.postChanged)
+	return r
+}
+
+// postChanged drops the index when a published post changes: the post may
+// now rank differently for every other post, and term weights depend on all
+// posts.
+func (r *RelatedService) postChanged(before, after *model.Post) {
+	if (before == nil || !before.IsPublished()) && (after == nil || !after.IsPublished()) {
+		return
+	}
+	r.mu.Lock()
+	r.index = nil
+	r.gen++
+	r.mu.Unlock()
+}
+
+// For returns up to n published posts related to p, most related first.
+// Posts that rank the same are ordered newest first.
+func (r *RelatedService) For(ctx context.Context, p *model.Post, n int) ([]*model.Post, error) {
+	idx, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	res, ok := idx.results[p.ID]
+	r.mu.Unlock()
+	if !ok {
+		res = idx.rank(r.posts, p)
+		r.mu.Lock()
+		idx.results[p.ID] = res
+		r.mu.Unlock()
+	}
+	return res[:min(n, len(res))], nil
+}
+
+// load returns the index, building it if needed. An index built while a
+// post changed isn't kept, since it may have read the posts from before.
+func (r *RelatedService) load(ctx context.Context) (*relatedIndex, error) {
+	r.mu.Lock()
+	idx, gen := r.index, r.gen
+	r.mu.Unlock()
+	if idx != nil {
+		return idx, nil
+	}
+
+	posts, err := r.posts.ListPublished(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx = &relatedIndex{
+		posts:   posts,
+		vectors: make(map[int64]termVector, len(posts)),
+		idf:     make(map[string]float64),
+		results: make(map[int64][]*model.Post),
+	}
+	counts := make(map[int64]map[string]int, len(posts))
+	for _, p := range posts {
+		tf := r.posts.termCounts(p)
+		counts[p.ID] = tf
+		for term := range tf {
+			idx.idf[term]++
+		}
+	}
+	// Terms in every post weigh nothing.
+	for term, df := range idx.idf {
+		idx.idf[term] = math.Log(float64(len(posts)) / df)
+	}
+	for _, p := range posts {
+		idx.vectors[p.ID] = idx.vector(counts[p.ID])
+	}
+
+	r.mu.Lock()
+	if r.gen == gen {
+		r.index = idx
+	}
+	r.mu.Unlock()
+	return idx, nil
+}
+
+// rank scores every other post of the index against p.
+func (idx *relatedIndex) rank(posts *PostService, p *model.Post) []*model.Post {
+	vec, ok := idx.vectors[p.ID]
+	if !ok { // not published, as in a preview
+		vec = idx.vector(posts.termCounts(p))
+	}
+	tags := make(map[string]bool)
+	for _, t := range p.TagList() {
+		tags[strings.ToLower(t)] = true
+	}
+
+	type scored struct {
+		post  *model.Post
+		score float64
+	}
+	var candidates []scored
+	for _, other := range idx.posts {
+		if other.ID == p.ID {
+			continue
+		}
+		score := relatedTermWeight * vec.dot(idx.vectors[other.ID])
+		for _, t := range other.TagList() {
+			if tags[strings.ToLower(t)] {
+				score += relatedTagWeight
+			}
+		}
+		if p.Category != "" && strings.EqualFold(p.Category, other.Category) {
+			score += relatedCategoryWeight
+		}
+		if score >= relatedMinScore {
+			candidates = append(candidates, scored{other, score})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b scored) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		if c := publishedAt(b.post).Compare(publishedAt(a.post)); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.post.ID, a.post.ID)
+	})
+	res := make([]*model.Post, len(candidates))
+	for i, c := range candidates {
+		res[i] = c.post
+	}
+	return res
+}
+
+func (idx *relatedIndex) vector(tf map[string]int) termVector {
+	v := make(termVector, len(tf))
+	var norm float64
+	for term, n := range tf {
+		w := float64(n) * idx.idf[term]
+		if w > 0 {
+			v[term] = w
+			norm += w * w
+		}
+	}
+	norm = math.Sqrt(norm)
+	for term := range v {
+		v[term] /= norm
+	}
+	return v
+}
+
+func (v termVector) dot(o termVector) float64 {
+	if len(o) < len(v) {
+		v, o = o, v
+	}
+	var sum float64
+	for term, w := range v {
+		sum += w * o[term]
+	}
+	return sum
+}
+
+// termCounts counts the terms of a post's title, excerpt and text. The
+// title counts twice, as it says best what the post is about.
+func (s *PostService) termCounts(p *model.Post) map[string]int {
+	tf := make(map[string]int)
+	add := func(text string, weight int) {
+		for _, f := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if utf8.RuneCountInString(f) >= 3 && !stopWords[f] && strings.IndexFunc(f, unicode.IsLetter) >= 0 {
+				tf[f] += weight
+			}
+		}
+	}
+	add(p.Title, 2)
+	add(p.Excerpt, 1)
+	add(s.plainText(p.ContentMD), 1)
+	return tf
+}
+
+// stopWords are common English words of three letters or more that say
+// nothing about a post's subject.
+var stopWords = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(`
+		about above after again against all also and any are because been before
+		being below between both but can could did does doing down during each
+		few for from further had has have having her here hers herself him
+		himself his how into its itself just more most not now off once only
+		other our ours out over own same she should some such than that the
+		their theirs them then there these they this those through too under
+		until use used using very was way were what when where which while who
+		whom why will with would you your yours yourself`) {
+		m[w] = true
+	}
+	return m
+}()
+
+func publishedAt(p *model.Post) time.Time {
+	if p.PublishedAt != nil {
+		return *p.PublishedAt
+	}
+	return p.CreatedAt
+}
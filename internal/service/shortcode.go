@@ -0,0 +1,257 @@
+package service
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// shortcodeExtension renders Hugo-style shortcodes, each on a line of its
+// own, so authors can embed media and boxes without raw HTML:
+//
+//	{{< figure src="/static/uploads/chart.png" alt="Loss curve" caption="Training loss" >}}
+//	{{< video src="/static/uploads/demo.mp4" caption="The demo" >}}
+//	{{< audio src="/static/uploads/talk.mp3" >}}
+//	{{< youtube dQw4w9WgXcQ start=42 >}}
+//	{{< gist octocat/6cad326836d38bd3a7ae >}}
+//	{{< github golang/go description="The Go programming language" >}}
+//	{{< callout warning title="Heads up" >}}
+//	Markdown, **as usual**.
+//	{{< /callout >}}
+//
+// The first arguments may be given without their names, in the order of
+// shortcodeDef.positional. A shortcode that's unknown, misses an argument or
+// fails its check is left as text, so the author sees it in the preview.
+type shortcodeExtension struct{}
+
+func (shortcodeExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(shortcodeParser{}, 750)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(shortcodeRenderer{}, 500)))
+}
+
+type shortcodeDef struct {
+	positional []string                     // names of the arguments that may go unnamed, in order
+	check      func(map[string]string) bool // reports whether the arguments are usable
+	paired     bool                         // holds Markdown up to a closing {{< /name >}}
+}
+
+var (
+	youtubeIDRe   = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	gistIDRe      = regexp.MustCompile(`^[A-Za-z0-9-]+/[0-9a-f]+$`)
+	githubRepoRe  = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$`)
+	digitsRe      = regexp.MustCompile(`^[0-9]+$`)
+	calloutTypeRe = regexp.MustCompile(`^(note|tip|important|warning|caution)$`)
+)
+
+// localMedia reports whether the src argument is a path on this site, as
+// media from elsewhere is blocked by the strict CSP.
+func localMedia(args map[string]string) bool {
+	src := args["src"]
+	return strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//")
+}
+
+var shortcodes = map[string]shortcodeDef{
+	"figure": {positional: []string{"src"}, check: localMedia},
+	"video":  {positional: []string{"src"}, check: localMedia},
+	"audio":  {positional: []string{"src"}, check: localMedia},
+	"youtube": {positional: []string{"id"}, check: func(args map[string]string) bool {
+		start, ok := args["start"]
+		return youtubeIDRe.MatchString(args["id"]) && (!ok || digitsRe.MatchString(start))
+	}},
+	"gist": {positional: []string{"id"}, check: func(args map[string]string) bool {
+		return gistIDRe.MatchString(args["id"])
+	}},
+	"github": {positional: []string{"repo"}, check: func(args map[string]string) bool {
+		return githubRepoRe.MatchString(args["repo"])
+	}},
+	"callout": {positional: []string{"type"}, paired: true, check: func(args map[string]string) bool {
+		if _, ok := args["type"]; !ok {
+			args["type"] = "note"
+		}
+		return calloutTypeRe.MatchString(args["type"])
+	}},
+}
+
+var (
+	shortcodeRe    = regexp.MustCompile(`^\{\{<\s*(/?)(\w+)(.*?)\s*>\}\}\s*$`)
+	shortcodeArgRe = regexp.MustCompile(`^(?:(\w+)=)?("[^"]*"|[^\s"]+)\s*`)
+)
+
+// parseShortcode parses a line holding a shortcode, returning its name and
+// arguments, and whether it's a closing one.
+func parseShortcode(line []byte) (name string, args map[string]string, closing, ok bool) {
+	m := shortcodeRe.FindSubmatch(util.TrimLeftSpace(line))
+	if m == nil {
+		return "", nil, false, false
+	}
+	name, closing = string(m[2]), len(m[1]) > 0
+	def, known := shortcodes[name]
+	if !known {
+		return "", nil, false, false
+	}
+	if closing {
+		return name, nil, true, len(strings.TrimSpace(string(m[3]))) == 0
+	}
+	args = map[string]string{}
+	rest := strings.TrimSpace(string(m[3]))
+	for n := 0; rest != ""; {
+		a := shortcodeArgRe.FindStringSubmatch(rest)
+		if a == nil {
+			return "", nil, false, false
+		}
+		rest = rest[len(a[0]):]
+		key, value := a[1], strings.Trim(a[2], `"`)
+		if key == "" {
+			if n >= len(def.positional) {
+				return "", nil, false, false
+			}
+			key = def.positional[n]
+			n++
+		}
+		args[key] = value
+	}
+	return name, args, false, def.check(args)
+}
+
+var kindShortcode = ast.NewNodeKind("Shortcode")
+
+// shortcodeNode is a shortcode; a paired one has the blocks up to its
+// closing shortcode as children.
+type shortcodeNode struct {
+	ast.BaseBlock
+	name  string
+	args  map[string]string
+	depth int // same-named shortcodes open inside a paired one
+}
+
+func (n *shortcodeNode) Kind() ast.NodeKind { return kindShortcode }
+
+func (n *shortcodeNode) Dump(src []byte, level int) {
+	ast.DumpHelper(n, src, level, n.args, nil)
+}
+
+type shortcodeParser struct{}
+
+func (shortcodeParser) Trigger() []byte { return []byte{'{'} }
+
+func (shortcodeParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	name, args, closing, ok := parseShortcode(line)
+	if !ok || closing {
+		return nil, parser.NoChildren
+	}
+	reader.Advance(segment.Len() - 1)
+	n := &shortcodeNode{name: name, args: args}
+	if shortcodes[name].paired {
+		return n, parser.HasChildren
+	}
+	return n, parser.NoChildren
+}
+
+func (shortcodeParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*shortcodeNode)
+	if !shortcodes[n.name].paired {
+		return parser.Close
+	}
+	// A nested shortcode of the same name is opened and closed by its own
+	// node, so only the closing line matching this one ends it.
+	line, segment := reader.PeekLine()
+	if name, _, closing, ok := parseShortcode(line); ok && name == n.name {
+		switch {
+		case !closing:
+			n.depth++
+		case n.depth > 0:
+			n.depth--
+		default:
+			reader.Advance(segment.Len() - 1)
+			return parser.Close
+		}
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (shortcodeParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (shortcodeParser) CanInterruptParagraph() bool { return true }
+
+func (shortcodeParser) CanAcceptIndentedLine() bool { return false }
+
+type shortcodeRenderer struct{}
+
+func (shortcodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindShortcode, renderShortcode)
+}
+
+func renderShortcode(w util.BufWriter, src []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*shortcodeNode)
+	attr := func(key string) string { return html.EscapeString(n.args[key]) }
+	if n.name == "callout" {
+		if entering {
+			title := n.args["title"]
+			if title == "" {
+				title = strings.ToUpper(n.args["type"][:1]) + n.args["type"][1:]
+			}
+			w.WriteString(`<aside class="callout callout-` + attr("type") + `">` + "\n")
+			w.WriteString(`<p class="callout-title">` + html.EscapeString(title) + "</p>\n")
+		} else {
+			w.WriteString("</aside>\n")
+		}
+		return ast.WalkContinue, nil
+	}
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	switch n.name {
+	case "figure":
+		w.WriteString(`<figure class="embed embed-figure"><img src="` + attr("src") + `" alt="` + attr("alt") + `" loading="lazy">`)
+	case "video", "audio":
+		w.WriteString(`<figure class="embed embed-` + n.name + `"><` + n.name + ` controls preload="metadata" src="` + attr("src") + `"></` + n.name + `>`)
+	case "youtube":
+		url := "https://www.youtube-nocookie.com/embed/" + n.args["id"]
+		if start := n.args["start"]; start != "" {
+			url += "?start=" + start
+		}
+		title := n.args["title"]
+		if title == "" {
+			title = "YouTube video"
+		}
+		w.WriteString(`<figure class="embed embed-youtube"><div class="embed-frame"><iframe src="` + url +
+			`" title="` + html.EscapeString(title) + `" loading="lazy" allow="encrypted-media; picture-in-picture; fullscreen"` +
+			` allowfullscreen sandbox="allow-scripts allow-same-origin allow-presentation allow-popups"></iframe></div>`)
+	case "gist":
+		writeEmbedCard(w, "gist", "Gist", "gist.github.com/"+n.args["id"], n.args["id"], n.args)
+		return ast.WalkSkipChildren, nil
+	case "github":
+		writeEmbedCard(w, "github", "GitHub", "github.com/"+n.args["repo"], n.args["repo"], n.args)
+		return ast.WalkSkipChildren, nil
+	}
+	if caption := n.args["caption"]; caption != "" {
+		w.WriteString("<figcaption>" + html.EscapeString(caption) + "</figcaption>")
+	}
+	w.WriteString("</figure>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// writeEmbedCard writes a static link card for a page on GitHub: nothing is
+// fetched, from the server or the reader's browser.
+func writeEmbedCard(w util.BufWriter, class, kind, url, defaultTitle string, args map[string]string) {
+	title := args["title"]
+	if title == "" {
+		title = defaultTitle
+	}
+	w.WriteString(`<a class="embed-card embed-` + class + `" href="https://` + html.EscapeString(url) + `">`)
+	w.WriteString(`<span class="embed-card-kind">` + kind + `</span>`)
+	w.WriteString(`<span class="embed-card-title">` + html.EscapeString(title) + `</span>`)
+	if desc := args["description"]; desc != "" {
+		w.WriteString(`<span class="embed-card-text">` + html.EscapeString(desc) + `</span>`)
+	}
+	w.WriteString(`<span class="embed-card-url">` + html.EscapeString(url) + "</span></a>\n")
+}
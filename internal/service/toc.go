@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/yuin/goldmark/ast"
+)
+
+// tocMaxLevel is the deepest heading level a table of contents lists.
+const tocMaxLevel = 4
+
+// anchorHeadings adds a link to itself to each heading of doc and returns
+// the headings as a table of contents. Heading IDs come from the parser.
+func anchorHeadings(doc ast.Node, src []byte) model.TOC {
+	var flat []model.TOCEntry
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		v, ok := h.AttributeString("id")
+		id, _ := v.([]byte)
+		if !ok || len(id) == 0 {
+			return ast.WalkSkipChildren, nil
+		}
+		if h.Level <= tocMaxLevel {
+			flat = append(flat, model.TOCEntry{ID: string(id), Text: headingText(h, src), Level: h.Level})
+		}
+		link := ast.NewLink()
+		link.Destination = append([]byte("#"), id...)
+		link.SetAttributeString("class", []byte("heading-anchor"))
+		link.AppendChild(link, ast.NewString([]byte("#")))
+		h.AppendChild(h, link)
+		return ast.WalkSkipChildren, nil
+	})
+	return nestHeadings(flat)
+}
+
+// headingText returns the text of a heading without its markup.
+func headingText(h *ast.Heading, src []byte) string {
+	var b strings.Builder
+	ast.Walk(h, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(src))
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.RawHTML, *ast.Image:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// nestHeadings arranges headings in document order into a tree, each
+// holding the deeper headings that follow it.
+func nestHeadings(flat []model.TOCEntry) model.TOC {
+	var toc model.TOC
+	for i := 0; i < len(flat); {
+		e := flat[i]
+		j := i + 1
+		for j < len(flat) && flat[j].Level > e.Level {
+			j++
+		}
+		e.Children = nestHeadings(flat[i+1 : j])
+		toc = append(toc, e)
+		i = j
+	}
+	return toc
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+// maxUTMLength caps stored UTM values so crafted links can't bloat page_views.
+const maxUTMLength = 100
+
+// knownSources maps a domain label (or utm_source value) to its channel.
+// Domains are matched label by label, so "google" covers google.com and
+// google.com.br alike.
+var knownSources = map[string]string{
+	"google":     model.ChannelSearch,
+	"bing":       model.ChannelSearch,
+	"duckduckgo": model.ChannelSearch,
+	"yahoo":      model.ChannelSearch,
+	"yandex":     model.ChannelSearch,
+	"baidu":      model.ChannelSearch,
+	"ecosia":     model.ChannelSearch,
+	"kagi":       model.ChannelSearch,
+	"brave":      model.ChannelSearch,
+	"perplexity": model.ChannelSearch,
+
+	"linkedin":    model.ChannelSocial,
+	"lnkd":        model.ChannelSocial,
+	"twitter":     model.ChannelSocial,
+	"x":           model.ChannelSocial,
+	"t.co":        model.ChannelSocial,
+	"facebook":    model.ChannelSocial,
+	"instagram":   model.ChannelSocial,
+	"reddit":      model.ChannelSocial,
+	"ycombinator": model.ChannelSocial,
+	"bsky":        model.ChannelSocial,
+	"threads":     model.ChannelSocial,
+	"mastodon":    model.ChannelSocial,
+	"youtube":     model.ChannelSocial,
+	"whatsapp":    model.ChannelSocial,
+	"telegram":    model.ChannelSocial,
+
+	"github":        model.ChannelDeveloper,
+	"gitlab":        model.ChannelDeveloper,
+	"stackoverflow": model.ChannelDeveloper,
+	"dev":           model.ChannelDeveloper,
+	"hashnode":      model.ChannelDeveloper,
+	"huggingface":   model.ChannelDeveloper,
+	"kaggle":        model.ChannelDeveloper,
+
+	"gmail":      model.ChannelEmail,
+	"outlook":    model.ChannelEmail,
+	"newsletter": model.ChannelEmail,
+	"substack":   model.ChannelEmail,
+}
+
+// NewTrafficSource normalizes the Referer header and UTM parameters of a
+// request into a TrafficSource. selfHost is the blog's own host name; links
+// between its pages are classified as internal.
+func NewTrafficSource(referer, selfHost, utmSource, utmMedium, utmCampaign string) model.TrafficSource {
+	src := model.TrafficSource{
+		ReferrerDomain: referrerDomain(referer),
+		UTMSource:      normalizeUTM(utmSource),
+		UTMMedium:      normalizeUTM(utmMedium),
+		UTMCampaign:    normalizeUTM(utmCampaign),
+	}
+	if host, _, err := net.SplitHostPort(selfHost); err == nil {
+		selfHost = host
+	}
+	if src.ReferrerDomain != "" && src.ReferrerDomain == stripWWW(strings.ToLower(selfHost)) {
+		src.ReferrerDomain = ""
+		src.Channel = model.ChannelInternal
+		return src
+	}
+	src.Channel = classifyChannel(src)
+	return src
+}
+
+func classifyChannel(src model.TrafficSource) string {
+	switch src.UTMMedium {
+	case "cpc", "ppc", "paid", "paidsearch", "paid-social", "display", "ads":
+		return model.ChannelPaid
+	case "email", "newsletter":
+		return model.ChannelEmail
+	}
+	if ch := lookupDomain(src.ReferrerDomain); ch != "" {
+		return ch
+	}
+	if ch, ok := knownSources[src.UTMSource]; ok {
+		return ch
+	}
+	switch {
+	case src.ReferrerDomain != "":
+		return model.ChannelReferral
+	case src.UTMSource != "" || src.UTMCampaign != "":
+		return model.ChannelCampaign
+	}
+	return model.ChannelDirect
+}
+
+func lookupDomain(domain string) string {
+	if domain == "" {
+		return ""
+	}
+	if ch, ok := knownSources[domain]; ok {
+		return ch
+	}
+	labels := strings.Split(domain, ".")
+	// Skip the top-level domain so "dev.to" matches "dev" but "foo.dev" doesn't.
+	for _, label := range labels[:len(labels)-1] {
+		if ch, ok := knownSources[label]; ok {
+			return ch
+		}
+	}
+	return ""
+}
+
+func referrerDomain(referer string) string {
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return stripWWW(strings.ToLower(u.Hostname()))
+}
+
+func stripWWW(host string) string {
+	for _, prefix := range []string{"www.", "m.", "l.", "lm."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	return host
+}
+
+func normalizeUTM(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if r := []rune(v); len(r) > maxUTMLength {
+		v = string(r[:maxUTMLength])
+	}
+	return v
+}
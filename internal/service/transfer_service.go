@@ -0,0 +1,363 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/apperr"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/postio"
+	"github.com/mhtecdev/blog-ai/internal/repository"
+)
+
+var (
+	ErrUnsupportedImport = apperr.New(http.StatusBadRequest, "Unsupported import: upload a .zip of Markdown files, a single .md file, a WordPress export (.xml) or a Ghost export (.json).")
+	ErrInvalidImport     = apperr.New(http.StatusBadRequest, "The import file could not be read. Check that it is a complete export.")
+)
+
+// ImportResult summarises an import.
+type ImportResult struct {
+	Posts   int
+	Media   int
+	Skipped []string // what was left out, and why
+	Renamed []string // slugs and media names changed to avoid collisions, as "old → new"
+}
+
+// TransferService moves the whole site in and out of the blog: posts as
+// Markdown with front matter plus their media, and posts from WordPress and
+// Ghost exports.
+type TransferService struct {
+	posts *PostService
+	media *MediaService
+	cfg   *config.Config
+}
+
+func NewTransferService(posts *PostService, media *MediaService, cfg *config.Config) *TransferService {
+	return &TransferService{posts: posts, media: media, cfg: cfg}
+}
+
+// uploadRefRe finds links to uploaded media in Markdown and cover images.
+var uploadRefRe = regexp.MustCompile(`/static/uploads/([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// Export writes a zip holding every post as posts/<slug>.md and every upload
+// the posts link to under media/. Links keep their /static/uploads/ form, so
+// importing the zip into another install restores them as they were.
+func (s *TransferService) Export(ctx context.Context, w io.Writer) error {
+	posts, err := s.posts.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	media := make(map[string]bool)
+	for _, p := range posts {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: "posts/" + p.Slug + ".md", Method: zip.Deflate, Modified: p.UpdatedAt})
+		if err != nil {
+			return err
+		}
+		if err := postio.WriteMarkdown(f, p); err != nil {
+			return err
+		}
+		for _, m := range uploadRefRe.FindAllStringSubmatch(p.ContentMD+"\n"+p.CoverImage, -1) {
+			media[m[1]] = true
+		}
+	}
+
+	names := make([]string, 0, len(media))
+	for name := range media {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := addMedia(zw, filepath.Join(s.cfg.UploadDir, name), "media/"+name); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addMedia(zw *zip.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // a dead link; nothing to export
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// Media is already compressed; store it as is.
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Import adds the posts of an export to the blog, detecting the format from
+// filename or, failing that, the content: a zip as written by Export (or any
+// zip of front-matter Markdown files and media), a single Markdown file, a
+// WordPress WXR file or a Ghost JSON export.
+//
+// Slugs are kept unless taken, in which case the next free one is used. The
+// Markdown is rendered again here, so imported HTML passes the same
+// sanitizer as posts written in the studio. Media is stored before posts, so
+// no post links to a file that isn't there yet; a file whose name is taken by
+// a different upload is stored under a new name and the posts' links to it
+// are rewritten to match.
+func (s *TransferService) Import(ctx context.Context, filename string, data []byte, uploaderID int64) (*ImportResult, error) {
+	res := &ImportResult{}
+	var posts []*model.Post
+	media := make(map[string][]byte)
+	var skipped int
+	var err error
+
+	switch importFormat(filename, data) {
+	case "zip":
+		posts, err = s.readZip(data, media, res)
+	case "markdown":
+		p, perr := postio.ParseMarkdown(data)
+		if perr != nil {
+			res.Skipped = append(res.Skipped, filename+": "+perr.Error())
+			return res, nil
+		}
+		posts = []*model.Post{p}
+	case "wxr":
+		posts, skipped, err = postio.ParseWXR(bytes.NewReader(data))
+	case "ghost":
+		posts, skipped, err = postio.ParseGhost(bytes.NewReader(data))
+	default:
+		return nil, ErrUnsupportedImport
+	}
+	if err != nil {
+		return nil, apperr.Wrap(err, ErrInvalidImport)
+	}
+	if skipped > 0 {
+		res.Skipped = append(res.Skipped, fmt.Sprintf("%d pages, attachments or trashed items", skipped))
+	}
+
+	names := make([]string, 0, len(media))
+	for name := range media {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	renamed := make(map[string]string)
+	for _, name := range names {
+		stored, created, err := s.media.Import(ctx, name, media[name], uploaderID)
+		if errors.Is(err, ErrUnsupportedMedia) {
+			res.Skipped = append(res.Skipped, "media/"+name+": unsupported file name or type")
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		if created {
+			res.Media++
+		}
+		if stored != name {
+			renamed[name] = stored
+			res.Renamed = append(res.Renamed, "media/"+name+" → media/"+stored)
+		}
+	}
+	if len(renamed) > 0 {
+		relink := func(ref string) string {
+			if to, ok := renamed[strings.TrimPrefix(ref, "/static/uploads/")]; ok {
+				return "/static/uploads/" + to
+			}
+			return ref
+		}
+		for _, p := range posts {
+			p.ContentMD = uploadRefRe.ReplaceAllStringFunc(p.ContentMD, relink)
+			p.CoverImage = uploadRefRe.ReplaceAllStringFunc(p.CoverImage, relink)
+		}
+	}
+
+	// Oldest first, so IDs follow the original order.
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].CreatedAt.Before(posts[j].CreatedAt) })
+	for _, p := range posts {
+		if err := s.importPost(ctx, p, res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func (s *TransferService) importPost(ctx context.Context, p *model.Post, res *ImportResult) error {
+	if p.Title == "" {
+		res.Skipped = append(res.Skipped, "a post without a title")
+		return nil
+	}
+	want := cmp.Or(p.Slug, p.Title)
+	slug, err := s.posts.generateSlug(ctx, want, 0)
+	if err != nil {
+		return err
+	}
+	if p.Slug != "" && slug != slugify(p.Slug) {
+		res.Renamed = append(res.Renamed, slugify(p.Slug)+" → "+slug)
+	}
+
+	p.ID = 0
+	p.Slug = slug
+	s.posts.render(p)
+	if p.Status != "published" {
+		p.Status = "draft"
+	}
+	if p.Status == "published" && p.PublishedAt == nil {
+		t := cmp.Or(p.CreatedAt, time.Now().UTC())
+		p.PublishedAt = &t
+	}
+
+	created, err := s.posts.repo.Create(ctx, p)
+	if errors.Is(err, repository.ErrConflict) {
+		return apperr.Wrap(err, ErrSlugConflict)
+	}
+	if err != nil {
+		return err
+	}
+	s.posts.notify(nil, created)
+	res.Posts++
+	return nil
+}
+
+// zipLinkRe finds Markdown and HTML links that may point at a file in the
+// zip: the target of "](" or of a src or href attribute.
+var zipLinkRe = regexp.MustCompile(`(\]\(\s*<?|(?:src|href)=["'])([^\s)"'>]+)`)
+
+// readZip collects the posts and media of a zip. Markdown files that can't
+// be read are skipped with the reason rather than failing the import.
+//
+// Media is stored flat in the upload dir, so relative links from a post to a
+// file in the zip are rewritten to its /static/uploads/ URL, and two files in
+// different folders with the same name but different content keep only the
+// first, reporting the other as skipped.
+func (s *TransferService) readZip(data []byte, media map[string][]byte, res *ImportResult) ([]*model.Post, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	maxBytes := s.cfg.UploadMaxMB * 1024 * 1024
+	mediaPaths := make(map[string]string) // zip path → stored name
+	var markdown []*zip.File
+	for _, f := range zr.File {
+		base := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(base))
+		isMarkdown := ext == ".md" || ext == ".markdown"
+		if !isMarkdown && mimeForExt(ext) == "" {
+			res.Skipped = append(res.Skipped, f.Name+": not a Markdown or media file")
+			continue
+		}
+		if f.UncompressedSize64 > uint64(maxBytes) {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("%s: larger than %d MB", f.Name, s.cfg.UploadMaxMB))
+			continue
+		}
+		if isMarkdown {
+			markdown = append(markdown, f)
+			continue
+		}
+		b, err := readZipFile(f, maxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if prev, ok := media[base]; ok && !bytes.Equal(prev, b) {
+			res.Skipped = append(res.Skipped, f.Name+": another file in the zip has the same name")
+			continue
+		}
+		media[base] = b
+		mediaPaths[path.Clean(f.Name)] = base
+	}
+
+	var posts []*model.Post
+	for _, f := range markdown {
+		b, err := readZipFile(f, maxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		p, err := postio.ParseMarkdown(b)
+		if err != nil {
+			res.Skipped = append(res.Skipped, f.Name+": "+err.Error())
+			continue
+		}
+		dir := path.Dir(f.Name)
+		relink := func(link string) string {
+			m := zipLinkRe.FindStringSubmatch(link)
+			target := m[2]
+			if strings.HasPrefix(target, "/") || strings.Contains(target, ":") {
+				return link
+			}
+			if name, ok := mediaPaths[path.Join(dir, target)]; ok {
+				return m[1] + "/static/uploads/" + name
+			}
+			return link
+		}
+		p.ContentMD = zipLinkRe.ReplaceAllStringFunc(p.ContentMD, relink)
+		if name, ok := mediaPaths[path.Join(dir, p.CoverImage)]; ok && p.CoverImage != "" && !strings.HasPrefix(p.CoverImage, "/") {
+			p.CoverImage = "/static/uploads/" + name
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
+
+// readZipFile reads f, refusing more than limit bytes whatever its header
+// claims.
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, errors.New("file is larger than its header says")
+	}
+	return b, nil
+}
+
+// importFormat names the format of an import file.
+func importFormat(filename string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip":
+		return "zip"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".xml":
+		return "wxr"
+	case ".json":
+		return "ghost"
+	}
+	head := bytes.TrimSpace(data[:min(len(data), 512)])
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return "zip"
+	case bytes.HasPrefix(head, []byte("---")):
+		return "markdown"
+	case bytes.HasPrefix(head, []byte("<")):
+		return "wxr"
+	case bytes.HasPrefix(head, []byte("{")):
+		return "ghost"
+	}
+	return ""
+}
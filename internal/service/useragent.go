@@ -0,0 +1,28 @@
+package service
+
+import "strings"
+
+// botMarkers are lower-cased substrings found in the user agents of crawlers,
+// link previewers, monitors and HTTP libraries.
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "scrape", "fetch",
+	"preview", "facebookexternalhit", "embedly", "quora link",
+	"lighthouse", "pingdom", "uptime", "monitor", "headless",
+	"curl/", "wget/", "python-requests", "python-urllib", "go-http-client",
+	"java/", "okhttp", "axios/", "libwww", "httpclient",
+}
+
+// isBot classifies a request as automated from its user agent. Empty user
+// agents are treated as bots because real browsers always send one.
+func isBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+	for _, m := range botMarkers {
+		if strings.Contains(ua, m) {
+			return true
+		}
+	}
+	return false
+}
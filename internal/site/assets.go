@@ -0,0 +1,91 @@
+package site
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copyAssets copies the static directory to root/static and the uploads to
+// root/static/uploads, where the server serves them. It returns the number
+// of files copied.
+func (b *Builder) copyAssets(root string) (int, error) {
+	dst := filepath.Join(root, "static")
+	n, err := copyTree(b.staticDir, dst, "uploads")
+	if err != nil {
+		return n, err
+	}
+	m, err := copyTree(b.cfg.UploadDir, filepath.Join(dst, "uploads"), "")
+	return n + m, err
+}
+
+// copyTree copies the files below src to dst, skipping dotfiles, the
+// top-level directory skip and files dst already has with the same size and
+// modification time.
+func copyTree(src, dst, skip string) (int, error) {
+	copied := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == src && os.IsNotExist(err) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && (strings.HasPrefix(d.Name(), ".") || rel == skip) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if have, err := os.Stat(target); err == nil && have.Size() == info.Size() && have.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+		if err := copyFile(path, target); err != nil {
+			return err
+		}
+		copied++
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+	return copied, err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
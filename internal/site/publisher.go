@@ -0,0 +1,128 @@
+package site
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+	"github.com/mhtecdev/blog-ai/internal/model"
+)
+
+// Publisher keeps a static build in step with the posts. It builds the
+// whole site when it starts, then rebuilds the pages each post change
+// affects in the background, so publishing never waits for the build.
+// Changes that arrive during a build are handled together by the next one.
+type Publisher struct {
+	builder *Builder
+
+	mu      sync.Mutex
+	pending []Change
+	full    bool          // the next run rebuilds everything
+	wake    chan struct{} // signalled when there is work
+
+	lastSuccess atomic.Int64
+	failures    atomic.Int64
+
+	stop     chan struct{}
+	done     chan struct{} // closed when loop returns
+	stopOnce sync.Once
+	ctx      context.Context // cancelled when Close runs out of time
+	cancel   context.CancelFunc
+}
+
+func NewPublisher(b *Builder) *Publisher {
+	p := &Publisher{
+		builder: b,
+		full:    true,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.wake <- struct{}{}
+	go p.loop()
+	return p
+}
+
+// Notify queues a post change. Its signature matches
+// service.PostService.OnChange.
+func (p *Publisher) Notify(before, after *model.Post) {
+	p.mu.Lock()
+	p.pending = append(p.pending, Change{Before: before, After: after})
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default: // a run is already due
+	}
+}
+
+func (p *Publisher) loop() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.wake:
+			p.run()
+		case <-p.stop:
+			p.run() // publish what was queued before shutdown
+			return
+		}
+	}
+}
+
+func (p *Publisher) run() {
+	p.mu.Lock()
+	changes, full := p.pending, p.full
+	p.pending, p.full = nil, false
+	p.mu.Unlock()
+	if !full && len(changes) == 0 {
+		return
+	}
+
+	start := time.Now()
+	var res *Result
+	var err error
+	if full {
+		res, err = p.builder.Build(p.ctx)
+	} else {
+		res, err = p.builder.Update(p.ctx, changes)
+	}
+	if err != nil {
+		p.failures.Add(1)
+		slog.Error("site: build failed", "full", full, "error", err)
+		// Pages may now be stale in ways we can't tell; start over next time.
+		p.mu.Lock()
+		p.full = true
+		p.mu.Unlock()
+		return
+	}
+	p.lastSuccess.Store(time.Now().Unix())
+	if res.Pages > 0 {
+		slog.Info("site: built", "full", full, "pages", res.Pages, "assets", res.Assets,
+			"dir", p.builder.Dir(), "duration", time.Since(start).String())
+	}
+}
+
+// Close publishes the changes already queued and stops, waiting until the
+// build finishes or ctx is done, in which case the build is cancelled.
+func (p *Publisher) Close(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	defer p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RegisterMetrics exposes when the static site was last built and how many
+// builds failed.
+func (p *Publisher) RegisterMetrics(r *metrics.Registry) {
+	r.Register("site_last_build_timestamp_seconds", "Unix time of the last successful static site build.", metrics.Gauge,
+		metrics.Value(func() float64 { return float64(p.lastSuccess.Load()) }))
+	r.Register("site_build_failures_total", "Static site builds that failed.", metrics.Counter,
+		metrics.Value(func() float64 { return float64(p.failures.Load()) }))
+}
@@ -0,0 +1,400 @@
+// Package site renders the public blog into a directory of static files —
+// HTML pages, feeds, the sitemap and assets — that any static host or CDN
+// can serve.
+package site
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	handlerPublic "github.com/mhtecdev/blog-ai/internal/handler/public"
+	"github.com/mhtecdev/blog-ai/internal/middleware"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+)
+
+// marker is written into every build, so a full build only ever replaces a
+// directory that holds a previous one.
+const marker = ".blog-site"
+
+// Result counts what a build wrote.
+type Result struct {
+	Pages  int // HTML pages, feeds and the sitemap
+	Assets int // static files copied because they were new or changed
+}
+
+// Change is a post as it was before and after an edit; see
+// service.PostService.OnChange.
+type Change struct {
+	Before, After *model.Post
+}
+
+// Builder renders the public routes through the same handlers and templates
+// as the server, so the static site matches what the server would answer.
+type Builder struct {
+	app       *fiber.App
+	posts     *service.PostService
+	cfg       *config.Config
+	dir       string // output directory
+	staticDir string // assets served under /static
+
+	mu sync.Mutex // one build at a time
+}
+
+// NewBuilder returns a builder writing to dir. views must be the server's
+// template engine; staticDir is the directory served under /static.
+func NewBuilder(posts *service.PostService, views fiber.Views, cfg *config.Config, staticDir, dir string) *Builder {
+	app := fiber.New(fiber.Config{
+		Views:                 views,
+		DisableStartupMessage: true,
+		ErrorHandler:          middleware.ErrorHandler,
+	})
+
+	// The public routes of the server, without view counting. Static hosts
+	// ignore query strings, so lists aren't split into pages.
+	homeH := handlerPublic.NewHomeHandler(posts, 0)
+	postH := handlerPublic.NewPostHandler(posts, service.NewRelatedService(posts), nil, nil)
+	categoryH := handlerPublic.NewCategoryHandler(posts, 0)
+	timelineH := handlerPublic.NewTimelineHandler(posts, 0)
+	feedH := handlerPublic.NewFeedHandler(posts, cfg)
+	codeH := handlerPublic.NewCodeStyleHandler(cfg)
+
+	app.Get("/", homeH.Handle)
+	app.Get("/posts/:slug", postH.Show)
+	app.Get("/categories", categoryH.List)
+	app.Get("/categories/:slug", categoryH.Show)
+	app.Get("/categories/:slug/feed.xml", feedH.CategoryAtom)
+	app.Get("/timeline", timelineH.Handle)
+	app.Get("/archive/:year", timelineH.Year)
+	app.Get("/archive/:year/:month", timelineH.Month)
+	app.Get("/about", handlerPublic.AboutHandler)
+	app.Get("/feed.xml", feedH.Atom)
+	app.Get("/sitemap.xml", feedH.Sitemap)
+	app.Get("/code.css", codeH.Handle)
+
+	return &Builder{app: app, posts: posts, cfg: cfg, dir: dir, staticDir: staticDir}
+}
+
+// Dir is the directory the site is written to.
+func (b *Builder) Dir() string { return b.dir }
+
+// page is a route and the file it is written to, relative to the output
+// directory. Pages are written as <route>/index.html, which static hosts
+// serve for <route>.
+type page struct {
+	route, file string
+}
+
+var listPages = []page{
+	{"/", "index.html"},
+	{"/categories", "categories/index.html"},
+	{"/timeline", "timeline/index.html"},
+	{"/about", "about/index.html"},
+	{"/feed.xml", "feed.xml"},
+	{"/sitemap.xml", "sitemap.xml"},
+}
+
+// codeStyle is the stylesheet of highlighted code. It only changes with
+// the configuration, so only Build writes it.
+var codeStyle = page{"/code.css", "code.css"}
+
+func postPage(slug string) page {
+	return page{"/posts/" + slug, "posts/" + slug + "/index.html"}
+}
+
+func categoryPages(category string) []page {
+	route := "/categories/" + url.PathEscape(category)
+	return []page{
+		{route, "categories/" + category + "/index.html"},
+		{route + "/feed.xml", "categories/" + category + "/feed.xml"},
+	}
+}
+
+// archivePage is the page of an archive route, such as /archive/2024/03.
+func archivePage(route string) page {
+	return page{route, strings.TrimPrefix(route, "/") + "/index.html"}
+}
+
+// archiveRoutes returns the routes of the archive pages of every year and
+// month in archive.
+func archiveRoutes(archive []model.ArchiveYear) []string {
+	var routes []string
+	for _, y := range archive {
+		routes = append(routes, y.Path())
+		for _, m := range y.Months {
+			routes = append(routes, m.Path())
+		}
+	}
+	return routes
+}
+
+// safeSegment reports whether s can be used as one path segment of the
+// output. Slugs always can; categories are free text.
+func safeSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, "/\\\x00")
+}
+
+// Build renders the whole site into a fresh directory and swaps it in for
+// the previous build, so readers of the directory never see a partial site
+// and pages of deleted posts disappear.
+func (b *Builder) Build(ctx context.Context) (*Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cfg.SiteURL == "" {
+		return nil, errors.New("site: SITE_URL must be set; feeds and the sitemap need absolute links")
+	}
+	if err := checkOutputDir(b.dir); err != nil {
+		return nil, err
+	}
+	parent := filepath.Dir(b.dir)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(b.dir)+"-build-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp) // a no-op once swapped in
+
+	pages := append([]page{codeStyle}, listPages...)
+	categories, err := b.posts.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range categories {
+		if !safeSegment(c) {
+			slog.WarnContext(ctx, "site: skipping category that can't be a path", "category", c)
+			continue
+		}
+		pages = append(pages, categoryPages(c)...)
+	}
+	archive, err := b.posts.Archive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range archiveRoutes(archive) {
+		pages = append(pages, archivePage(route))
+	}
+	posts, err := b.posts.ListPublished(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		pages = append(pages, postPage(p.Slug))
+	}
+
+	res := &Result{}
+	for _, pg := range pages {
+		if err := b.renderTo(ctx, tmp, pg, http.StatusOK); err != nil {
+			return nil, err
+		}
+		res.Pages++
+	}
+	// Static hosts answer unknown paths with 404.html.
+	if err := b.renderTo(ctx, tmp, page{"/404", "404.html"}, http.StatusNotFound); err != nil {
+		return nil, err
+	}
+	if res.Assets, err = b.copyAssets(tmp); err != nil {
+		return nil, err
+	}
+	stamp := []byte(time.Now().UTC().Format(time.RFC3339) + "\n")
+	if err := os.WriteFile(filepath.Join(tmp, marker), stamp, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0o755); err != nil { // MkdirTemp creates it 0700
+		return nil, err
+	}
+
+	old := b.dir + ".old"
+	os.RemoveAll(old)
+	if err := os.Rename(b.dir, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.Rename(tmp, b.dir); err != nil {
+		os.Rename(old, b.dir)
+		return nil, err
+	}
+	return res, os.RemoveAll(old)
+}
+
+// checkOutputDir refuses to replace a directory that isn't empty and wasn't
+// written by Build, such as a mistyped -dir.
+func checkOutputDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, marker)); err != nil {
+		return fmt.Errorf("site: %s is not empty and holds no previous build; refusing to replace it", dir)
+	}
+	return nil
+}
+
+// Update re-renders only the pages the changes affect: the pages of all
+// published posts, as any may list a changed post as related, the pages
+// listing posts (home, timeline, categories, feeds, sitemap), and the
+// categories and archive months the posts were or are in. Pages that come
+// out the same aren't rewritten. Pages of posts, categories and months that
+// are no longer public are removed. Changes that only touch drafts leave
+// the site alone. Without a previous build it runs a full one instead.
+func (b *Builder) Update(ctx context.Context, changes []Change) (*Result, error) {
+	if _, err := os.Stat(filepath.Join(b.dir, marker)); err != nil {
+		return b.Build(ctx)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slugs := make(map[string]bool)
+	touched := make(map[string]bool) // categories
+	periods := make(map[string]bool) // archive routes
+	for _, ch := range changes {
+		for _, p := range []*model.Post{ch.Before, ch.After} {
+			if p != nil && p.IsPublished() {
+				slugs[p.Slug] = true
+				touched[p.Category] = true
+				if p.PublishedAt != nil {
+					t := p.PublishedAt.UTC()
+					periods[model.ArchiveYearPath(t.Year())] = true
+					periods[model.ArchiveMonthPath(t.Year(), t.Month())] = true
+				}
+			}
+		}
+	}
+	res := &Result{}
+	if len(slugs) == 0 {
+		return res, nil
+	}
+
+	// Posts and categories are looked up again, so changes that cancel out
+	// (published, then unpublished) leave the site as the database is now.
+	pages := append([]page(nil), listPages...)
+	var remove []string
+	published, err := b.posts.ListPublished(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range published {
+		pages = append(pages, postPage(p.Slug))
+		delete(slugs, p.Slug)
+	}
+	for slug := range slugs {
+		remove = append(remove, "posts/"+slug)
+	}
+	categories, err := b.posts.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		current[c] = true
+	}
+	for c := range touched {
+		switch {
+		case !safeSegment(c):
+		case current[c]:
+			pages = append(pages, categoryPages(c)...)
+		default:
+			remove = append(remove, "categories/"+c)
+		}
+	}
+	archive, err := b.posts.Archive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]bool)
+	for _, route := range archiveRoutes(archive) {
+		live[route] = true
+	}
+	for route := range periods {
+		if live[route] {
+			pages = append(pages, archivePage(route))
+		} else {
+			remove = append(remove, strings.TrimPrefix(route, "/"))
+		}
+	}
+
+	for _, pg := range pages {
+		if err := b.renderTo(ctx, b.dir, pg, http.StatusOK); err != nil {
+			return nil, err
+		}
+		res.Pages++
+	}
+	for _, rel := range remove {
+		if err := os.RemoveAll(filepath.Join(b.dir, filepath.FromSlash(rel))); err != nil {
+			return nil, err
+		}
+	}
+	// The edit may link media uploaded since the last build.
+	if res.Assets, err = b.copyAssets(b.dir); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// renderTo renders pg and writes it below root, failing unless the handler
+// answers with status.
+func (b *Builder) renderTo(ctx context.Context, root string, pg page, status int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	resp, err := b.app.Test(httptest.NewRequest(http.MethodGet, pg.route, nil), -1)
+	if err != nil {
+		return fmt.Errorf("site: render %s: %w", pg.route, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		return fmt.Errorf("site: render %s: status %d", pg.route, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("site: render %s: %w", pg.route, err)
+	}
+	return writeFile(filepath.Join(root, filepath.FromSlash(pg.file)), body)
+}
+
+// writeFile replaces path with data through a rename, so a static server
+// never sends a half-written page. A file that already holds data is left
+// alone, keeping its modification time for servers and syncs.
+func writeFile(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
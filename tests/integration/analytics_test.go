@@ -0,0 +1,584 @@
+package integration_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/database"
+	"github.com/mhtecdev/blog-ai/internal/logging"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/repository"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+const browserUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+func TestViewsAreDeduplicatedAndBotsIgnored(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Counting Views"})
+
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": "Googlebot/2.1 (+http://www.google.com/bot.html)"})
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": ""})
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": browserUA})
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": browserUA})
+
+	// Views are queued before the response is sent, so closing the service
+	// writes all of them, duplicate included.
+	if err := app.AnalyticsSvc.Close(t.Context()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	m := waitForMetric(t, app, post.ID, 1)
+	if m.ViewCount != 1 {
+		t.Errorf("expected 1 view after dedup and bot filtering, got %d", m.ViewCount)
+	}
+	if m.UniqueVisitors != 1 {
+		t.Errorf("expected 1 unique visitor, got %d", m.UniqueVisitors)
+	}
+}
+
+func TestStudioUserViewsAreNotCounted(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "reader", "password123")
+	post := publishTestPost(t, app, service.PostInput{Title: "Own Post"})
+
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{
+		"User-Agent": browserUA,
+		"Cookie":     "session_id=" + cookie.Value,
+	})
+	if err := app.AnalyticsSvc.Close(t.Context()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	metrics, err := app.AnalyticsSvc.GetPostMetrics(t.Context(), model.AnalyticsFilter{})
+	if err != nil {
+		t.Fatalf("GetPostMetrics: %v", err)
+	}
+	for _, m := range metrics {
+		if m.PostID == post.ID && m.ViewCount != 0 {
+			t.Errorf("signed-in view should not be recorded, got %d views", m.ViewCount)
+		}
+	}
+}
+
+// publishTestPost creates and publishes a post and returns it as stored.
+// A post without content gets a line naming it.
+func publishTestPost(t *testing.T, app *testutil.TestApp, in service.PostInput) *model.Post {
+	t.Helper()
+	if in.ContentMD == "" {
+		in.ContentMD = "Body of " + in.Title
+	}
+	p, err := app.PostSvc.Create(t.Context(), in)
+	if err != nil {
+		t.Fatalf("create %q: %v", in.Title, err)
+	}
+	if err := app.PostSvc.Publish(t.Context(), p.ID); err != nil {
+		t.Fatalf("publish %q: %v", in.Title, err)
+	}
+	if p, err = app.PostSvc.GetByID(t.Context(), p.ID); err != nil {
+		t.Fatalf("get %q: %v", in.Title, err)
+	}
+	return p
+}
+
+// waitForMetric polls until the post has at least min views or a second passes.
+func waitForMetric(t *testing.T, app *testutil.TestApp, postID, min int64) *model.PostMetric {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		metrics, err := app.AnalyticsSvc.GetPostMetrics(t.Context(), model.AnalyticsFilter{})
+		if err != nil {
+			t.Fatalf("GetPostMetrics: %v", err)
+		}
+		for _, m := range metrics {
+			if m.PostID == postID && (m.ViewCount >= min || time.Now().After(deadline)) {
+				return m
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("post %d not found in metrics", postID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReferrerAndCampaignAreRecorded(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Traffic Sources"})
+
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{
+		"User-Agent": browserUA + " reader-1",
+		"Referer":    "https://www.linkedin.com/feed/",
+	})
+	app.Do("GET", "/posts/"+post.Slug+"?utm_source=Newsletter&utm_medium=email&utm_campaign=launch", nil, map[string]string{
+		"User-Agent": browserUA + " reader-2",
+	})
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{
+		"User-Agent": browserUA + " reader-3",
+		"Referer":    "https://github.com/mateus-henrique-silva",
+	})
+	waitForMetric(t, app, post.ID, 3)
+
+	channels, err := app.AnalyticsSvc.ViewsByChannel(t.Context(), model.AnalyticsFilter{})
+	if err != nil {
+		t.Fatalf("ViewsByChannel: %v", err)
+	}
+	got := map[string]int64{}
+	for _, c := range channels {
+		got[c.Label] = c.Count
+	}
+	for _, ch := range []string{model.ChannelSocial, model.ChannelEmail, model.ChannelDeveloper} {
+		if got[ch] != 1 {
+			t.Errorf("expected 1 view in channel %q, got %d (%v)", ch, got[ch], got)
+		}
+	}
+
+	referrers, _ := app.AnalyticsSvc.TopReferrers(t.Context(), model.AnalyticsFilter{}, 10)
+	if len(referrers) != 2 {
+		t.Errorf("expected 2 referrer domains, got %d", len(referrers))
+	}
+	campaigns, _ := app.AnalyticsSvc.TopCampaigns(t.Context(), model.AnalyticsFilter{}, 10)
+	if len(campaigns) != 1 || campaigns[0].Source != "newsletter" || campaigns[0].Campaign != "launch" {
+		t.Errorf("unexpected campaigns: %+v", campaigns)
+	}
+
+	cookie := app.SeedUser(t, "admin", "password123")
+	resp := app.Do("GET", "/studio/metrics", nil, map[string]string{"Cookie": "session_id=" + cookie.Value})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("metrics page: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadingBeaconUpdatesEngagement(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Deep Read"})
+
+	resp := app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": browserUA})
+	body, _ := io.ReadAll(resp.Body)
+	m := regexp.MustCompile(`data-view-token="([0-9a-f-]{36})"`).FindSubmatch(body)
+	if m == nil {
+		t.Fatal("post page has no view token")
+	}
+	token := string(m[1])
+
+	for _, form := range []map[string]string{
+		{"t": token, "d": "50", "s": "20"},
+		{"t": token, "d": "80", "s": "42"},
+		{"t": token, "d": "25", "s": "5"}, // late, smaller beacon must not lower values
+	} {
+		if resp := app.PostForm("/beacon/read", form, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("beacon: expected 204, got %d", resp.StatusCode)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		engagement, err := app.AnalyticsSvc.GetPostEngagement(t.Context(), model.AnalyticsFilter{})
+		if err != nil {
+			t.Fatalf("GetPostEngagement: %v", err)
+		}
+		if len(engagement) == 1 && engagement[0].Reached75 == 1 && engagement[0].MedianSeconds == 42 {
+			if engagement[0].Reached100 != 0 {
+				t.Errorf("depth 80 should round down to 75, got Reached100=%d", engagement[0].Reached100)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("engagement not recorded: %+v", engagement)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRollupPreservesTotalsAndPurgesOldViews(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Rolled Up"})
+
+	now := time.Now().UTC()
+	insert := func(age time.Duration, visitor string, depth int) {
+		t.Helper()
+		_, err := app.DB.Write.Exec(
+			`INSERT INTO page_views (post_id, ip_hash, channel, referrer_domain, max_depth, viewed_at) VALUES (?, ?, 'social', 'linkedin.com', ?, ?)`,
+			post.ID, visitor, depth, now.Add(-age).Format(time.RFC3339))
+		if err != nil {
+			t.Fatalf("insert view: %v", err)
+		}
+	}
+	insert(100*24*time.Hour, "a", 100) // past retention
+	insert(5*24*time.Hour, "a", 50)
+	insert(5*24*time.Hour, "b", 0)
+	insert(0, "c", 0) // today, never rolled up
+
+	before := waitForMetric(t, app, post.ID, 4)
+	if err := app.AnalyticsSvc.Rollup(t.Context(), now); err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+	// A second run must not double count.
+	if err := app.AnalyticsSvc.Rollup(t.Context(), now); err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+	after := waitForMetric(t, app, post.ID, 4)
+	if after.ViewCount != before.ViewCount || after.UniqueVisitors != before.UniqueVisitors {
+		t.Errorf("metrics changed by rollup: before %+v, after %+v", *before, *after)
+	}
+
+	var raw int
+	app.DB.Read.QueryRow(`SELECT COUNT(*) FROM page_views`).Scan(&raw)
+	if raw != 3 {
+		t.Errorf("expected the view past retention to be purged, %d raw rows left", raw)
+	}
+	if total, _ := app.AnalyticsSvc.TotalViews(t.Context()); total != 4 {
+		t.Errorf("expected 4 total views after purge, got %d", total)
+	}
+	if today, _ := app.AnalyticsSvc.TotalViewsToday(t.Context()); today != 1 {
+		t.Errorf("expected 1 view today, got %d", today)
+	}
+	recent, _ := app.AnalyticsSvc.GetRecentViews(t.Context(), 30)
+	if len(recent) != 2 {
+		t.Errorf("expected 2 days with views in the last 30 days, got %d", len(recent))
+	}
+	channels, _ := app.AnalyticsSvc.ViewsByChannel(t.Context(), model.AnalyticsFilter{})
+	if len(channels) != 1 || channels[0].Count != 4 {
+		t.Errorf("expected 4 social views from rollups, got %+v", channels)
+	}
+	engagement, _ := app.AnalyticsSvc.GetPostEngagement(t.Context(), model.AnalyticsFilter{})
+	if len(engagement) != 1 || engagement[0].Reached50 != 2 || engagement[0].Reached100 != 1 {
+		t.Errorf("unexpected engagement after rollup: %+v", engagement)
+	}
+}
+
+// lockedBuffer is a log sink safe for the service's goroutines to write to.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCloseWaitsForRollup(t *testing.T) {
+	var logs lockedBuffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&logs, "json", "debug")))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	cfg := &config.Config{AnalyticsRollupInterval: time.Hour, AnalyticsRetention: 24 * time.Hour}
+	for range 10 {
+		db := database.Open(filepath.Join(t.TempDir(), "blog.db"))
+		database.RunMigrations(db)
+		// Close right away: the startup rollup may not even have begun.
+		svc := service.NewAnalyticsService(repository.NewAnalyticsRepo(db), cfg)
+		if err := svc.Close(t.Context()); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		db.Close() // nothing may touch the database once Close has returned
+	}
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(logs.String(), "rollup failed") {
+		t.Errorf("a rollup ran after Close returned: %s", logs.String())
+	}
+}
+
+func TestRollupSurvivesIdleDaysAfterPurge(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	app.Cfg.AnalyticsRetention = 72 * time.Hour
+	post := publishTestPost(t, app, service.PostInput{Title: "Gone Quiet"})
+
+	// Ten days of views, the last one 20 days ago, at odd hours.
+	now := time.Now().UTC()
+	for day := 20; day < 30; day++ {
+		viewed := now.AddDate(0, 0, -day).Add(-time.Duration(day) * time.Hour)
+		_, err := app.DB.Write.Exec(`INSERT INTO page_views (post_id, ip_hash, viewed_at) VALUES (?, ?, ?)`,
+			post.ID, "v", viewed.Format(time.RFC3339))
+		if err != nil {
+			t.Fatalf("insert view: %v", err)
+		}
+	}
+
+	// The hourly job keeps running through ten idle days.
+	for hour := 0; hour < 10*24; hour++ {
+		if err := app.AnalyticsSvc.Rollup(t.Context(), now.Add(time.Duration(hour)*time.Hour)); err != nil {
+			t.Fatalf("Rollup: %v", err)
+		}
+	}
+
+	var raw, days int
+	app.DB.Read.QueryRow(`SELECT COUNT(*) FROM page_views`).Scan(&raw)
+	app.DB.Read.QueryRow(`SELECT COUNT(*) FROM page_view_daily`).Scan(&days)
+	if raw != 0 || days != 10 {
+		t.Errorf("expected all raw views purged and 10 rolled-up days kept, got %d raw and %d days", raw, days)
+	}
+	if total, _ := app.AnalyticsSvc.TotalViews(t.Context()); total != 10 {
+		t.Errorf("expected 10 total views, got %d", total)
+	}
+}
+
+func TestPostMetricsPageWithDateRange(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	post := publishTestPost(t, app, service.PostInput{Title: "Ranged"})
+	headers := map[string]string{"Cookie": "session_id=" + cookie.Value}
+
+	today := time.Now().UTC()
+	for _, age := range []int{0, 1, 10} {
+		_, err := app.DB.Write.Exec(`INSERT INTO page_views (post_id, ip_hash, viewed_at) VALUES (?, ?, ?)`,
+			post.ID, "v", today.AddDate(0, 0, -age).Format(time.RFC3339))
+		if err != nil {
+			t.Fatalf("insert view: %v", err)
+		}
+	}
+
+	from := today.AddDate(0, 0, -6).Format("2006-01-02")
+	r, err := service.ParseDateRange(from, today.Format("2006-01-02"), today)
+	if err != nil {
+		t.Fatalf("ParseDateRange: %v", err)
+	}
+	report, err := app.AnalyticsSvc.GetPostReport(t.Context(), post.ID, r)
+	if err != nil {
+		t.Fatalf("GetPostReport: %v", err)
+	}
+	if report.Totals.Views != 2 || report.Previous.Views != 1 {
+		t.Errorf("expected 2 views in range and 1 in previous period, got %d and %d",
+			report.Totals.Views, report.Previous.Views)
+	}
+	if len(report.Daily) != 7 {
+		t.Errorf("expected 7 zero-filled days, got %d", len(report.Daily))
+	}
+	if report.ViewsChange() != 100 {
+		t.Errorf("expected +100%% views, got %.1f", report.ViewsChange())
+	}
+
+	path := fmt.Sprintf("/studio/metrics/posts/%d?from=%s&to=%s", post.ID, from, today.Format("2006-01-02"))
+	if resp := app.Do("GET", path, nil, headers); resp.StatusCode != http.StatusOK {
+		t.Errorf("post metrics page: expected 200, got %d", resp.StatusCode)
+	}
+	if resp := app.Do("GET", "/studio/metrics?from="+from, nil, headers); resp.StatusCode != http.StatusOK {
+		t.Errorf("metrics page with range: expected 200, got %d", resp.StatusCode)
+	}
+	if resp := app.Do("GET", "/studio/metrics?from=2026-13-01", nil, headers); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid range: expected 400, got %d", resp.StatusCode)
+	}
+	if resp := app.Do("GET", "/studio/metrics/posts/9999", nil, headers); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown post: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestMetricsExport(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	post := publishTestPost(t, app, service.PostInput{Title: "Exported"})
+	headers := map[string]string{"Cookie": "session_id=" + cookie.Value}
+
+	app.Do("GET", "/posts/"+post.Slug+"?utm_source=%3DHYPERLINK(1)", nil, map[string]string{"User-Agent": browserUA})
+	waitForMetric(t, app, post.ID, 1)
+
+	resp := app.Do("GET", "/studio/metrics/export?dataset=views&format=csv", nil, headers)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("csv export: expected 200, got %d", resp.StatusCode)
+	}
+	assertHeaderContains(t, resp.Header, "Content-Disposition", "attachment")
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "viewed_at" {
+		t.Fatalf("expected header and one view, got %v", rows)
+	}
+	if got := rows[1][5]; got != "'=hyperlink(1)" {
+		t.Errorf("formula-like UTM value should be escaped, got %q", got)
+	}
+
+	resp = app.Do("GET", "/studio/metrics/export?dataset=daily&format=json", nil, headers)
+	var daily struct {
+		Dataset string
+		Rows    []struct {
+			Day   string
+			Views int64
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&daily); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if daily.Dataset != "daily" || len(daily.Rows) != 30 || daily.Rows[29].Views != 1 {
+		t.Errorf("expected 30 zero-filled days ending with today's view, got %+v", daily)
+	}
+
+	if resp := app.Do("GET", "/studio/metrics/export?format=xml", nil, headers); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown export format: expected 400, got %d", resp.StatusCode)
+	}
+	if resp := app.Get("/studio/metrics/export"); resp.StatusCode == http.StatusOK {
+		t.Error("export must require authentication")
+	}
+}
+
+func TestLiveStreamsViewsAndReaders(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	post := publishTestPost(t, app, service.PostInput{Title: "Live Post"})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go app.App.Listener(ln)
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/studio/metrics/live", nil)
+	req.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer resp.Body.Close()
+	assertHeaderContains(t, resp.Header, "Content-Type", "text/event-stream")
+
+	events := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		var event string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				event = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				events <- event + " " + v
+			}
+		}
+		close(events)
+	}()
+
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for a live event")
+			return ""
+		}
+	}
+	if e := next(); !strings.HasPrefix(e, "readers ") {
+		t.Fatalf("expected an initial readers event, got %q", e)
+	}
+
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": browserUA, "Referer": "https://github.com/x"})
+	if e := next(); !strings.HasPrefix(e, "view ") || !strings.Contains(e, `"slug":"`+post.Slug+`"`) || !strings.Contains(e, `"referrer":"github.com"`) {
+		t.Errorf("expected a view event for the post, got %q", e)
+	}
+
+	readers := app.AnalyticsSvc.LiveReaders(time.Now())
+	if len(readers) != 1 || readers[0].PostID != post.ID || readers[0].Readers != 1 {
+		t.Errorf("expected one current reader on the post, got %+v", readers)
+	}
+	if len(app.AnalyticsSvc.LiveReaders(time.Now().Add(service.LiveWindow+time.Second))) != 0 {
+		t.Error("readers should expire after the live window")
+	}
+}
+
+func TestSlowLiveSubscriberIsDropped(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Busy Post"})
+
+	views, cancel := app.AnalyticsSvc.SubscribeLive()
+	defer cancel()
+
+	for i := 0; i < 50; i++ {
+		app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": fmt.Sprintf("%s visitor/%d", browserUA, i)})
+	}
+	waitForMetric(t, app, post.ID, 50)
+
+	received := 0
+	for range views {
+		received++
+	}
+	if received >= 50 {
+		t.Errorf("a subscriber that never reads should be dropped, but received all %d views", received)
+	}
+}
+
+func TestCloseDrainsQueuedViews(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Drained"})
+
+	const visitors = 40
+	for i := 0; i < visitors; i++ {
+		app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": fmt.Sprintf("%s visitor/%d", browserUA, i)})
+	}
+	app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": browserUA + " visitor/0"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := app.AnalyticsSvc.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var count int64
+	app.DB.Read.QueryRow(`SELECT COUNT(*) FROM page_views WHERE post_id = ?`, post.ID).Scan(&count)
+	if count != visitors {
+		t.Errorf("expected all %d queued views written before Close returned, got %d", visitors, count)
+	}
+
+	if token := app.AnalyticsSvc.RecordView(context.Background(), post.ID, "10.0.0.1", browserUA, model.TrafficSource{}); token != "" {
+		t.Error("RecordView after Close should not queue anything")
+	}
+	stats := app.AnalyticsSvc.Stats()
+	if stats.Queued != visitors+1 || stats.Written != visitors || stats.Deduplicated != 1 ||
+		stats.Dropped != 1 || stats.Failed != 0 || stats.QueueDepth != 0 {
+		t.Errorf("unexpected pipeline stats: %+v", stats)
+	}
+}
+
+func TestShutdownEndsLiveStreams(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go app.App.Listener(ln)
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/studio/metrics/live", nil)
+	req.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	app.AnalyticsSvc.StopLive()
+	if err := app.App.ShutdownWithContext(ctx); err != nil {
+		t.Fatalf("shutdown should not wait for the live stream: %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("stream should end cleanly, got %v", err)
+	}
+	if err := app.AnalyticsSvc.Close(ctx); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package integration_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/internal/site"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+var monthHeadingRe = regexp.MustCompile(`<h2 class="timeline-month-title">\s*<a href="([^"]+)">([^<]+)</a>\s*<span class="timeline-count">([^<]+)</span>`)
+
+// seedArchive publishes posts in December 2023, January 2024 and March 2024
+// and returns them by title.
+func seedArchive(t *testing.T, app *testutil.TestApp) map[string]*model.Post {
+	t.Helper()
+	posts := make(map[string]*model.Post)
+	for title, published := range map[string]string{
+		"December notes": "2023-12-20T10:00:00Z",
+		"New year":       "2024-01-02T10:00:00Z",
+		"January recap":  "2024-01-30T10:00:00Z",
+		"March one":      "2024-03-01T10:00:00Z",
+		"March two":      "2024-03-15T10:00:00Z",
+		"March three":    "2024-03-31T23:59:59Z",
+	} {
+		p := publishTestPost(t, app, service.PostInput{Title: title})
+		app.DB.Write.Exec(`UPDATE posts SET published_at = ? WHERE id = ?`, published, p.ID)
+		posts[title], _ = app.PostSvc.GetByID(t.Context(), p.ID)
+	}
+	return posts
+}
+
+func monthHeadings(body string) []string {
+	var out []string
+	for _, m := range monthHeadingRe.FindAllStringSubmatch(body, -1) {
+		out = append(out, m[1]+" "+m[2]+" · "+m[3])
+	}
+	return out
+}
+
+func TestTimelineGroupsByMonth(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	seedArchive(t, app)
+
+	body := readBody(t, app.Get("/timeline"))
+	want := []string{
+		"/archive/2024/03 March 2024 · 3 posts",
+		"/archive/2024/01 January 2024 · 2 posts",
+		"/archive/2023/12 December 2023 · 1 post",
+	}
+	if got := monthHeadings(body); !slices.Equal(got, want) {
+		t.Errorf("month headings:\n got %v\nwant %v", got, want)
+	}
+	for _, want := range []string{
+		`<a href="/archive/2024" class="archive-year-link">2024</a>
+      <span class="timeline-count">5</span>`,
+		`<li><a href="/archive/2024/03">March</a> <span class="timeline-count">3</span></li>`,
+		`<a href="/archive/2023" class="archive-year-link">2023</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("archive index is missing %s", want)
+		}
+	}
+}
+
+func TestArchivePages(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	posts := seedArchive(t, app)
+
+	year := readBody(t, app.Get("/archive/2024"))
+	if got := monthHeadings(year); len(got) != 2 || strings.Contains(year, "December notes") {
+		t.Errorf("year page should list 2024's months only, got %v", got)
+	}
+	if !strings.Contains(year, `<a href="/timeline" class="breadcrumb">`) {
+		t.Error("year page should link back to the timeline")
+	}
+
+	month := readBody(t, app.Get("/archive/2024/03"))
+	if got := monthHeadings(month); !slices.Equal(got, []string{"/archive/2024/03 March 2024 · 3 posts"}) {
+		t.Errorf("month page headings: %v", got)
+	}
+	// The last second of the month still belongs to it.
+	if !strings.Contains(month, "March three") || strings.Contains(month, "January recap") {
+		t.Error("month page lists the wrong posts")
+	}
+	if !strings.Contains(month, `<a href="/archive/2024" class="breadcrumb">`) {
+		t.Error("month page should link back to its year")
+	}
+
+	for _, path := range []string{"/archive/2024/02", "/archive/2022", "/archive/24", "/archive/2024/3", "/archive/2024/13", "/archive/year"} {
+		if resp := app.Get(path); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, resp.StatusCode)
+		}
+	}
+
+	// Unpublishing a March post invalidates March and 2024, not December.
+	app.Get("/archive/2023/12")
+	app.DB.Write.Exec(`UPDATE posts SET title = 'December (db)' WHERE id = ?`, posts["December notes"].ID)
+	app.PostSvc.Unpublish(t.Context(), posts["March two"].ID)
+	if got := monthHeadings(readBody(t, app.Get("/archive/2024/03"))); !slices.Equal(got, []string{"/archive/2024/03 March 2024 · 2 posts"}) {
+		t.Errorf("March after unpublishing: %v", got)
+	}
+	if strings.Contains(readBody(t, app.Get("/archive/2023/12")), "December (db)") {
+		t.Error("other months should stay cached")
+	}
+}
+
+func TestStaticArchiveUpdate(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	posts := seedArchive(t, app)
+	b := newBuilder(t, app)
+	if _, err := b.Build(t.Context()); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	dir := b.Dir()
+	for _, f := range []string{"archive/2023/index.html", "archive/2023/12/index.html", "archive/2024/03/index.html"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("missing %s", f)
+		}
+	}
+
+	var changes []site.Change
+	app.PostSvc.OnChange(func(before, after *model.Post) {
+		changes = append(changes, site.Change{Before: before, After: after})
+	})
+	app.PostSvc.Unpublish(t.Context(), posts["December notes"].ID)
+	app.PostSvc.Unpublish(t.Context(), posts["New year"].ID)
+	if _, err := b.Update(t.Context(), changes); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "archive/2023")); !os.IsNotExist(err) {
+		t.Error("an emptied year should be removed")
+	}
+	jan := readFile(t, filepath.Join(dir, "archive/2024/01/index.html"))
+	if strings.Contains(jan, "New year") || !strings.Contains(jan, "January 2024") {
+		t.Error("January should be rebuilt without the unpublished post")
+	}
+}
+
+// queryPlan returns the EXPLAIN QUERY PLAN details for query, one per line.
+func queryPlan(t *testing.T, app *testutil.TestApp, query string, args ...any) string {
+	t.Helper()
+	rows, err := app.DB.Read.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatalf("explain: %v", err)
+		}
+		lines = append(lines, detail)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The month archive query, as PostRepo.List builds it, and the timeline's
+// month counts seek within the status index on the published key rather
+// than scanning posts or sorting them.
+func TestArchiveQueriesSeekPublishedIndex(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	seedArchive(t, app)
+
+	plan := queryPlan(t, app, `SELECT id, title, COALESCE(published_at, '') FROM posts
+		WHERE status = ? AND COALESCE(published_at, '') >= ? AND COALESCE(published_at, '') > '' AND COALESCE(published_at, '') < ?
+		ORDER BY COALESCE(published_at, '') DESC, id DESC LIMIT ?`,
+		"published", "2024-03-01T00:00:00Z", "2024-04-01T00:00:00Z", 21)
+	if !strings.Contains(plan, "SEARCH posts USING INDEX idx_posts_status_published (status=? AND <expr>>? AND <expr><?)") {
+		t.Errorf("month query should seek the date range in idx_posts_status_published:\n%s", plan)
+	}
+	if strings.Contains(plan, "TEMP B-TREE") {
+		t.Errorf("month query should read posts in index order:\n%s", plan)
+	}
+
+	plan = queryPlan(t, app, `SELECT CAST(substr(COALESCE(published_at, ''), 1, 4) AS INTEGER), CAST(substr(COALESCE(published_at, ''), 6, 2) AS INTEGER), COUNT(*)
+		FROM posts WHERE status='published' AND COALESCE(published_at, '') > ''
+		GROUP BY 1, 2 ORDER BY 1 DESC, 2 DESC`)
+	if !strings.Contains(plan, "SEARCH posts USING INDEX idx_posts_status_published (status=? AND <expr>>?)") {
+		t.Errorf("month counts should seek idx_posts_status_published:\n%s", plan)
+	}
+}
@@ -0,0 +1,291 @@
+package integration_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/backup"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/database"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+// seedBackup creates a post and an upload and backs them up.
+func seedBackup(t *testing.T, app *testutil.TestApp) string {
+	t.Helper()
+	if _, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Backed up", ContentMD: "body"}); err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(app.Cfg.UploadDir, "photo.jpg"), []byte("jpeg bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := app.BackupSvc.Create(t.Context())
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	return filepath.Join(app.Cfg.BackupDir, a.Name)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	archive := seedBackup(t, app)
+
+	m, err := backup.Verify(archive)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	if !slices.Equal(paths, []string{"blog.db", "uploads/photo.jpg"}) {
+		t.Errorf("unexpected files %v", paths)
+	}
+	if !slices.Equal(m.Migrations, database.Migrations()) {
+		t.Errorf("manifest migrations %v", m.Migrations)
+	}
+
+	// Restore over an existing install, which must be kept aside.
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "blog.db")
+	uploadDir := filepath.Join(dir, "uploads")
+	os.WriteFile(dbPath, []byte("old database"), 0o644)
+	os.MkdirAll(uploadDir, 0o755)
+	os.WriteFile(filepath.Join(uploadDir, "old.jpg"), []byte("old"), 0o644)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := backup.Restore(t.Context(), archive, dbPath, uploadDir, now); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if b, _ := os.ReadFile(dbPath + ".pre-restore-20260301T120000Z"); string(b) != "old database" {
+		t.Error("previous database was not kept aside")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "uploads.pre-restore-20260301T120000Z", "old.jpg")); string(b) != "old" {
+		t.Error("previous uploads were not kept aside")
+	}
+	if b, _ := os.ReadFile(filepath.Join(uploadDir, "photo.jpg")); string(b) != "jpeg bytes" {
+		t.Error("upload was not restored")
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, "old.jpg")); !os.IsNotExist(err) {
+		t.Error("old upload should have been moved aside")
+	}
+	// Nothing of the restore is left where the uploads are served from.
+	if entries, _ := os.ReadDir(uploadDir); len(entries) != 1 {
+		t.Errorf("upload directory holds %v", entries)
+	}
+
+	db := database.Open(dbPath)
+	defer db.Close()
+	var title string
+	if err := db.Read.QueryRow(`SELECT title FROM posts`).Scan(&title); err != nil || title != "Backed up" {
+		t.Errorf("restored post: %q, %v", title, err)
+	}
+}
+
+func TestRestoreRejectsTamperedArchive(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	archive := seedBackup(t, app)
+	tampered := filepath.Join(t.TempDir(), "tampered.tar.gz")
+	rewriteArchive(t, archive, tampered, func(name string, body []byte) []byte {
+		if name == "uploads/photo.jpg" {
+			return []byte("JPEG bytes") // same size, different content
+		}
+		return body
+	})
+
+	if _, err := backup.Verify(tampered); !errors.Is(err, backup.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "blog.db")
+	uploadDir := filepath.Join(dir, "uploads")
+	os.WriteFile(dbPath, []byte("current"), 0o644)
+	if _, err := backup.Restore(t.Context(), tampered, dbPath, uploadDir, time.Now()); !errors.Is(err, backup.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	if b, _ := os.ReadFile(dbPath); string(b) != "current" {
+		t.Error("a rejected archive must leave the database alone")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("staging files left behind: %v", entries)
+	}
+	if staged, _ := os.ReadDir(uploadDir); len(staged) != 0 {
+		t.Errorf("staging files left behind: %v", staged)
+	}
+}
+
+func TestRestoreUndoesSwapOnFailure(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	archive := seedBackup(t, app)
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "blog.db")
+	uploadDir := filepath.Join(dir, "uploads")
+	os.WriteFile(dbPath, []byte("current"), 0o644)
+	os.WriteFile(dbPath+"-wal", []byte("current wal"), 0o644)
+	os.MkdirAll(uploadDir, 0o755)
+	os.WriteFile(filepath.Join(uploadDir, "old.jpg"), []byte("old"), 0o644)
+	// A file where the uploads would be moved aside makes that step fail
+	// after the database was swapped.
+	blocker := filepath.Join(dir, "uploads.pre-restore-20260301T120000Z")
+	os.WriteFile(blocker, []byte("in the way"), 0o644)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := backup.Restore(t.Context(), archive, dbPath, uploadDir, now); err == nil {
+		t.Fatal("restore should fail")
+	}
+	for path, want := range map[string]string{
+		dbPath:                              "current",
+		dbPath + "-wal":                     "current wal",
+		filepath.Join(uploadDir, "old.jpg"): "old",
+		blocker:                             "in the way",
+	} {
+		if b, _ := os.ReadFile(path); string(b) != want {
+			t.Errorf("%s = %q, want %q", path, b, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 4 {
+		t.Errorf("files left behind: %v", entries)
+	}
+	if entries, _ := os.ReadDir(uploadDir); len(entries) != 1 {
+		t.Errorf("uploads left behind: %v", entries)
+	}
+}
+
+func TestScheduledBackupBacksOffAfterFailure(t *testing.T) {
+	// A closed database makes every backup fail.
+	db := database.Open(filepath.Join(t.TempDir(), "blog.db"))
+	db.Close()
+	cfg := &config.Config{BackupDir: t.TempDir(), UploadDir: t.TempDir(), BackupInterval: time.Hour}
+	svc := service.NewBackupService(db, cfg)
+	reg := metrics.NewRegistry()
+	svc.RegisterMetrics(reg)
+
+	// No archive exists, so the first backup is due at once; after it fails
+	// the next waits.
+	time.Sleep(300 * time.Millisecond)
+	if err := svc.Close(t.Context()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var out strings.Builder
+	reg.WriteTo(&out)
+	if !strings.Contains(out.String(), "\nbackup_failures_total 1\n") {
+		t.Errorf("expected one failed attempt:\n%s", out.String())
+	}
+}
+
+// rewriteArchive copies src to dst, passing each file through edit.
+func rewriteArchive(t *testing.T, src, dst string, edit func(name string, body []byte) []byte) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(tr)
+		body = edit(hdr.Name, body)
+		hdr.Size = int64(len(body))
+		tw.WriteHeader(hdr)
+		tw.Write(body)
+	}
+	tw.Close()
+	gw.Close()
+	if err := os.WriteFile(dst, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		if _, err := backup.Create(t.Context(), app.DB, app.Cfg.UploadDir, dir, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("backup %d: %v", i, err)
+		}
+	}
+
+	removed, err := backup.Prune(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || removed[1] != "blog-backup-20260301T000000Z.tar.gz" {
+		t.Errorf("expected the two oldest to be removed, got %v", removed)
+	}
+	archives, _ := backup.List(dir)
+	if len(archives) != 3 || archives[0].Name != "blog-backup-20260301T040000Z.tar.gz" {
+		t.Errorf("unexpected archives left: %+v", archives)
+	}
+}
+
+func TestStudioBackups(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	headers := map[string]string{"Cookie": "session_id=" + cookie.Value}
+
+	resp := app.PostForm("/studio/backups", nil, []*http.Cookie{cookie})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("create: expected 303, got %d", resp.StatusCode)
+	}
+	archives, _ := app.BackupSvc.List()
+	if len(archives) != 1 {
+		t.Fatalf("expected one archive, got %d", len(archives))
+	}
+	name := archives[0].Name
+
+	resp = app.Do("GET", "/studio/backups", nil, headers)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), name) {
+		t.Error("backup list should show the new archive")
+	}
+
+	resp = app.Do("GET", "/studio/backups/"+name, nil, headers)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download: expected 200, got %d", resp.StatusCode)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, name) {
+		t.Errorf("download: Content-Disposition %q", cd)
+	}
+
+	for _, bad := range []string{"blog-backup-20000101T000000Z.tar.gz", "..%2F..%2Fblog.db", "manifest.json"} {
+		if resp := app.Do("GET", "/studio/backups/"+bad, nil, headers); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", bad, resp.StatusCode)
+		}
+	}
+
+	if resp := app.Get("/studio/backups"); resp.StatusCode != http.StatusSeeOther && resp.StatusCode != http.StatusFound {
+		t.Errorf("backups page must require sign-in, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,172 @@
+package integration_test
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestPageCacheRevalidation(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	publishTestPost(t, app, service.PostInput{Title: "Cached post", Category: "Go"})
+
+	first := app.Get("/")
+	body := readBody(t, first)
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", first.StatusCode, etag)
+	}
+	if cc := first.Header.Get("Cache-Control"); cc != "public, no-cache" {
+		t.Errorf("Cache-Control %q", cc)
+	}
+
+	second := app.Get("/")
+	if readBody(t, second) != body || second.Header.Get("ETag") != etag {
+		t.Error("a cached page should be sent unchanged")
+	}
+	if second.Header.Get("X-Frame-Options") != "DENY" {
+		t.Error("cached pages still get the security headers")
+	}
+
+	resp := app.Do("GET", "/", nil, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified || readBody(t, resp) != "" {
+		t.Errorf("expected an empty 304, got %d", resp.StatusCode)
+	}
+	resp = app.Do("GET", "/", nil, map[string]string{"If-None-Match": `"stale"`})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("a different ETag should get the page, got %d", resp.StatusCode)
+	}
+
+	metrics := readBody(t, app.Do("GET", "/metrics", nil, map[string]string{"Authorization": "Bearer test-metrics-token"}))
+	for _, want := range []string{
+		`page_cache_requests_total{result="hit"} 3`,
+		`page_cache_requests_total{result="miss"} 1`,
+		"page_cache_entries 1",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestPageCacheInvalidatesPrecisely(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	ctx := t.Context()
+	a := publishTestPost(t, app, service.PostInput{Title: "Post A", Category: "Go"})
+	b := publishTestPost(t, app, service.PostInput{Title: "Post B", Category: "Rust"})
+	cookie := app.SeedUser(t, "admin", "password123")
+	signedIn := map[string]string{"Cookie": "session_id=" + cookie.Value}
+
+	for _, path := range []string{"/", "/timeline", "/categories/Go", "/posts/" + a.Slug, "/posts/" + b.Slug} {
+		app.Do("GET", path, nil, signedIn)
+	}
+	// Changed behind the service's back, so only a cache miss shows it.
+	app.DB.Write.Exec(`UPDATE posts SET title = 'Post A (db)' WHERE id = ?`, a.ID)
+
+	app.PostSvc.Update(ctx, b.ID, service.PostInput{Title: "Post B", ContentMD: "edited body", Category: "Rust"})
+
+	if page := readBody(t, app.Do("GET", "/posts/"+b.Slug, nil, signedIn)); !strings.Contains(page, "edited body") {
+		t.Error("the edited post should be rendered again")
+	}
+	// Any post page may list the edited post as related.
+	if page := readBody(t, app.Do("GET", "/posts/"+a.Slug, nil, signedIn)); !strings.Contains(page, "Post A (db)") {
+		t.Error("other posts' pages should be rendered again")
+	}
+	if page := readBody(t, app.Get("/categories/Go")); strings.Contains(page, "Post A (db)") {
+		t.Error("categories the post isn't in should stay cached")
+	}
+	if page := readBody(t, app.Get("/")); !strings.Contains(page, "Post A (db)") {
+		t.Error("the home page lists every post and should be rendered again")
+	}
+
+	// Drafts aren't public, so editing one changes nothing.
+	app.Get("/timeline")
+	draft, _ := app.PostSvc.Create(ctx, service.PostInput{Title: "Draft"})
+	app.DB.Write.Exec(`UPDATE posts SET title = 'Post B (db)' WHERE id = ?`, b.ID)
+	app.PostSvc.Update(ctx, draft.ID, service.PostInput{Title: "Draft", ContentMD: "x"})
+	if page := readBody(t, app.Get("/timeline")); strings.Contains(page, "Post B (db)") {
+		t.Error("draft edits should not invalidate public pages")
+	}
+
+	// A 404 isn't cached, so publishing the draft shows it at once.
+	if resp := app.Get("/posts/" + draft.Slug); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("draft: expected 404, got %d", resp.StatusCode)
+	}
+	app.PostSvc.Publish(ctx, draft.ID)
+	if resp := app.Get("/posts/" + draft.Slug); resp.StatusCode != http.StatusOK {
+		t.Errorf("published draft: expected 200, got %d", resp.StatusCode)
+	}
+	if page := readBody(t, app.Get("/timeline")); !strings.Contains(page, "Post B (db)") {
+		t.Error("publishing should invalidate the timeline")
+	}
+
+	// Unpublishing and deleting take the page down.
+	app.PostSvc.Unpublish(ctx, a.ID)
+	if resp := app.Get("/posts/" + a.Slug); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unpublished post: expected 404, got %d", resp.StatusCode)
+	}
+	app.PostSvc.Delete(ctx, draft.ID)
+	if resp := app.Get("/posts/" + draft.Slug); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted post: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+var viewTokenRe = regexp.MustCompile(`data-view-token="([^"]+)"`)
+
+func TestCachedPostPagesStillCountViews(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Counted"})
+
+	var tokens []string
+	for _, ua := range []string{browserUA, browserUA + " Edg/126.0"} {
+		resp := app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"User-Agent": ua})
+		if cc := resp.Header.Get("Cache-Control"); cc != "private, no-store" {
+			t.Errorf("counted views must not be stored, got Cache-Control %q", cc)
+		}
+		m := viewTokenRe.FindStringSubmatch(readBody(t, resp))
+		if m == nil {
+			t.Fatal("post page has no view token")
+		}
+		tokens = append(tokens, m[1])
+	}
+	if tokens[0] == tokens[1] || strings.Contains(tokens[0], "placeholder") {
+		t.Errorf("each view needs its own token, got %v", tokens)
+	}
+	if m := waitForMetric(t, app, post.ID, 2); m.ViewCount != 2 {
+		t.Errorf("expected 2 views, got %d", m.ViewCount)
+	}
+
+	// Bots aren't counted, so they get the plain page and can revalidate it.
+	bot := map[string]string{"User-Agent": "Googlebot/2.1"}
+	resp := app.Do("GET", "/posts/"+post.Slug, nil, bot)
+	if body := readBody(t, resp); strings.Contains(body, "data-view-token") || resp.Header.Get("ETag") == "" {
+		t.Error("uncounted readers should get the plain page with an ETag")
+	}
+	bot["If-None-Match"] = resp.Header.Get("ETag")
+	if resp := app.Do("GET", "/posts/"+post.Slug, nil, bot); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", resp.StatusCode)
+	}
+}
+
+func TestStudioPagesAreNotCached(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	headers := map[string]string{"Cookie": "session_id=" + cookie.Value}
+
+	app.Do("GET", "/studio/posts", nil, headers)
+	app.DB.Write.Exec(`INSERT INTO posts (uuid, title, slug, status) VALUES ('u1', 'Inserted directly', 'inserted-directly', 'draft')`)
+	resp := app.Do("GET", "/studio/posts", nil, headers)
+	if !strings.Contains(readBody(t, resp), "Inserted directly") {
+		t.Error("studio pages must always be rendered")
+	}
+	if resp.Header.Get("ETag") != "" {
+		t.Error("studio pages must not carry cache validators")
+	}
+	if app.PageCache.Len() != 0 {
+		t.Errorf("nothing should be cached, got %d pages", app.PageCache.Len())
+	}
+}
@@ -0,0 +1,54 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/middleware"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestCancelledContextAbortsQueries(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := app.PostSvc.ListPublished(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from a cancelled request, got %v", err)
+	}
+	if _, err := app.AnalyticsSvc.TotalViews(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from analytics, got %v", err)
+	}
+}
+
+func TestRequestDeadlineAnswers503(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	// A deadline that has already passed by the time the query runs.
+	srv := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	srv.Use(middleware.RequestID())
+	srv.Use(middleware.RequestTimeout(time.Nanosecond))
+	srv.Get("/", func(c *fiber.Ctx) error {
+		time.Sleep(time.Millisecond)
+		posts, err := app.PostSvc.ListPublished(c.UserContext())
+		if err != nil {
+			return err
+		}
+		return c.JSON(posts)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := srv.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once the request deadline passed, got %d", resp.StatusCode)
+	}
+}
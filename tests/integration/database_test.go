@@ -0,0 +1,140 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/database"
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/repository"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestReadPoolIsReadOnly(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	var mode string
+	if err := app.DB.Read.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatalf("journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("expected WAL journal mode, got %q", mode)
+	}
+	if _, err := app.DB.Read.Exec(`DELETE FROM posts`); err == nil {
+		t.Error("read pool should reject writes")
+	}
+	if _, err := app.DB.Write.Exec(`DELETE FROM posts`); err != nil {
+		t.Errorf("write pool: %v", err)
+	}
+}
+
+// BenchmarkPublicReadsUnderViewWrites measures public page lookups while
+// background writers record views as the analytics worker does. The
+// "shared-pool" case routes reads through the single write connection, as
+// before the pools were split.
+//
+//	go test -run '^$' -bench PublicReads ./tests/integration
+func BenchmarkPublicReadsUnderViewWrites(b *testing.B) {
+	b.Run("shared-pool", func(b *testing.B) {
+		benchmarkPublicReads(b, func(db *database.DB) *database.DB {
+			return &database.DB{Write: db.Write, Read: db.Write}
+		})
+	})
+	b.Run("read-pool", func(b *testing.B) {
+		benchmarkPublicReads(b, func(db *database.DB) *database.DB { return db })
+	})
+}
+
+func benchmarkPublicReads(b *testing.B, pools func(*database.DB) *database.DB) {
+	ctx := context.Background()
+	db := database.Open(filepath.Join(b.TempDir(), "blog.db"))
+	defer db.Close()
+	database.RunMigrations(db)
+	bdb := pools(db)
+
+	posts := service.NewPostService(repository.NewPostRepo(bdb))
+	analytics := repository.NewAnalyticsRepo(bdb)
+
+	const numPosts = 20
+	ids := make([]int64, numPosts)
+	slugs := make([]string, numPosts)
+	for i := range numPosts {
+		p, err := posts.Create(ctx, service.PostInput{
+			Title:     fmt.Sprintf("Benchmark post %d", i),
+			ContentMD: "# Heading\n\nSome **markdown** body text.",
+			Category:  "bench",
+		})
+		if err != nil {
+			b.Fatalf("seed: %v", err)
+		}
+		if err := posts.Publish(ctx, p.ID); err != nil {
+			b.Fatalf("publish: %v", err)
+		}
+		ids[i], slugs[i] = p.ID, p.Slug
+	}
+
+	// Writers commit small batches of views back to back until the
+	// benchmark ends.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var views atomic.Int64
+	for w := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				batch, err := analytics.BeginBatch(ctx)
+				if err != nil {
+					b.Errorf("begin batch: %v", err)
+					return
+				}
+				for i := range 10 {
+					token := fmt.Sprintf("w%d-%d-%d", w, n, i)
+					if err := batch.RecordView(ctx, ids[i%numPosts], token, "bench", token, model.TrafficSource{Channel: model.ChannelDirect}); err != nil {
+						batch.Rollback()
+						b.Errorf("record view: %v", err)
+						return
+					}
+				}
+				if err := batch.Commit(); err != nil {
+					b.Errorf("commit: %v", err)
+					return
+				}
+				views.Add(10)
+			}
+		}()
+	}
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			if i%5 == 0 {
+				if _, err := posts.ListPublished(ctx); err != nil {
+					b.Errorf("list: %v", err)
+					return
+				}
+				continue
+			}
+			if _, err := posts.GetBySlug(ctx, slugs[i%numPosts]); err != nil {
+				b.Errorf("get: %v", err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+	b.ReportMetric(float64(views.Load())/b.Elapsed().Seconds(), "views/s")
+}
@@ -0,0 +1,69 @@
+package integration_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/mailer"
+	"github.com/mhtecdev/blog-ai/internal/repository"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestWeeklyDigestIsSentOncePerWeek(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	post := publishTestPost(t, app, service.PostInput{Title: "Digest Star"})
+
+	// Monday 9:00 UTC; the digest covers the previous Monday to Sunday.
+	now := time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)
+	for _, ts := range []string{"2026-03-10T10:00:00Z", "2026-03-15T10:00:00Z", "2026-03-04T10:00:00Z"} {
+		if _, err := app.DB.Write.Exec(`INSERT INTO page_views (post_id, ip_hash, viewed_at) VALUES (?, ?, ?)`, post.ID, ts, ts); err != nil {
+			t.Fatalf("insert view: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		SiteURL:       "https://blog.example.com",
+		MailFrom:      "blog@example.com",
+		DigestTo:      []string{"owner@example.com"},
+		DigestWeekday: time.Monday,
+		DigestHour:    8,
+	}
+	digest := service.NewDigestService(repository.NewAnalyticsRepo(app.DB), app.AnalyticsSvc, mailer.NewFileMailer(dir), cfg)
+
+	for i, want := range []bool{true, false} {
+		sent, err := digest.SendDue(t.Context(), now)
+		if err != nil {
+			t.Fatalf("SendDue #%d: %v", i+1, err)
+		}
+		if sent != want {
+			t.Errorf("SendDue #%d: expected sent=%v, got %v", i+1, want, sent)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected exactly one digest file, got %d", len(files))
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read digest: %v", err)
+	}
+	body := string(raw)
+	for _, want := range []string{
+		"To: owner@example.com",
+		"Mar 9, 2026 – Mar 15, 2026",
+		"Digest Star",
+		"2 views (+100% vs previous week)",
+		"https://blog.example.com/posts/" + post.Slug,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("digest should contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"request_id"`
+}
+
+func TestErrorPages(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	headers := map[string]string{"Cookie": "session_id=" + cookie.Value}
+
+	cases := []struct {
+		path    string
+		status  int
+		message string
+	}{
+		{"/no-such-page", http.StatusNotFound, "doesn&#39;t exist"},
+		{"/posts/no-such-post", http.StatusNotFound, "The post you&#39;re looking for"},
+		{"/studio/posts/abc/edit", http.StatusBadRequest, "not a number"},
+		{"/studio/metrics?from=yesterday", http.StatusBadRequest, "date range is invalid"},
+	}
+	for _, tc := range cases {
+		resp := app.Do("GET", tc.path, nil, headers)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.path, tc.status, resp.StatusCode)
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			t.Errorf("%s: expected an HTML error page, got %q", tc.path, resp.Header.Get("Content-Type"))
+		}
+		if !strings.Contains(string(body), tc.message) {
+			t.Errorf("%s: page is missing %q", tc.path, tc.message)
+		}
+		if id := resp.Header.Get("X-Request-ID"); !strings.Contains(string(body), id) {
+			t.Errorf("%s: page does not show request ID %s", tc.path, id)
+		}
+	}
+}
+
+func TestProblemDetailsForJSONClients(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	resp := app.Do("GET", "/no-such-page", nil, map[string]string{"Accept": "application/json"})
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+		t.Errorf("expected application/problem+json, got %q", ct)
+	}
+	var p problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Status != 404 || p.Title != "Not Found" || p.Instance != "/no-such-page" || p.Detail == "" {
+		t.Errorf("unexpected problem: %+v", p)
+	}
+	if p.RequestID == "" || p.RequestID != resp.Header.Get("X-Request-ID") {
+		t.Errorf("problem request_id %q does not match header", p.RequestID)
+	}
+}
+
+func TestUploadErrorsAreProblemDetails(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+
+	upload := func(body io.Reader, contentType string) (*http.Response, problem) {
+		req := httptest.NewRequest(http.MethodPost, "/studio/upload", body)
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(cookie)
+		resp, err := app.App.Test(req, -1)
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		var p problem
+		json.NewDecoder(resp.Body).Decode(&p)
+		return resp, p
+	}
+
+	resp, p := upload(strings.NewReader(""), "application/x-www-form-urlencoded")
+	if resp.StatusCode != http.StatusBadRequest || p.Status != http.StatusBadRequest {
+		t.Errorf("missing file: expected 400 problem, got %d %+v", resp.StatusCode, p)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+		t.Errorf("missing file: expected problem JSON, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("file", "script.sh")
+	fw.Write([]byte("#!/bin/sh\n"))
+	mw.Close()
+	resp, p = upload(&buf, mw.FormDataContentType())
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(p.Detail, "not supported") {
+		t.Errorf("unsupported type: expected 400 with a reason, got %d %+v", resp.StatusCode, p)
+	}
+}
+
+func TestRateLimitRendersErrorPage(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	var resp *http.Response
+	for i := 0; i < 4; i++ {
+		resp = app.PostForm("/studio/login", map[string]string{"username": "x", "password": "y"}, nil)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("Retry-After header missing")
+	}
+	if !strings.Contains(string(body), "Too many sign-in attempts") {
+		t.Error("429 page is missing its message")
+	}
+}
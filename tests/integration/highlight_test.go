@@ -0,0 +1,67 @@
+package integration_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestCodeHighlighting(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	md := "```go {linenos=true hl_lines=\"11-12\" linenostart=10}\npackage main\n\nfunc main() {}\n```\n\n" +
+		"```\n<plain & simple>\n```\n\n" +
+		"```nosuchlang\nstill <escaped>\n```\n\n" +
+		`<pre class="evil"><span class="k" style="color:red" onclick="x()">raw</span></pre>` + "\n"
+	p, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Code", ContentMD: md})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	html := p.ContentHTML
+
+	for _, want := range []string{
+		`<pre class="chroma"><code><span class="line"><span class="ln">10</span><span class="cl"><span class="kn">package</span> <span class="nx">main</span>`,
+		`<span class="line hl"><span class="ln">11</span>`,
+		`<span class="line hl"><span class="ln">12</span><span class="cl"><span class="kd">func</span>`,
+		`<span class="line"><span class="cl">&lt;plain &amp; simple&gt;`,
+		`<span class="cl">still &lt;escaped&gt;`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("highlighted HTML is missing %s", want)
+		}
+	}
+	// Only Chroma's own classes survive, and never inline styles.
+	if strings.Contains(html, "evil") || strings.Contains(html, "style=") || strings.Contains(html, "onclick") {
+		t.Errorf("sanitizer let markup through: %s", html)
+	}
+	if !strings.Contains(html, `<span class="k">raw</span>`) {
+		t.Error("raw HTML using a Chroma class should keep it")
+	}
+}
+
+func TestCodeStylesheet(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	resp := app.Get("/code.css")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Fatalf("GET /code.css: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	css := readBody(t, resp)
+	for _, want := range []string{
+		"/* Keyword */ .chroma .k {",
+		`/* Keyword */ [data-theme="dark"] .chroma .k {`,
+		"/* LineHighlight */ .chroma .hl {",
+	} {
+		if !strings.Contains(css, want) {
+			t.Errorf("stylesheet is missing %s", want)
+		}
+	}
+	if !strings.Contains(readBody(t, app.Get("/about")), `<link rel="stylesheet" href="/code.css">`) {
+		t.Error("pages should link the stylesheet")
+	}
+
+	if _, err := service.CodeCSS("github", "no-such-theme"); err == nil {
+		t.Error("an unknown theme should be an error")
+	}
+}
@@ -0,0 +1,63 @@
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/logging"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestRequestIDHeader(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	generated := app.Get("/healthz").Header.Get("X-Request-ID")
+	if generated == "" {
+		t.Fatal("expected a generated X-Request-ID header")
+	}
+
+	resp := app.Do("GET", "/healthz", nil, map[string]string{"X-Request-ID": "edge-1234.abc"})
+	if got := resp.Header.Get("X-Request-ID"); got != "edge-1234.abc" {
+		t.Errorf("expected the incoming request ID to be echoed, got %q", got)
+	}
+
+	resp = app.Do("GET", "/healthz", nil, map[string]string{"X-Request-ID": "bad id\" <script>"})
+	if got := resp.Header.Get("X-Request-ID"); got == "" || strings.ContainsAny(got, " \"<") {
+		t.Errorf("expected an invalid request ID to be replaced, got %q", got)
+	}
+}
+
+func TestRequestIDReachesServiceLogs(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, "json", "debug")))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	app := testutil.NewTestApp(t)
+	if err := os.RemoveAll(app.Cfg.UploadDir); err != nil {
+		t.Fatalf("remove uploads: %v", err)
+	}
+
+	resp := app.Do("GET", "/readyz", nil, map[string]string{"X-Request-ID": "trace-readyz"})
+	if resp.StatusCode != 503 {
+		t.Fatalf("expected 503 without an upload dir, got %d", resp.StatusCode)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			continue
+		}
+		if rec["msg"] == "readyz check failed" {
+			if rec["request_id"] != "trace-readyz" {
+				t.Errorf("expected request_id trace-readyz, got %v", rec["request_id"])
+			}
+			return
+		}
+	}
+	t.Errorf("readyz failure was not logged; output:\n%s", buf.String())
+}
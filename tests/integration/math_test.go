@@ -0,0 +1,161 @@
+package integration_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/mathml"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestMathRendering(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	md := "Euler: $e^{i\\pi} + 1 = 0$. It costs $5 and $10, or \\$3. Inline display $$\\sum_i x_i$$ too.\n\n" +
+		"$$\n\\begin{pmatrix} a & b \\\\ c & d \\end{pmatrix}\n$$\n\n" +
+		"`$not math$` and $\\frac{1}{\\nope}$\n\n" +
+		`<math onclick="x()"><mi style="color:red" mathvariant="bold">z</mi></math>` + "\n"
+	p, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Math", ContentMD: md})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	html := p.ContentHTML
+
+	for _, want := range []string{
+		`Euler: <math><semantics><mrow><msup><mi>e</mi><mrow><mi>i</mi><mi>π</mi></mrow></msup><mo>+</mo><mn>1</mn>`,
+		`<annotation encoding="application/x-tex">e^{i\pi} + 1 = 0</annotation></semantics></math>.`,
+		`It costs $5 and $10, or $3.`,
+		`<math display="block"><semantics><mrow><munder><mo>∑</mo><mi>i</mi></munder>`,
+		`<div class="math-display"><math display="block"><semantics><mrow><mo fence="true" stretchy="true">(</mo><mtable><mtr><mtd><mi>a</mi></mtd>`,
+		`<code>$not math$</code>`,
+		`<mfrac><mn>1</mn><merror><mtext>\nope</mtext></merror></mfrac>`,
+		`<math><mi>z</mi></math>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered HTML is missing %s", want)
+		}
+	}
+	if strings.Contains(html, "onclick") || strings.Contains(html, "style=") || strings.Contains(html, "bold") {
+		t.Errorf("sanitizer let markup through: %s", html)
+	}
+}
+
+func TestMathDisplayUnclosed(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	for _, tc := range []struct{ md, want string }{
+		// Nothing closes the $$, so the rest of the post is left alone.
+		{"$$ is the shell PID\n\n## Next section\n\nBody\n", "<p>$$ is the shell PID</p>\n<h2 id=\"next-section\">"},
+		// A closing $$ with words after it doesn't close: nothing is dropped.
+		{"$$\nx\n$$ trailing words\n", "<p>$$<br/>\nx<br/>\n$$ trailing words</p>"},
+	} {
+		p, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Dollars", ContentMD: tc.md})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if !strings.Contains(p.ContentHTML, tc.want) || strings.Contains(p.ContentHTML, "<math") {
+			t.Errorf("%q rendered as %s", tc.md, p.ContentHTML)
+		}
+	}
+}
+
+func TestMathML(t *testing.T) {
+	for _, tc := range []struct{ tex, want string }{
+		{`x_i^2`, `<msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup>`},
+		{`\sqrt[3]{x}`, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+		{`\mathbb{R}^n`, `<msup><mi>ℝ</mi><mi>n</mi></msup>`},
+		{`\mathrm{d}x`, `<mi mathvariant="normal">d</mi><mi>x</mi>`},
+		{`f'(x)`, `<msup><mi>f</mi><mo>′</mo></msup>`},
+		{`\hat{x}`, `<mover accent="true"><mi>x</mi><mo>^</mo></mover>`},
+		{`\Gamma`, `<mi mathvariant="normal">Γ</mi>`},
+		{`\text{if } x<0`, `<mtext>if </mtext><mi>x</mi><mo>&lt;</mo><mn>0</mn>`},
+		{`\left( x \right.`, `<mrow><mo fence="true" stretchy="true">(</mo><mi>x</mi></mrow>`},
+		{`\begin{cases} 1 & x > 0 \\ 0 & \text{otherwise} \end{cases}`, `<mtable columnalign="left left"><mtr><mtd><mn>1</mn></mtd>`},
+	} {
+		if got := mathml.Convert(tc.tex, false); !strings.Contains(got, tc.want) {
+			t.Errorf("%s:\n got %s\nwant %s", tc.tex, got, tc.want)
+		}
+	}
+	// Limits go under and over only in display math.
+	if got := mathml.Convert(`\lim_{n\to\infty}`, false); !strings.Contains(got, "<msub><mi>lim</mi>") {
+		t.Errorf("inline limit: %s", got)
+	}
+	if got := mathml.Convert(`\lim_{n\to\infty}`, true); !strings.Contains(got, "<munder><mi>lim</mi>") {
+		t.Errorf("display limit: %s", got)
+	}
+}
+
+func TestMathMLDeepNesting(t *testing.T) {
+	for _, tex := range []string{
+		strings.Repeat(`\left(`, 50000),
+		strings.Repeat(`\frac{`, 50000),
+		strings.Repeat(`\sqrt[`, 50000),
+		strings.Repeat(`\begin{matrix}`, 50000),
+		strings.Repeat("{", 50000) + "x",
+		strings.Repeat("x^", 50000),
+	} {
+		start := time.Now()
+		got := mathml.Convert(tex, true)
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%.8s…: took %v", tex, d)
+		}
+		if !strings.Contains(got, "<merror>") {
+			t.Errorf("%.8s…: nesting past the limit should be shown as an error", tex)
+		}
+	}
+	// Nesting within the limit renders as usual.
+	if got := mathml.Convert(strings.Repeat("{", 60)+"x"+strings.Repeat("}", 60), false); strings.Contains(got, "<merror>") {
+		t.Errorf("60 nested groups: %s", got)
+	}
+}
+
+func TestMermaidDiagrams(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	md := "```mermaid\ngraph TD; A[\"<b>Start</b>\"] -->|go| B{Ok?}\nB -- no --> A\nB ==> C((Done))\nclassDef x fill:red\n```\n\n" +
+		"```mermaid\nsequenceDiagram\nautonumber\nparticipant U as User\nU->>S: Request\nalt cached\nS-->>U: Hit\nelse\nS-xU: Miss\nend\nNote over U,S: Done\n```\n\n" +
+		"```mermaid\npie title Pets\n\"Dogs\" : 3\n```\n"
+	p := publishTestPost(t, app, service.PostInput{Title: "Diagram", ContentMD: md})
+	html := p.ContentHTML
+
+	for _, want := range []string{
+		`<div class="diagram"><svg class="diagram" viewbox="-8 -8 `,
+		`role="img" aria-label="Flowchart">`,
+		`<rect class="node node-rect" x=`,
+		`<tspan x="`,
+		`&lt;b&gt;Start&lt;/b&gt;</tspan>`,
+		`<polygon class="node node-diamond" points=`,
+		`<circle class="node node-circle" cx=`,
+		`<polyline class="edge edge-thick" points=`,
+		`<rect class="edge-label" x=`,
+		`>go</tspan>`,
+		`aria-label="Sequence diagram">`,
+		`>1. Request</tspan>`,
+		`<polyline class="message dashed" points=`,
+		`stroke-dasharray="4 3"`,
+		`>[cached]</tspan>`,
+		`>User</tspan>`,
+		`>Done</tspan>`,
+		// A diagram type the renderer doesn't draw is shown as code.
+		`<pre class="chroma"><code>`,
+		`pie title Pets`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered HTML is missing %s", want)
+		}
+	}
+	if strings.Contains(html, "<b>") || strings.Contains(html, "fill:red") {
+		t.Errorf("diagram let markup through: %s", html)
+	}
+	if body := readBody(t, app.Get("/posts/"+p.Slug)); strings.Contains(body, "mermaid") {
+		t.Error("the post page should need no Mermaid script")
+	}
+
+	// SVG in raw HTML only keeps what the diagrams use.
+	raw := `<svg class="diagram" onload="x()"><rect class="evil" x="1" style="fill:red"></rect><script>x()</script></svg>`
+	p = publishTestPost(t, app, service.PostInput{Title: "Raw SVG", ContentMD: raw + "\n"})
+	for _, s := range []string{"onload", "evil", "style", "script"} {
+		if strings.Contains(p.ContentHTML, s) {
+			t.Errorf("sanitizer let %s through: %s", s, p.ContentHTML)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	app := testutil.NewTestApp(t)
+
+	if resp := app.Get("/healthz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp := app.Get("/readyz")
+	var body struct {
+		Status string
+		Checks map[string]string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode /readyz: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Status != "ok" {
+		t.Errorf("/readyz: expected 200 ok, got %d %+v", resp.StatusCode, body)
+	}
+	for _, check := range []string{"database", "migrations", "uploads"} {
+		if body.Checks[check] != "ok" {
+			t.Errorf("check %s: expected ok, got %q", check, body.Checks[check])
+		}
+	}
+
+	if _, err := app.DB.Write.Exec(`DELETE FROM schema_migrations WHERE version = '001_create_posts.sql'`); err != nil {
+		t.Fatalf("delete migration row: %v", err)
+	}
+	resp = app.Get("/readyz")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("/readyz with a pending migration: expected 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadinessFailsWhenUploadsAreReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	app := testutil.NewTestApp(t)
+	if err := os.Chmod(app.Cfg.UploadDir, 0o500); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(app.Cfg.UploadDir, 0o700) })
+
+	if resp := app.Get("/readyz"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a read-only upload dir, got %d", resp.StatusCode)
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	app.Get("/healthz")
+	app.Get("/no-such-page")
+
+	if resp := app.Get("/metrics"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("/metrics without token: expected 403, got %d", resp.StatusCode)
+	}
+	if resp := app.Do("GET", "/metrics", nil, map[string]string{"Authorization": "Bearer wrong"}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("/metrics with wrong token: expected 403, got %d", resp.StatusCode)
+	}
+
+	resp := app.Do("GET", "/metrics", nil, map[string]string{"Authorization": "Bearer test-metrics-token"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics: expected 200, got %d", resp.StatusCode)
+	}
+	assertHeaderContains(t, resp.Header, "Content-Type", "text/plain; version=0.0.4")
+	b, _ := io.ReadAll(resp.Body)
+	body := string(b)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/healthz",status="200"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",route="/healthz",status="200",le="+Inf"} 1`,
+		`analytics_queue_capacity 256`,
+		`analytics_events_total{result="dropped"} 0`,
+		`sql_db_max_open_connections{pool="write"} 1`,
+		`rate_limit_rejections_total 0`,
+		`# TYPE http_request_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics should contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package integration_test
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+var (
+	relNextRe   = regexp.MustCompile(`<link rel="next" href="([^"]+)">`)
+	relPrevRe   = regexp.MustCompile(`<link rel="prev" href="([^"]+)">`)
+	pagerNextRe = regexp.MustCompile(`<a href="([^"]+)" rel="next"`)
+	pagerPrevRe = regexp.MustCompile(`<a href="([^"]+)" rel="prev"`)
+	timelineRe  = regexp.MustCompile(`<h3 class="timeline-title">\s*<a href="[^"]+">([^<]+)</a>`)
+	studioRowRe = regexp.MustCompile(`<td class="td-title">\s*<a href="[^"]+">([^<]+)</a>`)
+)
+
+// seedPublished publishes n posts titled "Post 01" and on, each published a
+// day after the one before. Posts 05 and 06 share a timestamp, so the ID
+// has to break the tie.
+func seedPublished(t *testing.T, app *testutil.TestApp, n int, category string) {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i := 1; i <= n; i++ {
+		p := publishTestPost(t, app, service.PostInput{Title: fmt.Sprintf("Post %02d", i), Category: category})
+		day := i
+		if i == 6 {
+			day = 5
+		}
+		app.DB.Write.Exec(`UPDATE posts SET published_at = ? WHERE id = ?`,
+			start.AddDate(0, 0, day).Format(time.RFC3339), p.ID)
+	}
+}
+
+func match(re *regexp.Regexp, body string) string {
+	if m := re.FindStringSubmatch(body); m != nil {
+		return html.UnescapeString(m[1])
+	}
+	return ""
+}
+
+func matchAll(re *regexp.Regexp, body string) []string {
+	var out []string
+	for _, m := range re.FindAllStringSubmatch(body, -1) {
+		out = append(out, m[1])
+	}
+	return out
+}
+
+func TestPublicListsArePaged(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	seedPublished(t, app, 23, "Go")
+
+	// Follow rel=next from the first page to the last.
+	var pages [][]string
+	var bodies []string
+	for url := "/timeline"; url != ""; {
+		resp := app.Get(url)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %d", url, resp.StatusCode)
+		}
+		body := readBody(t, resp)
+		pages = append(pages, matchAll(timelineRe, body))
+		bodies = append(bodies, body)
+		if match(relNextRe, body) != match(pagerNextRe, body) || match(relPrevRe, body) != match(pagerPrevRe, body) {
+			t.Errorf("%s: <link rel> tags and the page links differ", url)
+		}
+		url = match(relNextRe, body)
+		if len(pages) > 5 {
+			t.Fatal("pagination doesn't end")
+		}
+	}
+	if len(pages) != 3 || len(pages[0]) != 10 || len(pages[1]) != 10 || len(pages[2]) != 3 {
+		t.Fatalf("expected pages of 10, 10 and 3 posts, got %v", pages)
+	}
+	var want []string
+	for i := 23; i >= 1; i-- {
+		want = append(want, fmt.Sprintf("Post %02d", i))
+	}
+	// The tie is broken by ID, newest first.
+	if got := slices.Concat(pages...); !slices.Equal(got, want) {
+		t.Errorf("posts out of order:\n got %v\nwant %v", got, want)
+	}
+	if match(relPrevRe, bodies[0]) != "" || match(relNextRe, bodies[2]) != "" {
+		t.Error("the first and last pages should have no prev and next links")
+	}
+
+	// rel=prev leads back to the same pages.
+	back := readBody(t, app.Get(match(relPrevRe, bodies[2])))
+	if got := matchAll(timelineRe, back); !slices.Equal(got, pages[1]) {
+		t.Errorf("prev of the last page: got %v, want %v", got, pages[1])
+	}
+	first := readBody(t, app.Get(match(relPrevRe, back)))
+	if got := matchAll(timelineRe, first); !slices.Equal(got, pages[0]) || match(relPrevRe, first) != "" {
+		t.Errorf("prev of the second page: got %v, want %v", got, pages[0])
+	}
+
+	// A post published meanwhile doesn't shift later pages.
+	second := match(relNextRe, bodies[0])
+	publishTestPost(t, app, service.PostInput{Title: "Breaking news", Category: "Go"})
+	if got := matchAll(timelineRe, readBody(t, app.Get(second))); !slices.Equal(got, pages[1]) {
+		t.Errorf("page 2 changed after publishing: got %v", got)
+	}
+
+	// Category pages are paged the same way.
+	cat := readBody(t, app.Get("/categories/Go"))
+	if next := match(pagerNextRe, cat); !strings.HasPrefix(next, "/categories/Go?after=") {
+		t.Errorf("category page: next link %q", next)
+	}
+
+	// The home page features the newest post on the first page only.
+	home := readBody(t, app.Get("/"))
+	if !strings.Contains(home, `class="hero"`) || strings.Contains(readBody(t, app.Get(match(relNextRe, home))), `class="hero"`) {
+		t.Error("only the first home page should have the featured post")
+	}
+
+	if resp := app.Get("/timeline?after=not-a-cursor!"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid cursor: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestStudioPostListFiltersAndSorts(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	headers := map[string]string{"Cookie": "session_id=" + cookie.Value}
+	list := func(url string) string {
+		t.Helper()
+		resp := app.Do("GET", url, nil, headers)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %d", url, resp.StatusCode)
+		}
+		return readBody(t, resp)
+	}
+
+	seedPublished(t, app, 3, "")
+	for _, title := range []string{"banana draft", "Apple draft", "cherry draft"} {
+		app.PostSvc.Create(t.Context(), service.PostInput{Title: title})
+	}
+
+	if got := matchAll(studioRowRe, list("/studio/posts?status=draft")); !slices.Equal(got, []string{"cherry draft", "Apple draft", "banana draft"}) {
+		t.Errorf("drafts, newest first: got %v", got)
+	}
+	if got := matchAll(studioRowRe, list("/studio/posts?status=draft&sort=title")); !slices.Equal(got, []string{"Apple draft", "banana draft", "cherry draft"}) {
+		t.Errorf("drafts by title: got %v", got)
+	}
+	if got := matchAll(studioRowRe, list("/studio/posts?status=published&sort=published")); !slices.Equal(got, []string{"Post 03", "Post 02", "Post 01"}) {
+		t.Errorf("published: got %v", got)
+	}
+	body := list("/studio/posts?status=draft&sort=title")
+	if !strings.Contains(body, `<option value="title" selected>`) || !strings.Contains(body, `<option value="draft" selected>`) {
+		t.Error("the form should show the filter in use")
+	}
+
+	// Pages keep the filter and order.
+	for i := 0; i < 30; i++ {
+		app.PostSvc.Create(t.Context(), service.PostInput{Title: fmt.Sprintf("Draft %02d", i)})
+	}
+	body = list("/studio/posts?status=draft&sort=title")
+	next := match(pagerNextRe, body)
+	if !strings.Contains(next, "status=draft") || !strings.Contains(next, "sort=title") {
+		t.Fatalf("next link drops the filter: %q", next)
+	}
+	firstPage := matchAll(studioRowRe, body)
+	secondPage := matchAll(studioRowRe, list(next))
+	if len(firstPage) != 25 || len(secondPage) != 8 {
+		t.Errorf("expected 25 and 8 drafts, got %d and %d", len(firstPage), len(secondPage))
+	}
+	// Titles sort without regard to case.
+	if !slices.Equal(firstPage[:4], []string{"Apple draft", "banana draft", "cherry draft", "Draft 00"}) || secondPage[len(secondPage)-1] != "Draft 29" {
+		t.Errorf("pages out of order: %v … %v", firstPage[:4], secondPage)
+	}
+
+	// A cursor past the last post.
+	if !strings.Contains(list("/studio/posts?status=published&after="+service.EncodeCursor(&model.PostCursor{})), "No posts match") {
+		t.Error("an empty filtered page should offer to show all posts")
+	}
+}
@@ -13,7 +13,7 @@ import (
 func TestCreateAndReadPost(t *testing.T) {
 	app := testutil.NewTestApp(t)
 
-	post, err := app.PostSvc.Create(service.PostInput{
+	post, err := app.PostSvc.Create(t.Context(), service.PostInput{
 		Title:     "Hello World",
 		Excerpt:   "My first post",
 		ContentMD: "## Introduction\n\nHello, world!",
@@ -37,7 +37,7 @@ func TestCreateAndReadPost(t *testing.T) {
 func TestPublishPost(t *testing.T) {
 	app := testutil.NewTestApp(t)
 
-	post, _ := app.PostSvc.Create(service.PostInput{Title: "Publish Me", ContentMD: "body"})
+	post, _ := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Publish Me", ContentMD: "body"})
 
 	// Not visible on public site before publishing
 	resp := app.Get("/posts/" + post.Slug)
@@ -46,13 +46,13 @@ func TestPublishPost(t *testing.T) {
 	}
 
 	// Publish
-	if err := app.PostSvc.Publish(post.ID); err != nil {
+	if err := app.PostSvc.Publish(t.Context(), post.ID); err != nil {
 		t.Fatalf("Publish: %v", err)
 	}
 
 	// Should be visible now — but templates may fail without full template dir
 	// so just check service state
-	updated, err := app.PostSvc.GetByID(post.ID)
+	updated, err := app.PostSvc.GetByID(t.Context(), post.ID)
 	if err != nil {
 		t.Fatalf("GetByID: %v", err)
 	}
@@ -67,8 +67,8 @@ func TestPublishPost(t *testing.T) {
 func TestUpdatePost(t *testing.T) {
 	app := testutil.NewTestApp(t)
 
-	post, _ := app.PostSvc.Create(service.PostInput{Title: "Original", ContentMD: "old"})
-	updated, err := app.PostSvc.Update(post.ID, service.PostInput{
+	post, _ := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Original", ContentMD: "old"})
+	updated, err := app.PostSvc.Update(t.Context(), post.ID, service.PostInput{
 		Title:     "Updated Title",
 		ContentMD: "new content",
 	})
@@ -83,11 +83,11 @@ func TestUpdatePost(t *testing.T) {
 func TestDeletePost(t *testing.T) {
 	app := testutil.NewTestApp(t)
 
-	post, _ := app.PostSvc.Create(service.PostInput{Title: "To Delete", ContentMD: "bye"})
-	if err := app.PostSvc.Delete(post.ID); err != nil {
+	post, _ := app.PostSvc.Create(t.Context(), service.PostInput{Title: "To Delete", ContentMD: "bye"})
+	if err := app.PostSvc.Delete(t.Context(), post.ID); err != nil {
 		t.Fatalf("Delete: %v", err)
 	}
-	_, err := app.PostSvc.GetByID(post.ID)
+	_, err := app.PostSvc.GetByID(t.Context(), post.ID)
 	if err == nil {
 		t.Error("expected ErrNotFound after deletion")
 	}
@@ -96,8 +96,8 @@ func TestDeletePost(t *testing.T) {
 func TestSlugUniqueness(t *testing.T) {
 	app := testutil.NewTestApp(t)
 
-	p1, _ := app.PostSvc.Create(service.PostInput{Title: "Same Title", ContentMD: "a"})
-	p2, _ := app.PostSvc.Create(service.PostInput{Title: "Same Title", ContentMD: "b"})
+	p1, _ := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Same Title", ContentMD: "a"})
+	p2, _ := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Same Title", ContentMD: "b"})
 
 	if p1.Slug == p2.Slug {
 		t.Errorf("duplicate slugs: both got %q", p1.Slug)
@@ -0,0 +1,115 @@
+package integration_test
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+var relatedRe = regexp.MustCompile(`<h3 class="post-card-title">\s*<a href="/posts/[^"]+">([^<]+)</a>`)
+
+// related returns the titles of the "Read next" section of a post page.
+func related(t *testing.T, app *testutil.TestApp, slug string) []string {
+	t.Helper()
+	body := readBody(t, app.Get("/posts/"+slug))
+	_, section, _ := strings.Cut(body, `<aside class="related-posts">`)
+	return matchAll(relatedRe, section)
+}
+
+func TestWordCountAndReadingTime(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	ctx := t.Context()
+
+	// Markup, link targets, image descriptions and raw HTML aren't read.
+	md := "# Two words\n\nSome **bold** [link text](https://example.com/a/very/long/url) here.\n\n" +
+		"<div>raw html block</div>\n\n![an image description](/uploads/a.png)\n\n" +
+		"```go\nfunc main() {}\n```\n\n- item\n- ---\n"
+	p, err := app.PostSvc.Create(ctx, service.PostInput{Title: "Counting", ContentMD: md})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if p.WordCount != 10 || p.ReadingMinutes != 1 {
+		t.Errorf("expected 10 words and 1 minute, got %d and %d", p.WordCount, p.ReadingMinutes)
+	}
+
+	long := strings.Repeat("word ", 450)
+	p, _ = app.PostSvc.Update(ctx, p.ID, service.PostInput{Title: "Counting", ContentMD: long})
+	if p.WordCount != 450 || p.ReadingMinutes != 3 {
+		t.Errorf("after editing: expected 450 words and 3 minutes, got %d and %d", p.WordCount, p.ReadingMinutes)
+	}
+	app.PostSvc.Publish(ctx, p.ID)
+	if !strings.Contains(readBody(t, app.Get("/posts/"+p.Slug)), `<span class="reading-time">3 min read</span>`) {
+		t.Error("post page should show the reading time")
+	}
+	if !strings.Contains(readBody(t, app.Get("/timeline")), `<span class="reading-time">3 min read</span>`) {
+		t.Error("timeline should show the reading time")
+	}
+
+	// Posts saved before counts were kept are counted at startup.
+	app.DB.Write.Exec(`UPDATE posts SET word_count = 0, reading_minutes = 0, render_version = 0`)
+	if n, err := app.PostSvc.RenderStale(ctx); err != nil || n != 1 {
+		t.Fatalf("RenderStale: %d, %v", n, err)
+	}
+	if p, _ = app.PostSvc.GetByID(ctx, p.ID); p.WordCount != 450 || p.ReadingMinutes != 3 {
+		t.Errorf("after backfill: got %d words and %d minutes", p.WordCount, p.ReadingMinutes)
+	}
+	if n, _ := app.PostSvc.RenderStale(ctx); n != 0 {
+		t.Errorf("counted posts should not be counted again, got %d", n)
+	}
+}
+
+func TestRelatedPosts(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	ctx := t.Context()
+	base := publishTestPost(t, app, service.PostInput{
+		Title:     "Goroutines and channels",
+		ContentMD: "Goroutines talk over channels. A buffered channel decouples the sender from the receiver.",
+		Category:  "Go",
+		Tags:      "go, concurrency",
+	})
+	tagged := publishTestPost(t, app, service.PostInput{
+		Title:     "Worker pools",
+		ContentMD: "Bounding parallel work with a fixed number of workers.",
+		Category:  "Rust",
+		Tags:      "Concurrency",
+	})
+	publishTestPost(t, app, service.PostInput{
+		Title:     "Modules explained",
+		ContentMD: "Versioning dependencies with go.mod files.",
+		Category:  "Go",
+	})
+	publishTestPost(t, app, service.PostInput{
+		Title:     "Select statements",
+		ContentMD: "Waiting on several channels at once, with goroutines blocked until one is ready.",
+	})
+	publishTestPost(t, app, service.PostInput{
+		Title:     "Sourdough starter",
+		ContentMD: "Feed the starter flour and water daily until it doubles.",
+		Category:  "Baking",
+	})
+	app.PostSvc.Create(ctx, service.PostInput{Title: "Channel draft", ContentMD: "Goroutines and channels, unfinished.", Category: "Go", Tags: "go"})
+
+	got := related(t, app, base.Slug)
+	if len(got) != 3 || got[0] != "Worker pools" {
+		t.Fatalf("expected the tagged post first and three posts, got %v", got)
+	}
+	if !slices.Contains(got, "Modules explained") || !slices.Contains(got, "Select statements") {
+		t.Errorf("posts sharing the category or terms should be related, got %v", got)
+	}
+	if slices.Contains(got, "Sourdough starter") || slices.Contains(got, "Channel draft") {
+		t.Errorf("unrelated posts and drafts should not be listed, got %v", got)
+	}
+	if got := related(t, app, "sourdough-starter"); len(got) != 0 {
+		t.Errorf("a post with nothing in common should have no related posts, got %v", got)
+	}
+
+	// Unpublishing drops the post from the other posts' pages.
+	app.PostSvc.Unpublish(ctx, tagged.ID)
+	if got := related(t, app, base.Slug); slices.Contains(got, "Worker pools") || len(got) != 2 {
+		t.Errorf("after unpublishing: %v", got)
+	}
+}
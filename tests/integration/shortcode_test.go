@@ -0,0 +1,111 @@
+package integration_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mhtecdev/blog-ai/internal/config"
+	"github.com/mhtecdev/blog-ai/internal/middleware"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func TestShortcodes(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	md := "Intro\n{{< figure src=\"/static/uploads/chart.png\" alt=\"Loss curve\" caption=\"Training <loss>\" >}}\n\n" +
+		"{{< video /static/uploads/demo.mp4 caption=\"The demo\" >}}\n\n" +
+		"{{< audio src=\"/static/uploads/talk.mp3\" >}}\n\n" +
+		"{{< youtube dQw4w9WgXcQ start=42 title=\"A talk\" >}}\n\n" +
+		"{{< gist octocat/6cad326836d38bd3a7ae >}}\n\n" +
+		"{{< github golang/go description=\"The Go programming language\" >}}\n\n" +
+		"{{< callout warning title=\"Heads up\" >}}\nSome **bold** text.\n\n- item\n{{< /callout >}}\n\n" +
+		"{{< callout >}}\nA note.\n{{< /callout >}}\n"
+	p, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Embeds", ContentMD: md})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	html := p.ContentHTML
+
+	for _, want := range []string{
+		`<p>Intro</p>` + "\n" + `<figure class="embed embed-figure"><img src="/static/uploads/chart.png" alt="Loss curve" loading="lazy"><figcaption>Training &lt;loss&gt;</figcaption></figure>`,
+		`<figure class="embed embed-video"><video controls="" preload="metadata" src="/static/uploads/demo.mp4"></video><figcaption>The demo</figcaption></figure>`,
+		`<figure class="embed embed-audio"><audio controls="" preload="metadata" src="/static/uploads/talk.mp3"></audio></figure>`,
+		`<div class="embed-frame"><iframe src="https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?start=42" title="A talk" loading="lazy"`,
+		`<a class="embed-card embed-gist" href="https://gist.github.com/octocat/6cad326836d38bd3a7ae" rel="nofollow"><span class="embed-card-kind">Gist</span>`,
+		`<span class="embed-card-title">golang/go</span><span class="embed-card-text">The Go programming language</span><span class="embed-card-url">github.com/golang/go</span></a>`,
+		`<aside class="callout callout-warning">` + "\n" + `<p class="callout-title">Heads up</p>` + "\n" + `<p>Some <strong>bold</strong> text.</p>` + "\n<ul>",
+		`<aside class="callout callout-note">` + "\n" + `<p class="callout-title">Note</p>` + "\n<p>A note.</p>\n</aside>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered HTML is missing %s", want)
+		}
+	}
+	if strings.Contains(html, "{{") {
+		t.Errorf("shortcodes left as text: %s", html)
+	}
+}
+
+func TestShortcodesNested(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	md := "{{< callout >}}\nOuter.\n\n{{< callout tip >}}\nInner.\n{{< /callout >}}\n\nOuter again.\n{{< /callout >}}\n\nAfter.\n"
+	p, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Nested", ContentMD: md})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	want := `<aside class="callout callout-note">` + "\n" + `<p class="callout-title">Note</p>` + "\n<p>Outer.</p>\n" +
+		`<aside class="callout callout-tip">` + "\n" + `<p class="callout-title">Tip</p>` + "\n<p>Inner.</p>\n</aside>\n" +
+		"<p>Outer again.</p>\n</aside>\n<p>After.</p>"
+	if !strings.Contains(p.ContentHTML, want) || strings.Contains(p.ContentHTML, "{{") {
+		t.Errorf("nested callouts rendered as %s", p.ContentHTML)
+	}
+}
+
+func TestShortcodesInvalid(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	// Each is left as text for the author to fix.
+	for _, md := range []string{
+		`{{< youtube not-an-id >}}`,
+		`{{< figure src="https://example.com/a.png" >}}`,
+		`{{< video src="//example.com/a.mp4" >}}`,
+		`{{< gist "octocat/x y" >}}`,
+		`{{< callout shouting >}}`,
+		`{{< github golang/go extra >}}`,
+		`{{< iframe src="https://example.com" >}}`,
+	} {
+		p, err := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Invalid", ContentMD: md + "\n"})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if !strings.HasPrefix(p.ContentHTML, "<p>{{&lt;") || strings.Contains(p.ContentHTML, "embed") {
+			t.Errorf("%s: %s", md, p.ContentHTML)
+		}
+	}
+
+	// Raw HTML can't pass itself off as an embed.
+	raw := `<iframe src="https://example.com/embed/dQw4w9WgXcQ"></iframe>` +
+		`<iframe src="https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ" sandbox="allow-top-navigation" onload="x()"></iframe>` +
+		`<aside class="callout evil">x</aside>`
+	p, _ := app.PostSvc.Create(t.Context(), service.PostInput{Title: "Raw", ContentMD: raw + "\n"})
+	for _, s := range []string{"example.com", "allow-top-navigation", "onload", "evil"} {
+		if strings.Contains(p.ContentHTML, s) {
+			t.Errorf("sanitizer let %s through: %s", s, p.ContentHTML)
+		}
+	}
+}
+
+func TestShortcodeFramesAllowedByCSP(t *testing.T) {
+	for _, mode := range []string{"strict", "lenient"} {
+		app := fiber.New()
+		app.Use(middleware.SecurityHeaders(&config.Config{CSPMode: mode}))
+		app.Get("/", func(c *fiber.Ctx) error { return nil })
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "frame-src https://www.youtube-nocookie.com;") {
+			t.Errorf("%s CSP should allow YouTube privacy-mode frames: %s", mode, csp)
+		}
+	}
+}
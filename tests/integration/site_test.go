@@ -0,0 +1,260 @@
+package integration_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/internal/site"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestFeedsAndSitemap(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	ml := publishTestPost(t, app, service.PostInput{Title: "Attention is all you need", Category: "Machine Learning"})
+	goPost := publishTestPost(t, app, service.PostInput{Title: "Generics in practice", Category: "Go"})
+	app.PostSvc.Create(t.Context(), service.PostInput{Title: "Secret draft", Category: "Go"})
+
+	resp := app.Get("/feed.xml")
+	feed := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("feed: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		"<id>https://blog.example.com/posts/" + ml.Slug + "</id>",
+		"<id>https://blog.example.com/posts/" + goPost.Slug + "</id>",
+		`<category term="Machine Learning"></category>`,
+		"&lt;p&gt;Body of Generics in practice&lt;/p&gt;",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed is missing %s", want)
+		}
+	}
+	if strings.Contains(feed, "Secret draft") {
+		t.Error("drafts must not be in the feed")
+	}
+
+	// Categories with spaces are linked escaped.
+	resp = app.Get("/categories/Machine%20Learning/feed.xml")
+	catFeed := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(catFeed, ml.Slug) || strings.Contains(catFeed, goPost.Slug) {
+		t.Errorf("category feed: %d", resp.StatusCode)
+	}
+	if page := readBody(t, app.Get("/categories/Machine%20Learning")); !strings.Contains(page, ml.Title) {
+		t.Error("category page should list its posts")
+	}
+	if resp := app.Get("/categories/Nothing/feed.xml"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("feed of an empty category: expected 404, got %d", resp.StatusCode)
+	}
+
+	sitemap := readBody(t, app.Get("/sitemap.xml"))
+	for _, want := range []string{
+		"<loc>https://blog.example.com/</loc>",
+		"<loc>https://blog.example.com/categories/Machine%20Learning</loc>",
+		"<loc>https://blog.example.com/posts/" + goPost.Slug + "</loc>",
+		"<lastmod>" + goPost.UpdatedAt.UTC().Format("2006-01-02") + "</lastmod>",
+	} {
+		if !strings.Contains(sitemap, want) {
+			t.Errorf("sitemap is missing %s", want)
+		}
+	}
+}
+
+func newBuilder(t *testing.T, app *testutil.TestApp) *site.Builder {
+	t.Helper()
+	return site.NewBuilder(app.PostSvc, app.Views, app.Cfg, "../../web/static", filepath.Join(t.TempDir(), "site"))
+}
+
+func TestStaticBuild(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	post := publishTestPost(t, app, service.PostInput{Title: "Hello static world", Category: "Machine Learning"})
+	app.PostSvc.Create(t.Context(), service.PostInput{Title: "Unfinished draft"})
+	os.WriteFile(filepath.Join(app.Cfg.UploadDir, "photo.jpg"), []byte("jpeg"), 0o644)
+
+	b := newBuilder(t, app)
+	res, err := b.Build(t.Context())
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	// home, categories, timeline, about, feed, sitemap, one category and its
+	// feed, the archive year and month, one post, the code stylesheet
+	if res.Pages != 12 {
+		t.Errorf("expected 12 pages, got %d", res.Pages)
+	}
+
+	dir := b.Dir()
+	archive := strings.TrimPrefix(model.ArchiveMonthPath(post.PublishedAt.Year(), post.PublishedAt.Month()), "/")
+	for _, f := range []string{
+		archive + "/index.html", filepath.Dir(archive) + "/index.html",
+		"index.html", "timeline/index.html", "about/index.html", "categories/index.html",
+		"categories/Machine Learning/index.html", "categories/Machine Learning/feed.xml",
+		"feed.xml", "sitemap.xml", "404.html", "code.css",
+		"static/css/public.css", "static/uploads/photo.jpg",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("missing %s: %v", f, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts/unfinished-draft")); !os.IsNotExist(err) {
+		t.Error("drafts must not be built")
+	}
+	if !strings.Contains(readFile(t, filepath.Join(dir, "404.html")), "404") {
+		t.Error("404.html should be the error page")
+	}
+
+	// A post page is what the server sends a reader who isn't counted.
+	built := readFile(t, filepath.Join(dir, "posts", post.Slug, "index.html"))
+	resp := app.Do("GET", "/posts/"+post.Slug, nil, map[string]string{"Cookie": "session_id=" + cookie.Value})
+	if served := readBody(t, resp); built != served {
+		t.Error("built post page differs from the served one")
+	}
+	if strings.Contains(built, "data-view-token") || strings.Contains(built, "reading.js") {
+		t.Error("static pages can't report views")
+	}
+
+	// Rebuilding replaces the previous build.
+	app.PostSvc.Unpublish(t.Context(), post.ID)
+	if _, err := b.Build(t.Context()); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts", post.Slug)); !os.IsNotExist(err) {
+		t.Error("a full build should drop unpublished posts")
+	}
+}
+
+func TestStaticBuildRefusesForeignDirectory(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep me"), 0o644)
+
+	b := site.NewBuilder(app.PostSvc, app.Views, app.Cfg, "../../web/static", dir)
+	if _, err := b.Build(t.Context()); err == nil {
+		t.Fatal("expected build into a foreign directory to fail")
+	}
+	if readFile(t, filepath.Join(dir, "notes.txt")) != "keep me" {
+		t.Error("the directory must be left alone")
+	}
+}
+
+func TestStaticIncrementalUpdate(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	ctx := t.Context()
+	stable := publishTestPost(t, app, service.PostInput{Title: "Stable post", Category: "Go"})
+	moving := publishTestPost(t, app, service.PostInput{Title: "Moving post", Category: "Machine Learning"})
+
+	b := newBuilder(t, app)
+	if _, err := b.Build(ctx); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	dir := b.Dir()
+	stablePage := filepath.Join(dir, "posts", stable.Slug, "index.html")
+	old := time.Now().Add(-time.Hour)
+
+	var changes []site.Change
+	app.PostSvc.OnChange(func(before, after *model.Post) {
+		changes = append(changes, site.Change{Before: before, After: after})
+	})
+
+	// Drafts don't touch the site.
+	draft, _ := app.PostSvc.Create(ctx, service.PostInput{Title: "New post", ContentMD: "soon", Category: "Go"})
+	if res, err := b.Update(ctx, changes); err != nil || res.Pages != 0 {
+		t.Fatalf("draft update: %v %+v", err, res)
+	}
+
+	// Publishing one post and retitling another in a different category.
+	changes = nil
+	app.PostSvc.Publish(ctx, draft.ID)
+	renamed, _ := app.PostSvc.Update(ctx, moving.ID, service.PostInput{Title: "Moved post", ContentMD: "new", Category: "Go"})
+	res, err := b.Update(ctx, changes)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// the six list pages, all three posts, Go and its feed, this year and month
+	if res.Pages != 13 {
+		t.Errorf("expected 13 pages re-rendered, got %d", res.Pages)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts", draft.Slug, "index.html")); err != nil {
+		t.Error("newly published post was not built")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts", renamed.Slug, "index.html")); err != nil {
+		t.Error("renamed post was not built under its new slug")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts", moving.Slug)); !os.IsNotExist(err) {
+		t.Error("the old slug should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "categories", "Machine Learning")); !os.IsNotExist(err) {
+		t.Error("the emptied category should be removed")
+	}
+	if home := readFile(t, filepath.Join(dir, "index.html")); !strings.Contains(home, "New post") || !strings.Contains(home, "Moved post") {
+		t.Error("home page was not re-rendered")
+	}
+	if !strings.Contains(readFile(t, stablePage), "Moved post") {
+		t.Error("the other post should list the moved post as related")
+	}
+
+	// Pages that come out the same aren't rewritten.
+	os.Chtimes(stablePage, old, old)
+	if _, err := b.Update(ctx, changes); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if info, _ := os.Stat(stablePage); info.ModTime().After(old.Add(time.Second)) {
+		t.Error("unchanged pages should not be rewritten")
+	}
+
+	// Publishing and unpublishing before the update leaves nothing behind.
+	changes = nil
+	app.PostSvc.Unpublish(ctx, draft.ID)
+	app.PostSvc.Publish(ctx, draft.ID)
+	app.PostSvc.Delete(ctx, draft.ID)
+	if _, err := b.Update(ctx, changes); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts", draft.Slug)); !os.IsNotExist(err) {
+		t.Error("deleted post should be removed")
+	}
+}
+
+func TestPublisherRebuildsOnChange(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	b := newBuilder(t, app)
+	p := site.NewPublisher(b)
+	app.PostSvc.OnChange(p.Notify)
+
+	post := publishTestPost(t, app, service.PostInput{Title: "Published while running"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.Dir(), "posts", post.Slug, "index.html")); err != nil {
+		t.Errorf("the publisher should have built the post: %v", err)
+	}
+}
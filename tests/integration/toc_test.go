@@ -0,0 +1,101 @@
+package integration_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/postio"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+const longPost = "Intro.\n\n## Setting up\n\nText.\n\n### Installing *Go*\n\nText.\n\n### Setting up\n\nText.\n\n" +
+	"## Running `go test`\n\nText.\n\n##### Too deep\n\nText.\n"
+
+func TestTableOfContents(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	ctx := t.Context()
+	p := publishTestPost(t, app, service.PostInput{Title: "Long post", ContentMD: longPost})
+
+	want := model.TOC{
+		{ID: "setting-up", Text: "Setting up", Level: 2, Children: model.TOC{
+			{ID: "installing-go", Text: "Installing Go", Level: 3},
+			{ID: "setting-up-1", Text: "Setting up", Level: 3},
+		}},
+		{ID: "running-go-test", Text: "Running go test", Level: 2},
+	}
+	if got, _ := app.PostSvc.GetByID(ctx, p.ID); !reflect.DeepEqual(got.TOC, want) {
+		t.Errorf("toc:\n got %+v\nwant %+v", got.TOC, want)
+	}
+
+	body := readBody(t, app.Get("/posts/"+p.Slug))
+	for _, s := range []string{
+		`<h2 id="setting-up">Setting up<a href="#setting-up" class="heading-anchor"`,
+		`<h5 id="too-deep">Too deep<a href="#too-deep" class="heading-anchor"`,
+		`<nav class="toc" aria-label="Table of contents">`,
+		`<li><a href="#installing-go">Installing Go</a></li>`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("post page is missing %s", s)
+		}
+	}
+	if strings.Contains(body, `<a href="#too-deep">`) {
+		t.Error("headings below level 4 should stay out of the contents")
+	}
+
+	// Short posts don't get one.
+	short := publishTestPost(t, app, service.PostInput{Title: "Short post", ContentMD: "## One\n\n## Two\n"})
+	if strings.Contains(readBody(t, app.Get("/posts/"+short.Slug)), `class="toc"`) {
+		t.Error("a post with two headings should have no table of contents")
+	}
+}
+
+func TestTableOfContentsOptOut(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	p := publishTestPost(t, app, service.PostInput{Title: "Long post", ContentMD: longPost})
+
+	form := url.Values{"title": {"Long post"}, "content_md": {longPost}, "hide_toc": {"1"}}
+	resp := app.Do("POST", "/studio/posts/"+strconv.FormatInt(p.ID, 10), strings.NewReader(form.Encode()),
+		map[string]string{"Cookie": "session_id=" + cookie.Value})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("save: %d", resp.StatusCode)
+	}
+	body := readBody(t, app.Get("/posts/"+p.Slug))
+	if strings.Contains(body, `class="toc"`) || !strings.Contains(body, `class="heading-anchor"`) {
+		t.Error("hiding the contents should keep the heading anchors")
+	}
+
+	// The choice survives an export and import.
+	p, _ = app.PostSvc.GetByID(t.Context(), p.ID)
+	var buf bytes.Buffer
+	postio.WriteMarkdown(&buf, p)
+	parsed, err := postio.ParseMarkdown(buf.Bytes())
+	if err != nil || !parsed.HideTOC {
+		t.Errorf("round trip lost the choice: %v", err)
+	}
+}
+
+func TestRenderStaleAddsAnchors(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	p := publishTestPost(t, app, service.PostInput{Title: "Old post", ContentMD: longPost})
+	// As saved before tables of contents existed.
+	app.DB.Write.Exec(`UPDATE posts SET content_html = '<p>old</p>', toc = '', render_version = 0 WHERE id = ?`, p.ID)
+
+	if n, err := app.PostSvc.RenderStale(t.Context()); err != nil || n != 1 {
+		t.Fatalf("RenderStale: %d, %v", n, err)
+	}
+	got, _ := app.PostSvc.GetByID(t.Context(), p.ID)
+	if got.TOC.Len() != 4 || !strings.Contains(got.ContentHTML, `class="heading-anchor"`) {
+		t.Errorf("post not rendered again: %d headings, %s", got.TOC.Len(), got.ContentHTML)
+	}
+	if !got.UpdatedAt.Equal(p.UpdatedAt) {
+		t.Error("rendering again should not mark the post edited")
+	}
+}
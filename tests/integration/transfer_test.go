@@ -0,0 +1,439 @@
+package integration_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhtecdev/blog-ai/internal/model"
+	"github.com/mhtecdev/blog-ai/internal/postio"
+	"github.com/mhtecdev/blog-ai/internal/service"
+	"github.com/mhtecdev/blog-ai/tests/testutil"
+)
+
+// importFile posts a file to the studio importer and returns the response
+// and its body.
+func importFile(t *testing.T, app *testutil.TestApp, cookie *http.Cookie, filename string, content []byte) (*http.Response, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/studio/transfer/import", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(cookie)
+	resp, err := app.App.Test(req, -1)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := testutil.NewTestApp(t)
+	cookie := src.SeedUser(t, "admin", "password123")
+	ctx := t.Context()
+
+	os.WriteFile(filepath.Join(src.Cfg.UploadDir, "cover.jpg"), []byte("jpeg"), 0o644)
+	post, _ := src.PostSvc.Create(ctx, service.PostInput{
+		Title:      `Quotes "and" colons: a test`,
+		Excerpt:    "Short summary",
+		ContentMD:  "Hello **world**\n\n![photo](/static/uploads/cover.jpg)\n",
+		CoverImage: "/static/uploads/cover.jpg",
+		Category:   "Go",
+		Tags:       "sqlite, backup",
+	})
+	src.PostSvc.Publish(ctx, post.ID)
+	published, _ := src.PostSvc.GetByID(ctx, post.ID)
+	src.PostSvc.Create(ctx, service.PostInput{Title: "Draft only", ContentMD: "wip"})
+
+	resp := src.Do("GET", "/studio/transfer/export", nil, map[string]string{"Cookie": "session_id=" + cookie.Value})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export: expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("export: Content-Type %q", ct)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("export is not a zip: %v", err)
+	}
+	names := map[string]bool{}
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, want := range []string{"posts/" + post.Slug + ".md", "posts/draft-only.md", "media/cover.jpg"} {
+		if !names[want] {
+			t.Errorf("export is missing %s (has %v)", want, names)
+		}
+	}
+
+	dst := testutil.NewTestApp(t)
+	dstCookie := dst.SeedUser(t, "admin", "password123")
+	resp, body := importFile(t, dst, dstCookie, "export.zip", data)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(body, "Imported 2 posts and 1 media file.") {
+		t.Errorf("import summary missing from page")
+	}
+
+	got, err := dst.PostSvc.GetBySlug(ctx, post.Slug)
+	if err != nil {
+		t.Fatalf("imported post: %v", err)
+	}
+	if got.Title != published.Title || got.Excerpt != "Short summary" || got.Category != "Go" || got.Tags != "sqlite, backup" {
+		t.Errorf("metadata not preserved: %+v", got)
+	}
+	if !got.IsPublished() || got.PublishedAt == nil || !got.PublishedAt.Equal(*published.PublishedAt) {
+		t.Errorf("publication not preserved: %s %v", got.Status, got.PublishedAt)
+	}
+	if !got.CreatedAt.Equal(published.CreatedAt) {
+		t.Errorf("created_at %v, want %v", got.CreatedAt, published.CreatedAt)
+	}
+	if got.ContentMD != published.ContentMD || !strings.Contains(got.ContentHTML, "<strong>world</strong>") {
+		t.Errorf("content not preserved: %q", got.ContentHTML)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dst.Cfg.UploadDir, "cover.jpg")); string(b) != "jpeg" {
+		t.Error("media was not imported")
+	}
+	if draft, err := dst.PostSvc.GetBySlug(ctx, "draft-only"); err != nil || draft.IsPublished() {
+		t.Errorf("draft: %v %+v", err, draft)
+	}
+}
+
+func TestImportResolvesSlugCollisions(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	md := []byte("---\ntitle: Hello\nslug: hello-world\nstatus: draft\n---\nbody\n")
+
+	importFile(t, app, cookie, "hello.md", md)
+	_, body := importFile(t, app, cookie, "hello.md", md)
+	if !strings.Contains(body, "hello-world → hello-world-2") {
+		t.Error("page should list the renamed slug")
+	}
+	for _, slug := range []string{"hello-world", "hello-world-2"} {
+		if _, err := app.PostSvc.GetBySlug(t.Context(), slug); err != nil {
+			t.Errorf("%s: %v", slug, err)
+		}
+	}
+}
+
+// zipOf builds a zip holding the given files, in name order.
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, _ := zw.Create(name)
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportRenamesCollidingMedia(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	os.WriteFile(filepath.Join(app.Cfg.UploadDir, "cover.jpg"), []byte("existing"), 0o644)
+	os.WriteFile(filepath.Join(app.Cfg.UploadDir, "same.jpg"), []byte("same"), 0o644)
+
+	data := zipOf(t, map[string]string{
+		"posts/trip.md":   "---\ntitle: Trip\ncover_image: /static/uploads/cover.jpg\n---\n![a](/static/uploads/cover.jpg) ![b](/static/uploads/same.jpg)\n",
+		"media/cover.jpg": "imported",
+		"media/same.jpg":  "same",
+	})
+	_, body := importFile(t, app, cookie, "export.zip", data)
+	if !strings.Contains(body, "Imported 1 post and 1 media file.") {
+		t.Errorf("import summary missing from page")
+	}
+	if !strings.Contains(body, "media/cover.jpg → media/cover-2.jpg") {
+		t.Error("page should list the renamed media")
+	}
+	if b, _ := os.ReadFile(filepath.Join(app.Cfg.UploadDir, "cover.jpg")); string(b) != "existing" {
+		t.Errorf("existing upload was overwritten: %q", b)
+	}
+	if b, _ := os.ReadFile(filepath.Join(app.Cfg.UploadDir, "cover-2.jpg")); string(b) != "imported" {
+		t.Errorf("renamed upload holds %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(app.Cfg.UploadDir, "same-2.jpg")); err == nil {
+		t.Error("identical media should be reused, not stored again")
+	}
+
+	p, err := app.PostSvc.GetBySlug(t.Context(), "trip")
+	if err != nil {
+		t.Fatalf("imported post: %v", err)
+	}
+	if p.CoverImage != "/static/uploads/cover-2.jpg" || !strings.Contains(p.ContentMD, "](/static/uploads/cover-2.jpg)") || !strings.Contains(p.ContentMD, "](/static/uploads/same.jpg)") {
+		t.Errorf("links not rewritten: cover %q, content %q", p.CoverImage, p.ContentMD)
+	}
+}
+
+func TestImportZipRelativeMediaLinks(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	data := zipOf(t, map[string]string{
+		"blog/hello/index.md":       "---\ntitle: Hello\n---\n![pic](images/pic.png) <img src=\"../other/pic.png\">\n",
+		"blog/hello/images/pic.png": "first",
+		"blog/other/pic.png":        "second",
+	})
+	_, body := importFile(t, app, cookie, "site.zip", data)
+	if !strings.Contains(body, "blog/other/pic.png: another file in the zip has the same name") {
+		t.Error("page should report the clashing zip entry")
+	}
+	p, err := app.PostSvc.GetBySlug(t.Context(), "hello")
+	if err != nil {
+		t.Fatalf("imported post: %v", err)
+	}
+	if !strings.Contains(p.ContentMD, "![pic](/static/uploads/pic.png)") {
+		t.Errorf("relative link not rewritten: %q", p.ContentMD)
+	}
+	if !strings.Contains(p.ContentMD, `src="../other/pic.png"`) {
+		t.Errorf("link to the skipped file should be left alone: %q", p.ContentMD)
+	}
+	if b, _ := os.ReadFile(filepath.Join(app.Cfg.UploadDir, "pic.png")); string(b) != "first" {
+		t.Errorf("pic.png holds %q", b)
+	}
+}
+
+func TestImportHugoFrontMatter(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+	md := []byte(`---
+title: 'It''s Hugo'
+date: 2024-01-02
+description: >
+  A folded
+  summary
+categories:
+  - Notes
+tags: [go, "web dev"]
+draft: false
+---
+Body text.
+`)
+	importFile(t, app, cookie, "hugo.md", md)
+	p, err := app.PostSvc.GetBySlug(t.Context(), "it-s-hugo")
+	if err != nil {
+		t.Fatalf("imported post: %v", err)
+	}
+	if p.Title != "It's Hugo" || p.Excerpt != "A folded summary" || p.Category != "Notes" || p.Tags != "go, web dev" {
+		t.Errorf("unexpected metadata %+v", p)
+	}
+	if !p.IsPublished() || p.PublishedAt.Format("2006-01-02") != "2024-01-02" {
+		t.Errorf("expected published on 2024-01-02, got %s %v", p.Status, p.PublishedAt)
+	}
+}
+
+func TestParseMarkdownQuoting(t *testing.T) {
+	for _, tc := range []struct{ yaml, want string }{
+		{`title: plain # a comment`, "plain"},
+		{`title: "double \"quoted\" \u00e9\ttab # kept"`, "double \"quoted\" é\ttab # kept"},
+		{`title: 'single ''quoted'': # kept'`, "single 'quoted': # kept"},
+		{`title: "colon: inside"`, "colon: inside"},
+		{"title: |\n  first\n  second", "first\nsecond"},
+		{"title: >-\n  folded\n  line", "folded line"},
+		{`title: 2024`, "2024"},
+	} {
+		p, err := postio.ParseMarkdown([]byte("---\n" + tc.yaml + "\n---\nbody\n"))
+		if err != nil {
+			t.Errorf("%s: %v", tc.yaml, err)
+			continue
+		}
+		if p.Title != tc.want {
+			t.Errorf("%s: title %q, want %q", tc.yaml, p.Title, tc.want)
+		}
+	}
+
+	p, err := postio.ParseMarkdown([]byte("---\ntitle: Tags\ntags: [\"a, b\", 'c''d', e]\ncategories: [Notes, Go]\n---\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.Tags != "a, b, c'd, e" || p.Category != "Notes" {
+		t.Errorf("tags %q, category %q", p.Tags, p.Category)
+	}
+	if _, err := postio.ParseMarkdown([]byte("---\ntitle: \"unterminated\n---\n")); err == nil {
+		t.Error("an unterminated string should be an error")
+	}
+
+	// WriteMarkdown's quoting survives a round trip, whatever the title holds.
+	for _, title := range []string{`a "b" 'c' \d`, "tab\tnew\nline", "#hash: colon", "- dash", "\u2028 sep", "yes"} {
+		var buf bytes.Buffer
+		postio.WriteMarkdown(&buf, &model.Post{Title: title, Status: "draft"})
+		p, err := postio.ParseMarkdown(buf.Bytes())
+		if err != nil || p.Title != title {
+			t.Errorf("%q came back as %q (%v)", title, p.Title, err)
+		}
+	}
+}
+
+const wxrExport = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>My WordPress</title>
+	<item>
+		<title>Cover image</title>
+		<wp:post_id>10</wp:post_id>
+		<wp:post_type>attachment</wp:post_type>
+		<wp:status>inherit</wp:status>
+		<wp:attachment_url>https://old.example.com/wp-content/uploads/cover.jpg</wp:attachment_url>
+	</item>
+	<item>
+		<title>Hello from WordPress</title>
+		<content:encoded><![CDATA[<!-- wp:paragraph -->
+<p>First <em>paragraph</em>.</p>
+<!-- /wp:paragraph -->
+<script>alert(1)</script>]]></content:encoded>
+		<excerpt:encoded><![CDATA[The excerpt]]></excerpt:encoded>
+		<wp:post_id>11</wp:post_id>
+		<wp:post_date_gmt>2023-05-06 07:08:09</wp:post_date_gmt>
+		<wp:post_modified_gmt>2023-05-07 07:08:09</wp:post_modified_gmt>
+		<wp:post_name>hello-wordpress</wp:post_name>
+		<wp:status>publish</wp:status>
+		<wp:post_type>post</wp:post_type>
+		<category domain="category" nicename="uncategorized"><![CDATA[Uncategorized]]></category>
+		<category domain="category" nicename="travel"><![CDATA[Travel]]></category>
+		<category domain="post_tag" nicename="sun"><![CDATA[Sun]]></category>
+		<category domain="post_tag" nicename="sea"><![CDATA[Sea]]></category>
+		<wp:postmeta><wp:meta_key>_thumbnail_id</wp:meta_key><wp:meta_value>10</wp:meta_value></wp:postmeta>
+	</item>
+	<item>
+		<title>Unfinished</title>
+		<content:encoded><![CDATA[Not yet]]></content:encoded>
+		<wp:post_id>12</wp:post_id>
+		<wp:post_date_gmt>0000-00-00 00:00:00</wp:post_date_gmt>
+		<wp:post_name></wp:post_name>
+		<wp:status>draft</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>About</title>
+		<wp:post_id>13</wp:post_id>
+		<wp:status>publish</wp:status>
+		<wp:post_type>page</wp:post_type>
+	</item>
+</channel>
+</rss>`
+
+func TestImportWordPress(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+
+	resp, body := importFile(t, app, cookie, "wordpress.xml", []byte(wxrExport))
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Imported 2 posts") {
+		t.Fatalf("import: %d", resp.StatusCode)
+	}
+	if !strings.Contains(body, "1 pages, attachments or trashed items") {
+		t.Error("the page should be reported as skipped")
+	}
+
+	p, err := app.PostSvc.GetBySlug(t.Context(), "hello-wordpress")
+	if err != nil {
+		t.Fatalf("imported post: %v", err)
+	}
+	if p.Excerpt != "The excerpt" || p.Category != "Travel" || p.Tags != "Sun, Sea" {
+		t.Errorf("unexpected metadata %+v", p)
+	}
+	if p.CoverImage != "https://old.example.com/wp-content/uploads/cover.jpg" {
+		t.Errorf("featured image: %q", p.CoverImage)
+	}
+	want := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	if !p.IsPublished() || p.PublishedAt == nil || !p.PublishedAt.Equal(want) {
+		t.Errorf("publication: %s %v", p.Status, p.PublishedAt)
+	}
+	if strings.Contains(p.ContentMD, "wp:paragraph") {
+		t.Error("block editor comments should be stripped")
+	}
+	if !strings.Contains(p.ContentHTML, "<em>paragraph</em>") || strings.Contains(p.ContentHTML, "<script") {
+		t.Errorf("content should be rendered and sanitized: %q", p.ContentHTML)
+	}
+
+	draft, err := app.PostSvc.GetBySlug(t.Context(), "unfinished")
+	if err != nil || draft.IsPublished() {
+		t.Errorf("draft: %v %+v", err, draft)
+	}
+}
+
+const ghostExport = `{"db":[{"meta":{"version":"5.0.0"},"data":{
+	"posts":[
+		{"id":"p1","title":"Markdown card","slug":"markdown-card","status":"published","type":"post",
+		 "mobiledoc":"{\"version\":\"0.3.1\",\"cards\":[[\"markdown\",{\"markdown\":\"# Hi\\n\\nFrom *Ghost*\"}]],\"sections\":[[10,0]]}",
+		 "html":"<h1>Hi</h1>","custom_excerpt":"Ghost excerpt","feature_image":"https://ghost.example.com/img.png",
+		 "published_at":"2022-02-03T04:05:06.000Z","created_at":"2022-02-01T00:00:00.000Z","updated_at":"2022-02-04T00:00:00.000Z"},
+		{"id":"p2","title":"Rich text","slug":"rich-text","status":"draft","type":"post",
+		 "html":"<p>Some <strong>HTML</strong></p>","created_at":"2022-03-01T00:00:00.000Z","updated_at":"2022-03-01T00:00:00.000Z"},
+		{"id":"p3","title":"About","slug":"about","status":"published","type":"page","html":"<p>page</p>"}
+	],
+	"tags":[{"id":"t1","name":"News"},{"id":"t2","name":"Release"}],
+	"posts_tags":[{"post_id":"p1","tag_id":"t2","sort_order":1},{"post_id":"p1","tag_id":"t1","sort_order":0}]
+}}]}`
+
+func TestImportGhost(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+
+	resp, body := importFile(t, app, cookie, "ghost.json", []byte(ghostExport))
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Imported 2 posts") {
+		t.Fatalf("import: %d", resp.StatusCode)
+	}
+
+	p, err := app.PostSvc.GetBySlug(t.Context(), "markdown-card")
+	if err != nil {
+		t.Fatalf("imported post: %v", err)
+	}
+	if p.ContentMD != "# Hi\n\nFrom *Ghost*" {
+		t.Errorf("the Markdown card should be kept as Markdown, got %q", p.ContentMD)
+	}
+	if p.Category != "News" || p.Tags != "News, Release" || p.Excerpt != "Ghost excerpt" || p.CoverImage != "https://ghost.example.com/img.png" {
+		t.Errorf("unexpected metadata %+v", p)
+	}
+	if !p.IsPublished() || p.PublishedAt.Format(time.RFC3339) != "2022-02-03T04:05:06Z" {
+		t.Errorf("publication: %s %v", p.Status, p.PublishedAt)
+	}
+
+	rich, err := app.PostSvc.GetBySlug(t.Context(), "rich-text")
+	if err != nil || rich.IsPublished() || !strings.Contains(rich.ContentHTML, "<strong>HTML</strong>") {
+		t.Errorf("rich text post: %v %+v", err, rich)
+	}
+	if _, err := app.PostSvc.GetBySlug(t.Context(), "about"); err == nil {
+		t.Error("pages should not be imported")
+	}
+}
+
+func TestImportRejectsUnknownFiles(t *testing.T) {
+	app := testutil.NewTestApp(t)
+	cookie := app.SeedUser(t, "admin", "password123")
+
+	resp, body := importFile(t, app, cookie, "notes.txt", []byte("plain text"))
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "Unsupported import") {
+		t.Errorf("expected 400 with a reason, got %d", resp.StatusCode)
+	}
+	resp, _ = importFile(t, app, cookie, "broken.json", []byte("{not json"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a broken export, got %d", resp.StatusCode)
+	}
+}
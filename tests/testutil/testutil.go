@@ -2,11 +2,14 @@ package testutil
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"html/template"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -15,18 +18,27 @@ import (
 	htmlEngine "github.com/gofiber/template/html/v2"
 	"github.com/mhtecdev/blog-ai/internal/config"
 	"github.com/mhtecdev/blog-ai/internal/database"
+	handlerOps "github.com/mhtecdev/blog-ai/internal/handler/ops"
 	handlerPublic "github.com/mhtecdev/blog-ai/internal/handler/public"
 	handlerStudio "github.com/mhtecdev/blog-ai/internal/handler/studio"
+	"github.com/mhtecdev/blog-ai/internal/metrics"
 	"github.com/mhtecdev/blog-ai/internal/middleware"
+	"github.com/mhtecdev/blog-ai/internal/pagecache"
 	"github.com/mhtecdev/blog-ai/internal/repository"
 	"github.com/mhtecdev/blog-ai/internal/service"
 )
 
 // TestApp wraps a Fiber app and exposes helpers for testing.
 type TestApp struct {
-	App     *fiber.App
-	AuthSvc *service.AuthService
-	PostSvc *service.PostService
+	App          *fiber.App
+	Views        fiber.Views
+	Cfg          *config.Config
+	DB           *database.DB
+	AuthSvc      *service.AuthService
+	PostSvc      *service.PostService
+	AnalyticsSvc *service.AnalyticsService
+	BackupSvc    *service.BackupService
+	PageCache    *pagecache.Cache
 }
 
 func NewTestApp(t *testing.T) *TestApp {
@@ -44,9 +56,24 @@ func NewTestApp(t *testing.T) *TestApp {
 		RateLimitLogin:  3,
 		RateLimitWindow: 5 * time.Second,
 		CSPMode:         "lenient",
+		RequestTimeout:  5 * time.Second,
+		PageCacheSize:   100,
+		PostsPerPage:    10,
+		CodeTheme:       "github",
+		CodeThemeDark:   "github-dark",
+		BackupDir:       t.TempDir(),
+		BackupKeep:      3,
+
+		AnalyticsDedupWindow: 30 * time.Minute,
+		AnalyticsRetention:   90 * 24 * time.Hour,
+
+		MetricsToken: "test-metrics-token",
+
+		SiteURL: "https://blog.example.com",
 	}
 
-	db := database.Open(":memory:?_foreign_keys=on")
+	// A file database, so reads use the separate read-only pool as in production.
+	db := database.Open(filepath.Join(t.TempDir(), "blog.db"))
 	database.RunMigrations(db)
 
 	userRepo      := repository.NewUserRepo(db)
@@ -60,8 +87,11 @@ func NewTestApp(t *testing.T) *TestApp {
 		t.Fatalf("testutil: failed to create auth service: %v", err)
 	}
 	postSvc      := service.NewPostService(postRepo)
+	relatedSvc   := service.NewRelatedService(postSvc)
 	analyticsSvc := service.NewAnalyticsService(analyticsRepo, cfg)
 	mediaSvc     := service.NewMediaService(mediaRepo, cfg)
+	backupSvc    := service.NewBackupService(db, cfg)
+	transferSvc  := service.NewTransferService(postSvc, mediaSvc, cfg)
 
 	// Use a minimal inline template engine for tests
 	engine := htmlEngine.New("../../web/templates", ".html")
@@ -74,34 +104,70 @@ func NewTestApp(t *testing.T) *TestApp {
 
 	app := fiber.New(fiber.Config{
 		Views:        engine,
-		ErrorHandler: func(c *fiber.Ctx, err error) error { return c.Status(500).SendString(err.Error()) },
+		ErrorHandler: middleware.ErrorHandler,
 	})
 
 	app.Static("/static", "../../web/static")
 
+	metricsReg := metrics.NewRegistry()
+	metrics.RegisterRuntime(metricsReg)
+	metrics.RegisterDBStats(metricsReg, map[string]*sql.DB{"read": db.Read, "write": db.Write})
+	analyticsSvc.RegisterMetrics(metricsReg)
+
 	rateLimiter := middleware.NewRateLimiter(cfg)
 	go rateLimiter.Cleanup()
+	rateLimiter.RegisterMetrics(metricsReg)
 	authMW := middleware.RequireAuth(authSvc)
+	userMW := middleware.LoadUser(authSvc)
 
+	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestTimeout(cfg.RequestTimeout))
+	app.Use(middleware.RequestMetrics(metricsReg))
 	app.Use(middleware.SecurityHeaders(cfg))
 
+	// Operational routes
+	healthH     := handlerOps.NewHealthHandler(db, cfg)
+	opsMetricsH := handlerOps.NewMetricsHandler(metricsReg)
+
+	app.Get("/healthz", healthH.Live)
+	app.Get("/readyz", healthH.Ready)
+	app.Get("/metrics", middleware.MetricsAuth(cfg), opsMetricsH.Handle)
+
 	// Public routes
-	homeH     := handlerPublic.NewHomeHandler(postSvc)
-	postH     := handlerPublic.NewPostHandler(postSvc, analyticsSvc)
-	categoryH := handlerPublic.NewCategoryHandler(postSvc)
-	timelineH := handlerPublic.NewTimelineHandler(postSvc)
+	pageCache := pagecache.New(cfg.PageCacheSize)
+	postSvc.OnChange(pageCache.PostChanged)
+	pageCache.RegisterMetrics(metricsReg)
+	cached := pageCache.Middleware()
+
+	homeH     := handlerPublic.NewHomeHandler(postSvc, cfg.PostsPerPage)
+	postH     := handlerPublic.NewPostHandler(postSvc, relatedSvc, analyticsSvc, pageCache)
+	categoryH := handlerPublic.NewCategoryHandler(postSvc, cfg.PostsPerPage)
+	timelineH := handlerPublic.NewTimelineHandler(postSvc, cfg.PostsPerPage)
+	feedH     := handlerPublic.NewFeedHandler(postSvc, cfg)
+	beaconH   := handlerPublic.NewBeaconHandler(analyticsSvc)
+	codeH     := handlerPublic.NewCodeStyleHandler(cfg)
 
-	app.Get("/", homeH.Handle)
-	app.Get("/posts/:slug", postH.Show)
-	app.Get("/categories", categoryH.List)
-	app.Get("/categories/:slug", categoryH.Show)
-	app.Get("/timeline", timelineH.Handle)
+	app.Get("/", cached, homeH.Handle)
+	app.Get("/posts/:slug", userMW, postH.Show)
+	app.Get("/categories", cached, categoryH.List)
+	app.Get("/categories/:slug", cached, categoryH.Show)
+	app.Get("/categories/:slug/feed.xml", cached, feedH.CategoryAtom)
+	app.Get("/timeline", cached, timelineH.Handle)
+	app.Get("/archive/:year", cached, timelineH.Year)
+	app.Get("/archive/:year/:month", cached, timelineH.Month)
+	app.Get("/about", cached, handlerPublic.AboutHandler)
+	app.Get("/feed.xml", cached, feedH.Atom)
+	app.Get("/sitemap.xml", cached, feedH.Sitemap)
+	app.Get("/code.css", cached, codeH.Handle)
+	app.Post("/beacon/read", beaconH.Read)
 
 	// Studio routes
 	authH      := handlerStudio.NewAuthHandler(authSvc, cfg)
 	dashboardH := handlerStudio.NewDashboardHandler(postSvc, analyticsSvc)
 	postsH     := handlerStudio.NewPostsHandler(postSvc, mediaSvc)
-	metricsH   := handlerStudio.NewMetricsHandler(analyticsSvc)
+	metricsH   := handlerStudio.NewMetricsHandler(analyticsSvc, postSvc)
+	backupsH   := handlerStudio.NewBackupsHandler(backupSvc)
+	transferH  := handlerStudio.NewTransferHandler(transferSvc)
 
 	studio := app.Group("/studio")
 	studio.Get("/login", authH.ShowLogin)
@@ -119,8 +185,22 @@ func NewTestApp(t *testing.T) *TestApp {
 	studio.Post("/posts/:id/unpublish", authMW, postsH.Unpublish)
 	studio.Post("/upload", authMW, postsH.Upload)
 	studio.Get("/metrics", authMW, metricsH.Handle)
+	studio.Get("/metrics/posts/:id", authMW, metricsH.Post)
+	studio.Get("/metrics/export", authMW, metricsH.Export)
+	studio.Get("/metrics/live", authMW, metricsH.Live)
+	studio.Get("/backups", authMW, backupsH.List)
+	studio.Post("/backups", authMW, backupsH.Create)
+	studio.Get("/backups/:name", authMW, backupsH.Download)
+	studio.Get("/transfer", authMW, transferH.Show)
+	studio.Get("/transfer/export", authMW, transferH.Export)
+	studio.Post("/transfer/import", authMW, transferH.Import)
+
+	t.Cleanup(func() {
+		analyticsSvc.Close(context.Background())
+		db.Close()
+	})
 
-	return &TestApp{App: app, AuthSvc: authSvc, PostSvc: postSvc}
+	return &TestApp{App: app, Views: engine, Cfg: cfg, DB: db, AuthSvc: authSvc, PostSvc: postSvc, AnalyticsSvc: analyticsSvc, BackupSvc: backupSvc, PageCache: pageCache}
 }
 
 // Do performs a test HTTP request.
@@ -167,10 +247,10 @@ func (ta *TestApp) PostJSON(path string, v interface{}) *http.Response {
 // SeedUser creates a test admin user and returns the session cookie.
 func (ta *TestApp) SeedUser(t *testing.T, username, password string) *http.Cookie {
 	t.Helper()
-	if err := ta.AuthSvc.CreateUser(username, password, ""); err != nil {
+	if err := ta.AuthSvc.CreateUser(context.Background(), username, password, ""); err != nil {
 		t.Fatalf("SeedUser: %v", err)
 	}
-	session, err := ta.AuthSvc.Login(username, password, "127.0.0.1", "test-agent")
+	session, err := ta.AuthSvc.Login(context.Background(), username, password, "127.0.0.1", "test-agent")
 	if err != nil {
 		t.Fatalf("SeedUser login: %v", err)
 	}
@@ -52,7 +52,7 @@
         .then(function (res) {
           if (!res.ok) {
             return res.json().then(function (d) {
-              throw new Error(d.error || "Upload failed");
+              throw new Error(d.detail || d.title || "Upload failed");
             });
           }
           return res.json();
@@ -62,12 +62,9 @@
           if (data.mime_type.indexOf("image/") === 0) {
             md = "![" + (data.filename || file.name) + "](" + data.url + ")";
           } else if (data.mime_type.indexOf("video/") === 0) {
-            md =
-              '<video controls src="' +
-              data.url +
-              '" style="max-width:100%"></video>';
+            md = '\n{{< video src="' + data.url + '" >}}\n';
           } else if (data.mime_type.indexOf("audio/") === 0) {
-            md = '<audio controls src="' + data.url + '"></audio>';
+            md = '\n{{< audio src="' + data.url + '" >}}\n';
           }
           var cm = easyMDE.codemirror;
           cm.replaceSelection(md);
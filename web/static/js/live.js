@@ -0,0 +1,76 @@
+/* AI Studies — live dashboard panel
+ * Subscribes to /studio/metrics/live (Server-Sent Events) and renders the
+ * current readers per post and a feed of views as they are recorded.
+ */
+(function () {
+  var panel = document.getElementById("live");
+  if (!panel || !window.EventSource) return;
+
+  var total = document.getElementById("live-total");
+  var readers = document.getElementById("live-readers");
+  var feed = document.getElementById("live-feed");
+  var MAX_FEED = 20;
+
+  function postLink(title, slug) {
+    var a = document.createElement("a");
+    a.href = "/posts/" + slug;
+    a.target = "_blank";
+    a.textContent = title;
+    return a;
+  }
+
+  function cell(row, content) {
+    var td = document.createElement("td");
+    if (typeof content === "string") td.textContent = content;
+    else td.appendChild(content);
+    row.appendChild(td);
+  }
+
+  function renderReaders(data) {
+    total.textContent = String(data.total);
+    readers.textContent = "";
+    if (!data.posts.length) {
+      var empty = document.createElement("tr");
+      var td = document.createElement("td");
+      td.colSpan = 2;
+      td.className = "muted";
+      td.textContent = "No one is reading right now.";
+      empty.appendChild(td);
+      readers.appendChild(empty);
+      return;
+    }
+    data.posts.forEach(function (p) {
+      var row = document.createElement("tr");
+      cell(row, postLink(p.title, p.slug));
+      cell(row, String(p.readers));
+      readers.appendChild(row);
+    });
+  }
+
+  function addView(v) {
+    var li = document.createElement("li");
+    var time = document.createElement("span");
+    time.className = "muted";
+    time.textContent = new Date(v.at).toLocaleTimeString();
+    var badge = document.createElement("span");
+    badge.className = "badge badge-channel";
+    badge.textContent = v.referrer || v.channel;
+    li.appendChild(time);
+    li.appendChild(postLink(v.title, v.slug));
+    li.appendChild(badge);
+    feed.insertBefore(li, feed.firstChild);
+    while (feed.children.length > MAX_FEED) feed.removeChild(feed.lastChild);
+  }
+
+  var source = new EventSource(panel.getAttribute("data-live-url"));
+  source.addEventListener("readers", function (e) {
+    renderReaders(JSON.parse(e.data));
+    panel.classList.remove("live-offline");
+  });
+  source.addEventListener("view", function (e) {
+    addView(JSON.parse(e.data));
+  });
+  source.onerror = function () {
+    panel.classList.add("live-offline");
+  };
+})();
@@ -0,0 +1,63 @@
+/* AI Studies — reading progress beacon
+ * Reports the deepest scroll milestone (25/50/75/100%) reached in the post body
+ * and the time the reader was actively engaged. Loaded only on post pages that
+ * carry a view token; no cookies or identifiers beyond that token are sent.
+ */
+(function () {
+  var article = document.querySelector("[data-view-token]");
+  var content = document.querySelector(".post-content");
+  if (!article || !content || !navigator.sendBeacon) return;
+
+  var token = article.getAttribute("data-view-token");
+  var IDLE_AFTER_MS = 30000;
+
+  var depth = 0;
+  var sentDepth = 0;
+  var engagedMs = 0;
+  var lastActive = Date.now();
+  var lastTick = Date.now();
+
+  function send() {
+    var seconds = Math.round(engagedMs / 1000);
+    if (depth === 0 && seconds === 0) return;
+    var body = new URLSearchParams({ t: token, d: String(depth), s: String(seconds) });
+    navigator.sendBeacon("/beacon/read", body);
+    sentDepth = depth;
+  }
+
+  function measureDepth() {
+    var rect = content.getBoundingClientRect();
+    var height = rect.height || 1;
+    var seen = (window.innerHeight - rect.top) / height;
+    var pct = Math.min(100, Math.max(0, Math.floor(seen * 4) * 25));
+    if (pct > depth) {
+      depth = pct;
+      if (depth > sentDepth) send();
+    }
+  }
+
+  function markActive() {
+    lastActive = Date.now();
+  }
+
+  // Engaged time only accrues while the tab is visible and the reader has
+  // interacted recently.
+  setInterval(function () {
+    var now = Date.now();
+    if (document.visibilityState === "visible" && now - lastActive < IDLE_AFTER_MS) {
+      engagedMs += now - lastTick;
+    }
+    lastTick = now;
+  }, 1000);
+
+  ["scroll", "mousemove", "keydown", "touchstart"].forEach(function (evt) {
+    window.addEventListener(evt, markActive, { passive: true });
+  });
+  window.addEventListener("scroll", measureDepth, { passive: true });
+  document.addEventListener("visibilitychange", function () {
+    if (document.visibilityState === "hidden") send();
+  });
+  window.addEventListener("pagehide", send);
+
+  measureDepth();
+})();